@@ -5,15 +5,28 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"lyenv/internal/bundle"
+	"lyenv/internal/cache"
 	"lyenv/internal/cli"
+	"lyenv/internal/clone"
 	"lyenv/internal/config"
+	"lyenv/internal/doctor"
 	"lyenv/internal/env"
+	"lyenv/internal/migrate"
 	"lyenv/internal/plugin"
+	"lyenv/internal/secret"
+	"lyenv/internal/shell"
+	"lyenv/internal/snapshot"
+	"lyenv/internal/state"
+	"lyenv/internal/store"
+	"lyenv/internal/template"
 	"lyenv/internal/version"
 )
 
@@ -23,13 +36,19 @@ func usage() {
 
 func main() {
 	flag.Usage = usage
+	profile := flag.String("profile", "", "config profile overlay (lyenv.<profile>.yaml); defaults to $LYENV_PROFILE")
+	flag.StringVar(&envFlag, "env", "", "environment directory; defaults to $LYENV_HOME, then the nearest parent with lyenv.yaml")
+	offline := flag.Bool("offline", false, "never touch the network; resolve plugins from the cache and the synced center index")
 	flag.Parse()
+	config.SetProfile(*profile)
+	cache.SetOffline(*offline)
 
 	args := flag.Args()
 	if len(args) < 1 {
 		usage()
 		os.Exit(2)
 	}
+	command = args[0]
 
 	switch args[0] {
 
@@ -38,16 +57,18 @@ func main() {
 		return
 
 	case "create":
-		if len(args) != 2 {
+		pos, flagArgs := splitArgs(args[1:])
+		if len(pos) != 1 {
 			fmt.Fprintln(os.Stderr, "Error: create requires exactly 1 argument <DIR>")
 			os.Exit(2)
 		}
-		dir := strings.TrimSpace(args[1])
+		dir := strings.TrimSpace(pos[0])
 		if dir == "" {
 			fmt.Fprintln(os.Stderr, "Error: <DIR> must not be empty")
 			os.Exit(2)
 		}
-		if err := env.CmdCreate(dir); err != nil {
+		flags := config.ParseFlags(flagArgs)
+		if err := template.Create(dir, flags["template"]); err != nil {
 			fmt.Fprintf(os.Stderr, "Create failed: %v\n", err)
 			os.Exit(1)
 		}
@@ -63,39 +84,276 @@ func main() {
 			fmt.Fprintln(os.Stderr, "Error: <DIR> must not be empty")
 			os.Exit(2)
 		}
+		// Refuse a newer layout before init writes anything
+		if env.IsLyenvDir(dir) {
+			if _, err := migrate.Check(dir); err != nil {
+				fmt.Fprintf(os.Stderr, "Init failed: %v\n", err)
+				os.Exit(1)
+			}
+		}
 		if err := env.CmdInit(dir); err != nil {
 			fmt.Fprintf(os.Stderr, "Init failed: %v\n", err)
 			os.Exit(1)
 		}
+		steps, err := migrate.Run(dir)
+		printMigrationSteps(steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Init failed: %v\n", err)
+			os.Exit(1)
+		}
 		fmt.Println("Environment initialized successfully.")
 
 	case "activate":
-		if len(args) != 1 {
-			fmt.Fprintln(os.Stderr, "Error: activate takes no arguments")
+		pos, flagArgs := splitArgs(args[1:])
+		if len(pos) != 0 {
+			fmt.Fprintln(os.Stderr, "Error: usage: lyenv activate [--shell=bash|zsh|fish|powershell|nu]")
 			os.Exit(2)
 		}
-		if err := env.CmdActivate(); err != nil {
+		flags := config.ParseFlags(flagArgs)
+		if err := shell.CmdActivate(envDir(), flags["shell"]); err != nil {
 			fmt.Fprintf(os.Stderr, "Activate failed: %v\n", err)
 			os.Exit(1)
 		}
 
+	case "deactivate":
+		pos, flagArgs := splitArgs(args[1:])
+		if len(pos) != 0 {
+			fmt.Fprintln(os.Stderr, "Error: usage: lyenv deactivate [--shell=bash|zsh|fish|powershell|nu]")
+			os.Exit(2)
+		}
+		flags := config.ParseFlags(flagArgs)
+		if err := shell.CmdDeactivate(flags["shell"]); err != nil {
+			fmt.Fprintf(os.Stderr, "Deactivate failed: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "template":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Error: missing subcommand for template (list|save)")
+			os.Exit(2)
+		}
+		switch args[1] {
+		case "list":
+			ts, err := template.List()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			for _, t := range ts {
+				fmt.Printf("%-20s %s\n", t.Name, t.Description)
+			}
+		case "save":
+			pos, flagArgs := splitArgs(args[2:])
+			if len(pos) != 1 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv template save <NAME|DIR> [--force]")
+				os.Exit(2)
+			}
+			flags := config.ParseFlags(flagArgs)
+			dest, skipped, err := template.Save(envDir(), strings.TrimSpace(pos[0]), flags["force"] == "1")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Save failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Template saved: %s\n", dest)
+			if skipped > 0 {
+				fmt.Printf("Note: skipped %d workspace file(s) larger than 1 MiB or not regular files\n", skipped)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown template subcommand: %s\n", args[1])
+			os.Exit(2)
+		}
+
+	case "migrate":
+		flags := config.ParseFlags(args[1:])
+		dir := envDir()
+		if flags["dry-run"] == "1" {
+			pending, err := migrate.Pending(dir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Migrate failed: %v\n", err)
+				os.Exit(1)
+			}
+			if len(pending) == 0 {
+				fmt.Printf("Environment layout is current (%d).\n", env.LayoutVersion)
+			}
+			for _, m := range pending {
+				fmt.Printf("layout %d -> %d: %s\n", m.From, m.From+1, m.Description)
+			}
+			return
+		}
+		steps, err := migrate.Run(dir)
+		printMigrationSteps(steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Migrate failed: %v\n", err)
+			os.Exit(1)
+		}
+		if len(steps) == 0 {
+			fmt.Printf("Environment layout is current (%d).\n", env.LayoutVersion)
+		}
+
+	case "doctor":
+		flags := config.ParseFlags(args[1:])
+		rep, err := doctor.Run(envDir(), flags["fix"] == "1")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Doctor failed: %v\n", err)
+			os.Exit(1)
+		}
+		if flags["json"] == "1" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(rep)
+		} else if len(rep.Issues) == 0 {
+			fmt.Println("No problems found.")
+		} else {
+			fixed := 0
+			for _, i := range rep.Issues {
+				fmt.Println(i.String())
+				if i.Fixed {
+					fixed++
+				}
+			}
+			fmt.Printf("%d issue(s), %d fixed\n", len(rep.Issues), fixed)
+		}
+		if rep.Failed() {
+			os.Exit(1)
+		}
+
+	case "export":
+		pos, flagArgs := splitArgs(args[1:])
+		if len(pos) != 1 {
+			fmt.Fprintln(os.Stderr, "Error: usage: lyenv export <FILE.tar.gz> [--sources-only] [--workspace=<PATH>[,<PATH>...]]")
+			os.Exit(2)
+		}
+		flags := config.ParseFlags(flagArgs)
+		opts := bundle.ExportOptions{SourcesOnly: flags["sources-only"] == "1"}
+		for _, w := range strings.Split(flags["workspace"], ",") {
+			if w = strings.TrimSpace(w); w != "" {
+				opts.Workspace = append(opts.Workspace, w)
+			}
+		}
+		m, err := bundle.Export(envDir(), pos[0], opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Environment exported: %s (%d plugin(s))\n", pos[0], len(m.Plugins))
+
+	case "import":
+		if len(args) != 3 {
+			fmt.Fprintln(os.Stderr, "Error: usage: lyenv import <FILE> <DIR>")
+			os.Exit(2)
+		}
+		res, err := bundle.Import(strings.TrimSpace(args[1]), strings.TrimSpace(args[2]))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Environment imported: %s\n", res.Home)
+		if res.Rewritten > 0 {
+			fmt.Printf("Rewrote paths from %s in %d file(s)\n", res.Manifest.Home, res.Rewritten)
+		}
+		if res.Reinstalled > 0 {
+			fmt.Printf("Reinstalled %d plugin(s) from the plugin center\n", res.Reinstalled)
+		}
+
+	case "shell":
+		pos, flagArgs := splitArgs(args[1:])
+		if len(pos) != 0 {
+			fmt.Fprintln(os.Stderr, "Error: usage: lyenv shell [--shell=bash|zsh|fish|powershell|nu]")
+			os.Exit(2)
+		}
+		flags := config.ParseFlags(flagArgs)
+		code, err := shell.CmdShell(envDir(), flags["shell"])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Shell failed: %v\n", err)
+			if code == 0 {
+				code = 1
+			}
+		}
+		os.Exit(code)
+
+	case "exec":
+		argv := args[1:]
+		if len(argv) > 0 && argv[0] == "--" {
+			argv = argv[1:]
+		}
+		if len(argv) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: usage: lyenv exec -- <CMD> [ARGS...]")
+			os.Exit(2)
+		}
+		code, err := shell.CmdExec(envDir(), argv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Exec failed: %v\n", err)
+			if code == 0 {
+				code = 1
+			}
+		}
+		os.Exit(code)
+
+	case "hook":
+		pos, flagArgs := splitArgs(args[1:])
+		if len(pos) > 1 {
+			fmt.Fprintln(os.Stderr, "Error: usage: lyenv hook [bash|zsh|fish|powershell]")
+			os.Exit(2)
+		}
+		shellName := ""
+		if len(pos) == 1 {
+			shellName = pos[0]
+		}
+		flags := config.ParseFlags(flagArgs)
+		run := shell.CmdHook
+		if flags["apply"] == "1" {
+			run = shell.CmdHookApply
+		}
+		if err := run(shellName); err != nil {
+			fmt.Fprintf(os.Stderr, "Hook failed: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "allow", "deny":
+		if len(args) > 2 {
+			fmt.Fprintf(os.Stderr, "Error: usage: lyenv %s [<DIR>]\n", args[0])
+			os.Exit(2)
+		}
+		dir := ""
+		if len(args) == 2 {
+			dir = strings.TrimSpace(args[1])
+		} else {
+			dir = envDir()
+		}
+		trust := env.Allow
+		if args[0] == "deny" {
+			trust = env.Deny
+		}
+		abs, err := trust(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if args[0] == "allow" {
+			fmt.Printf("Allowed auto-activation: %s\n", abs)
+		} else {
+			fmt.Printf("Revoked auto-activation: %s\n", abs)
+		}
+
 	case "config":
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "Error: missing subcommand for config (set|get|dump|load|importjson|importyaml)")
+			fmt.Fprintln(os.Stderr, "Error: missing subcommand for config (set|get|unset|dump|load|import|importjson|importyaml|validate)")
 			os.Exit(2)
 		}
 		sub := args[1]
 		switch sub {
 		case "set":
 			if len(args) < 4 {
-				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config set <KEY> <VALUE> [--type=string|int|float|bool|json]")
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config set <KEY> <VALUE> [--type=string|int|float|bool|json] [--layer=user|env|profile]")
 				os.Exit(2)
 			}
 			key := strings.TrimSpace(args[2])
 			value := args[3]
 			flags := config.ParseFlags(args[4:])
 			typeOpt := flags["type"]
-			if err := config.ConfigSetWithType(".", "lyenv.yaml", key, value, typeOpt); err != nil {
+			target := layerTarget(flags["layer"])
+			if err := config.ConfigSetWithType(envDir(), target, key, value, typeOpt); err != nil {
 				fmt.Fprintf(os.Stderr, "Config set failed: %v\n", err)
 				os.Exit(1)
 			}
@@ -106,56 +364,102 @@ func main() {
 			}
 
 		case "get":
-			if len(args) != 3 {
-				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config get <KEY>")
+			if len(args) < 3 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config get <KEY> [--show-origin] [--raw]")
 				os.Exit(2)
 			}
 			key := strings.TrimSpace(args[2])
-			out, err := config.ConfigGet(".", "lyenv.yaml", key)
+			flags := config.ParseFlags(args[3:])
+			out, origin, err := config.ConfigGetWithOrigin(envDir(), "lyenv.yaml", key, flags["raw"] != "1")
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Config get failed: %v\n", err)
 				os.Exit(1)
 			}
+			if flags["show-origin"] == "1" {
+				fmt.Printf("# origin: %s\n", origin)
+			}
 			fmt.Print(out)
 
+		case "unset":
+			if len(args) < 3 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config unset <KEY> [--layer=user|env|profile]")
+				os.Exit(2)
+			}
+			key := strings.TrimSpace(args[2])
+			flags := config.ParseFlags(args[3:])
+			target := layerTarget(flags["layer"])
+			if err := config.ConfigUnset(envDir(), target, key); err != nil {
+				fmt.Fprintf(os.Stderr, "Config unset failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Config key removed: %s\n", key)
+
 		case "dump":
-			if len(args) == 3 {
-				file := strings.TrimSpace(args[2])
-				if err := config.ConfigDump(".", "lyenv.yaml", "", file); err != nil {
+			pos, flagArgs := splitArgs(args[2:])
+			flags := config.ParseFlags(flagArgs)
+			format := flags["format"]
+			if len(pos) == 1 {
+				file := strings.TrimSpace(pos[0])
+				if err := config.ConfigDump(envDir(), "lyenv.yaml", "", file, format); err != nil {
 					fmt.Fprintf(os.Stderr, "Config dump failed: %v\n", err)
 					os.Exit(1)
 				}
 				fmt.Printf("Config dumped to: %s\n", file)
-			} else if len(args) == 4 {
-				key := strings.TrimSpace(args[2])
-				file := strings.TrimSpace(args[3])
-				if err := config.ConfigDump(".", "lyenv.yaml", key, file); err != nil {
+			} else if len(pos) == 2 {
+				key := strings.TrimSpace(pos[0])
+				file := strings.TrimSpace(pos[1])
+				if err := config.ConfigDump(envDir(), "lyenv.yaml", key, file, format); err != nil {
 					fmt.Fprintf(os.Stderr, "Config dump failed: %v\n", err)
 					os.Exit(1)
 				}
 				fmt.Printf("Config key dumped: %s -> %s\n", key, file)
 			} else {
-				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config dump [<KEY>] <FILE>")
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config dump [<KEY>] <FILE> [--format=yaml|json|toml|dotenv|ini]")
 				os.Exit(2)
 			}
 
 		case "load":
 			if len(args) < 3 {
-				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config load <FILE> [--merge=override|append|keep]")
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config load <FILE> [--merge=override|append|keep] [--format=yaml|json|toml|dotenv|ini] [--layer=user|env|profile]")
 				os.Exit(2)
 			}
 			file := strings.TrimSpace(args[2])
 			flags := config.ParseFlags(args[3:])
 			strategy := config.ParseMergeStrategy(flags["merge"])
-			if err := config.ConfigLoadWithStrategy(".", "lyenv.yaml", file, strategy); err != nil {
+			target := layerTarget(flags["layer"])
+			autoSnapshot("before config load of " + file)
+			if err := config.ConfigLoadWithStrategy(envDir(), target, file, flags["format"], strategy); err != nil {
 				fmt.Fprintf(os.Stderr, "Config load failed: %v\n", err)
 				os.Exit(1)
 			}
 			fmt.Printf("Config loaded and merged from: %s (strategy=%s)\n", file, strategy)
 
+		case "import":
+			if len(args) < 4 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config import <FILE> <KEY> [--to=<CONFIG_KEY>] [--format=yaml|json|toml|dotenv|ini] [--type=string|int|float|bool|json] [--merge=override|append|keep] [--input=1] [--layer=user|env|profile]")
+				os.Exit(2)
+			}
+			srcFile := strings.TrimSpace(args[2])
+			srcKey := strings.TrimSpace(args[3])
+			flags := config.ParseFlags(args[4:])
+			destKey := flags["to"]
+			if destKey == "" {
+				destKey = srcKey
+			}
+			typeOpt := flags["type"]
+			strategy := config.ParseMergeStrategy(flags["merge"])
+			inputOn := flags["input"] == "1"
+			target := layerTarget(flags["layer"])
+			if err := config.ConfigImport(envDir(), target, srcFile, srcKey, destKey, typeOpt, flags["format"], strategy, inputOn); err != nil {
+				fmt.Fprintf(os.Stderr, "Config import failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Config imported: %s[%s] -> %s (type=%s, strategy=%s)\n",
+				srcFile, srcKey, destKey, config.NonEmpty(typeOpt, "auto"), strategy)
+
 		case "importjson":
 			if len(args) < 4 {
-				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config importjson <FILE> <JSON_KEY> [--to=<CONFIG_KEY>] [--type=string|int|float|bool|json] [--merge=override|append|keep] [--input=1]")
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config importjson <FILE> <JSON_KEY> [--to=<CONFIG_KEY>] [--type=string|int|float|bool|json] [--merge=override|append|keep] [--input=1] [--layer=user|env|profile]")
 				os.Exit(2)
 			}
 			jsonFile := strings.TrimSpace(args[2])
@@ -168,7 +472,8 @@ func main() {
 			typeOpt := flags["type"]
 			strategy := config.ParseMergeStrategy(flags["merge"])
 			inputOn := flags["input"] == "1"
-			if err := config.ConfigImportJSON(".", "lyenv.yaml", jsonFile, jsonKey, destKey, typeOpt, strategy, inputOn); err != nil {
+			target := layerTarget(flags["layer"])
+			if err := config.ConfigImportJSON(envDir(), target, jsonFile, jsonKey, destKey, typeOpt, strategy, inputOn); err != nil {
 				fmt.Fprintf(os.Stderr, "Config importjson failed: %v\n", err)
 				os.Exit(1)
 			}
@@ -177,7 +482,7 @@ func main() {
 
 		case "importyaml":
 			if len(args) < 4 {
-				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config importyaml <FILE> <YAML_KEY> [--to=<CONFIG_KEY>] [--type=string|int|float|bool|json] [--merge=override|append|keep] [--input=1]")
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv config importyaml <FILE> <YAML_KEY> [--to=<CONFIG_KEY>] [--type=string|int|float|bool|json] [--merge=override|append|keep] [--input=1] [--layer=user|env|profile]")
 				os.Exit(2)
 			}
 			yamlFile := strings.TrimSpace(args[2])
@@ -190,18 +495,517 @@ func main() {
 			typeOpt := flags["type"]
 			strategy := config.ParseMergeStrategy(flags["merge"])
 			inputOn := flags["input"] == "1"
-			if err := config.ConfigImportYAML(".", "lyenv.yaml", yamlFile, yamlKey, destKey, typeOpt, strategy, inputOn); err != nil {
+			target := layerTarget(flags["layer"])
+			if err := config.ConfigImportYAML(envDir(), target, yamlFile, yamlKey, destKey, typeOpt, strategy, inputOn); err != nil {
 				fmt.Fprintf(os.Stderr, "Config importyaml failed: %v\n", err)
 				os.Exit(1)
 			}
 			fmt.Printf("Config updated from YAML: %s[%s] -> %s (type=%s, strategy=%s)\n",
 				yamlFile, yamlKey, destKey, config.NonEmpty(typeOpt, "auto"), strategy)
 
+		case "validate":
+			flags := config.ParseFlags(args[2:])
+			wantJSON := flags["json"] == "1"
+			vs, err := plugin.ValidateEnvConfig(envDir())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Config validate failed: %v\n", err)
+				os.Exit(1)
+			}
+			if wantJSON {
+				if vs == nil {
+					vs = []config.Violation{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetEscapeHTML(false)
+				enc.SetIndent("", "  ")
+				_ = enc.Encode(vs)
+			} else if len(vs) == 0 {
+				fmt.Println("Config is valid.")
+			} else {
+				for _, v := range vs {
+					fmt.Println(v.String())
+				}
+			}
+			if len(vs) > 0 {
+				os.Exit(1)
+			}
+
 		default:
 			fmt.Fprintf(os.Stderr, "Unknown config subcommand: %s\n", sub)
 			os.Exit(2)
 		}
 
+	case "secret":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Error: missing subcommand for secret (set|get|rm)")
+			os.Exit(2)
+		}
+		sub := args[1]
+		switch sub {
+		case "set":
+			if len(args) < 3 || len(args) > 4 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv secret set <NAME> [<VALUE>]  (value is read from stdin when omitted)")
+				os.Exit(2)
+			}
+			name := strings.TrimSpace(args[2])
+			var value string
+			if len(args) == 4 {
+				value = args[3]
+			} else {
+				in, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Secret set failed: %v\n", err)
+					os.Exit(1)
+				}
+				value = strings.TrimRight(string(in), "\r\n")
+			}
+			if err := secret.Set(envDir(), name, value); err != nil {
+				fmt.Fprintf(os.Stderr, "Secret set failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Secret stored: %s (use ${secret:%s} in config)\n", name, name)
+
+		case "get":
+			if len(args) != 3 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv secret get <NAME>")
+				os.Exit(2)
+			}
+			v, err := secret.Get(envDir(), strings.TrimSpace(args[2]))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Secret get failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(v)
+
+		case "rm":
+			if len(args) != 3 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv secret rm <NAME>")
+				os.Exit(2)
+			}
+			name := strings.TrimSpace(args[2])
+			if err := secret.Remove(envDir(), name); err != nil {
+				fmt.Fprintf(os.Stderr, "Secret rm failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Secret removed: %s\n", name)
+
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown secret subcommand: %s\n", sub)
+			os.Exit(2)
+		}
+
+	case "env":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Error: missing subcommand for env (list|clone|rm|rename|use)")
+			os.Exit(2)
+		}
+		sub := args[1]
+		pos, flagArgs := splitArgs(args[2:])
+		flags := config.ParseFlags(flagArgs)
+		switch sub {
+		case "list":
+			list, err := env.IndexStatuses()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if flags["json"] == "1" {
+				out, _ := json.MarshalIndent(list, "", "  ")
+				fmt.Println(string(out))
+				return
+			}
+			if len(list) == 0 {
+				fmt.Println("No environments indexed (they are added by `lyenv create` and `lyenv init`).")
+			}
+			for _, e := range list {
+				mark := " "
+				if e.Active {
+					mark = "*"
+				}
+				info := "(missing)"
+				if !e.Missing {
+					info = fmt.Sprintf("%2d plugin(s) %10s", e.Plugins, env.HumanSize(e.Size))
+				}
+				fmt.Printf("%s %-20s %-22s %s\n", mark, e.Name, info, e.Path)
+			}
+
+		case "rm":
+			if len(pos) != 1 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv env rm <NAME|DIR> [--yes] [--keep-files]")
+				os.Exit(2)
+			}
+			e, err := env.LookupIndex(strings.TrimSpace(pos[0]))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Env rm failed: %v\n", err)
+				os.Exit(1)
+			}
+			keep := flags["keep-files"] == "1"
+			if flags["yes"] != "1" {
+				q := fmt.Sprintf("Delete environment %s and all files in %s? [y/N]", e.Name, e.Path)
+				if keep {
+					q = fmt.Sprintf("Forget environment %s (%s)? Its files are kept. [y/N]", e.Name, e.Path)
+				}
+				ans, _ := env.PromptLine(q)
+				if a := strings.ToLower(ans); a != "y" && a != "yes" {
+					fmt.Println("Aborted.")
+					os.Exit(1)
+				}
+			}
+			if err := env.RemoveEnv(e, keep); err != nil {
+				fmt.Fprintf(os.Stderr, "Env rm failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Environment removed: %s\n", e.Name)
+
+		case "rename":
+			if len(pos) != 2 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv env rename <NAME|DIR> <NEW_NAME>")
+				os.Exit(2)
+			}
+			e, err := env.RenameIndex(strings.TrimSpace(pos[0]), strings.TrimSpace(pos[1]))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Env rename failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Environment renamed: %s (%s)\n", e.Name, e.Path)
+
+		case "clone":
+			if len(pos) != 2 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv env clone <SRC> <DST> [--profile=<NAME>] [--copy]")
+				os.Exit(2)
+			}
+			src := strings.TrimSpace(pos[0])
+			if e, err := env.LookupIndex(src); err == nil && !env.IsLyenvDir(src) {
+				src = e.Path
+			}
+			res, err := clone.Clone(src, strings.TrimSpace(pos[1]), clone.Options{Profile: flags["profile"], Copy: flags["copy"] == "1"})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Env clone failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Environment cloned: %s (%d plugin(s))\n", res.Home, res.Plugins)
+			if res.Reflinked > 0 {
+				fmt.Printf("Plugin trees cloned copy-on-write: %d\n", res.Reflinked)
+			}
+			if res.Linked+res.Copied > 0 {
+				fmt.Printf("Plugin files hardlinked: %d, copied: %d\n", res.Linked, res.Copied)
+			}
+			if res.Rewritten > 0 {
+				fmt.Printf("Rewrote source paths in %d file(s)\n", res.Rewritten)
+			}
+
+		case "use":
+			if len(pos) != 1 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv env use <NAME> [--shell=bash|zsh|fish|powershell|nu]")
+				os.Exit(2)
+			}
+			e, err := env.LookupIndex(strings.TrimSpace(pos[0]))
+			if err == nil && !env.IsLyenvDir(e.Path) {
+				err = fmt.Errorf("environment %s no longer exists at %s", e.Name, e.Path)
+			}
+			if err == nil {
+				err = shell.CmdActivate(e.Path, flags["shell"])
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Env use failed: %v\n", err)
+				os.Exit(1)
+			}
+
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown env subcommand: %s\n", sub)
+			os.Exit(2)
+		}
+
+	case "snapshot":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Error: missing subcommand for snapshot (create|list|restore|rm)")
+			os.Exit(2)
+		}
+		sub := args[1]
+		switch sub {
+		case "create":
+			if len(args) > 3 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv snapshot create [NAME]")
+				os.Exit(2)
+			}
+			name := ""
+			if len(args) == 3 {
+				name = strings.TrimSpace(args[2])
+			}
+			s, err := snapshot.Create(envDir(), name, "")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Snapshot failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Snapshot created: %s (%d file(s))\n", s.Name, s.Files())
+
+		case "list":
+			list, err := snapshot.List(envDir())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if len(list) == 0 {
+				fmt.Println("No snapshots.")
+			}
+			for _, s := range list {
+				line := fmt.Sprintf("%-28s %s  %5d file(s)  %s", s.Name, s.CreatedAt, s.Files(), s.Reason)
+				fmt.Println(strings.TrimRight(line, " "))
+			}
+
+		case "restore":
+			if len(args) != 3 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv snapshot restore <NAME>")
+				os.Exit(2)
+			}
+			name := strings.TrimSpace(args[2])
+			pre, err := snapshot.Restore(envDir(), name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Restore failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Snapshot restored: %s (previous state saved as %s)\n", name, pre.Name)
+
+		case "rm":
+			if len(args) != 3 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv snapshot rm <NAME>")
+				os.Exit(2)
+			}
+			name := strings.TrimSpace(args[2])
+			if err := snapshot.Remove(envDir(), name); err != nil {
+				fmt.Fprintf(os.Stderr, "Snapshot rm failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Snapshot removed: %s\n", name)
+
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown snapshot subcommand: %s\n", sub)
+			os.Exit(2)
+		}
+
+	case "cache":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Error: missing subcommand for cache (list|clean|prune)")
+			os.Exit(2)
+		}
+		sub := args[1]
+		pos, flagArgs := splitArgs(args[2:])
+		flags := config.ParseFlags(flagArgs)
+		switch sub {
+		case "list":
+			list, err := cache.List(envDir())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if flags["json"] == "1" {
+				out, _ := json.MarshalIndent(list, "", "  ")
+				fmt.Println(string(out))
+				return
+			}
+			if len(list) == 0 {
+				fmt.Printf("Cache is empty (%s).\n", cache.Dir(envDir()))
+			}
+			var total int64
+			for _, e := range list {
+				what := e.URL
+				if e.Ref != "" {
+					what += "@" + e.Ref
+				}
+				fmt.Printf("%-9s %10s  used %s  %s\n", e.Kind, env.HumanSize(e.Size), e.UsedAt, what)
+				total += e.Size
+			}
+			if len(list) > 0 {
+				fmt.Printf("%d item(s), %s in %s\n", len(list), env.HumanSize(total), cache.Dir(envDir()))
+			}
+
+		case "clean":
+			if len(pos) > 1 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv cache clean [downloads|git|index]")
+				os.Exit(2)
+			}
+			kind := ""
+			if len(pos) == 1 {
+				kind = strings.TrimSpace(pos[0])
+			}
+			n, freed, err := cache.Clean(envDir(), kind)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Cache clean failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Removed %d cached item(s), %s.\n", n, env.HumanSize(freed))
+
+		case "prune":
+			v, ok := flags["older-than"]
+			if !ok || v == "" || v == "1" {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv cache prune --older-than=<AGE> (e.g. 30d, 12h)")
+				os.Exit(2)
+			}
+			age, err := cache.ParseAge(v)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(2)
+			}
+			removed, freed, err := cache.Prune(envDir(), age)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Cache prune failed: %v\n", err)
+				os.Exit(1)
+			}
+			for _, e := range removed {
+				fmt.Printf("Removed %s %s (last used %s)\n", e.Kind, e.URL, e.UsedAt)
+			}
+			fmt.Printf("Pruned %d cached item(s), %s.\n", len(removed), env.HumanSize(freed))
+
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown cache subcommand: %s\n", sub)
+			os.Exit(2)
+		}
+
+	case "store":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Error: missing subcommand for store (gc|verify)")
+			os.Exit(2)
+		}
+		sub := args[1]
+		_, flagArgs := splitArgs(args[2:])
+		flags := config.ParseFlags(flagArgs)
+		switch sub {
+		case "gc":
+			dry := flags["dry-run"] == "1"
+			res, err := store.GC(plugin.UsesStoreEntry, dry)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Store gc failed: %v\n", err)
+				os.Exit(1)
+			}
+			verb := "Removed"
+			if dry {
+				verb = "Would remove"
+			}
+			for _, h := range res.Trees {
+				fmt.Printf("%s tree %s\n", verb, h)
+			}
+			for _, h := range res.Archives {
+				fmt.Printf("%s archive %s\n", verb, h)
+			}
+			fmt.Printf("%s %d tree(s), %d archive(s), %s.\n", verb, len(res.Trees), len(res.Archives), env.HumanSize(res.Freed))
+
+		case "verify":
+			repair := flags["repair"] == "1"
+			res, err := store.Verify(repair)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Store verify failed: %v\n", err)
+				os.Exit(1)
+			}
+			for _, p := range res.Problems {
+				fmt.Printf("CORRUPT %s %s: %s\n", p.Kind, p.Hash, p.Reason)
+				for _, r := range p.Refs {
+					fmt.Printf("  used by %s in %s\n", r.Install, r.Env)
+				}
+			}
+			fmt.Printf("Checked %d tree(s), %d archive(s) in %s: %d problem(s).\n", res.Trees, res.Archives, store.Dir(), len(res.Problems))
+			if len(res.Problems) > 0 {
+				if repair {
+					fmt.Println("Corrupt entries removed; reinstall the affected plugins to restore them.")
+				} else {
+					fmt.Fprintln(os.Stderr, "Run `lyenv store verify --repair` to remove corrupt entries, then reinstall the affected plugins.")
+				}
+				os.Exit(1)
+			}
+
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown store subcommand: %s\n", sub)
+			os.Exit(2)
+		}
+
+	case "state":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Error: missing subcommand for state (list|get|set|unset)")
+			os.Exit(2)
+		}
+		sub := args[1]
+		pos, flagArgs := splitArgs(args[2:])
+		flags := config.ParseFlags(flagArgs)
+		pluginName := strings.TrimSpace(flags["plugin"])
+		switch sub {
+		case "list":
+			if len(pos) != 0 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv state list [--plugin=<NAME>] [--json]")
+				os.Exit(2)
+			}
+			if flags["json"] == "1" {
+				doc, err := state.Dump(envDir(), pluginName)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "State list failed: %v\n", err)
+					os.Exit(1)
+				}
+				out, _ := json.MarshalIndent(doc, "", "  ")
+				fmt.Println(string(out))
+				return
+			}
+			entries, err := state.List(envDir(), pluginName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "State list failed: %v\n", err)
+				os.Exit(1)
+			}
+			for _, e := range entries {
+				v, ok := e.Value.(string)
+				if !ok {
+					b, _ := json.Marshal(e.Value)
+					v = string(b)
+				}
+				fmt.Printf("%s = %s\n", e.Key, v)
+			}
+
+		case "get":
+			if len(pos) != 1 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv state get <KEY> [--plugin=<NAME>]")
+				os.Exit(2)
+			}
+			v, err := state.Get(envDir(), pluginName, strings.TrimSpace(pos[0]))
+			if err == nil {
+				var out string
+				if out, err = config.FormatValue(v); err == nil {
+					fmt.Print(out)
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "State get failed: %v\n", err)
+				os.Exit(1)
+			}
+
+		case "set":
+			if len(pos) != 2 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv state set <KEY> <VALUE> [--type=string|int|float|bool|json] [--plugin=<NAME>]")
+				os.Exit(2)
+			}
+			key := strings.TrimSpace(pos[0])
+			val, err := config.ParseWithType(pos[1], flags["type"])
+			if err == nil {
+				err = state.Set(envDir(), pluginName, key, val)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "State set failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("State updated: %s=%s\n", key, pos[1])
+
+		case "unset":
+			if len(pos) != 1 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv state unset <KEY> [--plugin=<NAME>]")
+				os.Exit(2)
+			}
+			key := strings.TrimSpace(pos[0])
+			if err := state.Unset(envDir(), pluginName, key); err != nil {
+				fmt.Fprintf(os.Stderr, "State unset failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("State key removed: %s\n", key)
+
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown state subcommand: %s\n", sub)
+			os.Exit(2)
+		}
+
 	case "plugin":
 		if len(args) < 2 {
 			fmt.Fprintln(os.Stderr, "Error: missing subcommand for plugin (install|list|info|remove)")
@@ -235,18 +1039,48 @@ func main() {
 			flags := config.ParseFlags(flagArgs)
 			overrideName := flags["name"]
 
-			if err := plugin.PluginAddLocal(".", path, overrideName); err != nil {
+			if err := plugin.PluginAddLocal(envDir(), path, overrideName); err != nil {
 				fmt.Fprintf(os.Stderr, "Plugin add failed: %v\n", err)
 				os.Exit(1)
 			}
 
 		case "install":
-			if len(args) < 3 {
+			pos, flagArgs := splitArgs(args[2:])
+			flags := config.ParseFlags(flagArgs)
+			if dir := flags["from-cache"]; dir != "" && dir != "1" {
+				specs := []plugin.FetchSpec{}
+				for _, a := range pos {
+					specs = append(specs, plugin.ParseFetchSpec(a))
+				}
+				if len(specs) == 1 && flags["ref"] != "" {
+					specs[0].Version = flags["ref"]
+				}
+				if len(specs) == 0 {
+					all, err := plugin.FetchedPlugins(dir)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Plugin install failed: %v\n", err)
+						os.Exit(1)
+					}
+					specs = all
+				}
+				if len(specs) > 1 && flags["name"] != "" {
+					fmt.Fprintln(os.Stderr, "Error: --name applies to a single plugin")
+					os.Exit(2)
+				}
+				for _, sp := range specs {
+					if err := plugin.PluginInstallFromCache(envDir(), dir, sp.Name, sp.Version, flags["name"]); err != nil {
+						fmt.Fprintf(os.Stderr, "Plugin install failed: %s: %v\n", sp.Name, err)
+						os.Exit(1)
+					}
+				}
+				return
+			}
+			if len(pos) < 1 {
 				fmt.Fprintln(os.Stderr, "Error: usage: lyenv plugin install <NAME|PATH> [--name=<INSTALL_NAME>] [--repo=<org/repo>] [--ref=<branch|tag|commit>] [--source=<url>] [--proxy=<url>]")
+				fmt.Fprintln(os.Stderr, "       lyenv plugin install [<NAME[@VERSION]>...] --from-cache=<DIR>")
 				os.Exit(2)
 			}
-			nameOrPath := strings.TrimSpace(args[2])
-			flags := config.ParseFlags(args[3:])
+			nameOrPath := strings.TrimSpace(pos[0])
 			repo := flags["repo"]
 			ref := flags["ref"]
 			source := flags["source"]
@@ -257,18 +1091,61 @@ func main() {
 				fmt.Fprintln(os.Stderr, "Error: <NAME|PATH> must not be empty")
 				os.Exit(2)
 			}
-			if err := plugin.PluginAdd(".", nameOrPath, source, repo, ref, proxy, overrideName); err != nil {
+			if err := plugin.PluginAdd(envDir(), nameOrPath, source, repo, ref, proxy, overrideName); err != nil {
 				fmt.Fprintf(os.Stderr, "Plugin install failed: %v\n", err)
 				os.Exit(1)
 			}
 
+		case "fetch":
+			pos, flagArgs := splitArgs(args[2:])
+			flags := config.ParseFlags(flagArgs)
+			dir := flags["dir"]
+			if dir == "" || dir == "1" {
+				dir = "lyenv-cache"
+			}
+			var specs []plugin.FetchSpec
+			if lock, ok := flags["from-lock"]; ok {
+				if len(pos) > 0 {
+					fmt.Fprintln(os.Stderr, "Error: give plugin names or --from-lock, not both")
+					os.Exit(2)
+				}
+				if lock == "1" {
+					lock = ""
+				}
+				var skipped []string
+				var err error
+				specs, skipped, err = plugin.LockSpecs(envDir(), lock)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Plugin fetch failed: %v\n", err)
+					os.Exit(1)
+				}
+				for _, s := range skipped {
+					fmt.Fprintf(os.Stderr, "Skipped %s: not installed from the plugin center\n", s)
+				}
+			} else {
+				for _, a := range pos {
+					specs = append(specs, plugin.ParseFetchSpec(a))
+				}
+			}
+			if len(specs) == 0 {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv plugin fetch <NAME[@VERSION]>... | --from-lock[=<FILE>] [--dir=<DIR>]")
+				os.Exit(2)
+			}
+			m, err := plugin.FetchToDir(envDir(), dir, specs)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Plugin fetch failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Cache directory: %s (%d plugin(s), %d archive(s), %d monorepo path(s))\n", dir, len(m.Plugins), len(m.Archives), len(m.Git))
+			fmt.Printf("Install with: lyenv plugin install --from-cache=%s\n", dir)
+
 		case "info":
 			if len(args) != 3 {
 				fmt.Fprintln(os.Stderr, "Error: usage: lyenv plugin info <INSTALL_NAME|LOGICAL_NAME>")
 				os.Exit(2)
 			}
 			input := strings.TrimSpace(args[2])
-			dir, installName, err := plugin.ResolvePluginDir(".", input) // you can expose resolve via exported func
+			dir, installName, err := plugin.ResolvePluginDir(envDir(), input) // you can expose resolve via exported func
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Plugin info failed: %v\n", err)
 				os.Exit(1)
@@ -286,11 +1163,28 @@ func main() {
 				}
 			}
 			if len(man.Expose) > 0 {
+				var owned []string
+				if rec, err := plugin.GetByInstallName(envDir(), installName); err == nil {
+					owned = rec.Shims
+				}
 				fmt.Println("Exposed shims:")
 				for _, s := range man.Expose {
-					fmt.Printf("  - %s\n", s)
+					if slices.Contains(owned, s) {
+						fmt.Printf("  - %s\n", s)
+					} else {
+						fmt.Printf("  - %s (provided by another install)\n", s)
+					}
 				}
 			}
+			if recs, err := plugin.FindByName(envDir(), man.Name); err == nil && len(recs) > 1 {
+				others := []string{}
+				for _, r := range recs {
+					if r.InstallName != installName {
+						others = append(others, r.InstallName)
+					}
+				}
+				fmt.Printf("Also installed as: %s\n", strings.Join(others, ", "))
+			}
 
 		case "remove":
 			if len(args) < 3 {
@@ -300,7 +1194,7 @@ func main() {
 			installName := strings.TrimSpace(args[2])
 			flags := config.ParseFlags(args[3:])
 			force := flags["force"] == "1"
-			if err := plugin.PluginRemove(".", installName, force); err != nil {
+			if err := plugin.PluginRemove(envDir(), installName, force); err != nil {
 				fmt.Fprintf(os.Stderr, "Plugin remove failed: %v\n", err)
 				os.Exit(1)
 			}
@@ -308,7 +1202,7 @@ func main() {
 
 		case "update":
 			if len(args) < 3 {
-				fmt.Fprintln(os.Stderr, "Error: usage: lyenv plugin update <INSTALL_NAME> [--repo=<org/repo>] [--ref=<branch|tag|commit>] [--source=<url>] [--proxy=<url>]")
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv plugin update <INSTALL_NAME|NAME> [--repo=<org/repo>] [--ref=<branch|tag|commit|version constraint>] [--source=<url>] [--proxy=<url>]")
 				os.Exit(2)
 			}
 			installName := strings.TrimSpace(args[2])
@@ -317,16 +1211,81 @@ func main() {
 			ref := flags["ref"]
 			source := flags["source"]
 			proxy := flags["proxy"]
-			if err := plugin.PluginUpdate(".", installName, repo, ref, source, proxy); err != nil {
+			autoSnapshot("before plugin update of " + installName)
+			updated, err := plugin.PluginUpdate(envDir(), installName, repo, ref, source, proxy)
+			if err != nil {
 				fmt.Fprintf(os.Stderr, "Plugin update failed: %v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("Plugin updated: %s\n", installName)
+			if updated {
+				fmt.Printf("Plugin updated: %s\n", installName)
+			}
+
+		case "outdated":
+			flags := config.ParseFlags(args[2:])
+			list, err := plugin.Outdated(envDir())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Plugin outdated failed: %v\n", err)
+				os.Exit(1)
+			}
+			if flags["json"] == "1" {
+				if list == nil {
+					list = []plugin.OutdatedPlugin{}
+				}
+				b, _ := json.MarshalIndent(list, "", "  ")
+				fmt.Println(string(b))
+				break
+			}
+			if len(list) == 0 {
+				fmt.Println("All plugin center installs are up to date.")
+				break
+			}
+			fmt.Printf("%-20s %-20s %-12s %-12s %-12s %s\n", "INSTALL", "NAME", "CURRENT", "WANTED", "LATEST", "CONSTRAINT")
+			for _, o := range list {
+				fmt.Printf("%-20s %-20s %-12s %-12s %-12s %s\n", o.InstallName, o.Name, o.Current, o.Wanted, o.Latest, o.Constraint)
+			}
+
+		case "upgrade":
+			pos, rest := splitArgs(args[2:])
+			flags := config.ParseFlags(rest)
+			all := flags["all"] == "1"
+			if all == (len(pos) > 0) {
+				fmt.Fprintln(os.Stderr, "Error: usage: lyenv plugin upgrade --all | <INSTALL_NAME>...")
+				os.Exit(2)
+			}
+			list, err := plugin.Outdated(envDir())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Plugin upgrade failed: %v\n", err)
+				os.Exit(1)
+			}
+			var todo []plugin.OutdatedPlugin
+			for _, o := range list {
+				if o.Upgradable() && (all || slices.Contains(pos, o.InstallName)) {
+					todo = append(todo, o)
+				}
+			}
+			if len(todo) == 0 {
+				fmt.Println("Nothing to upgrade.")
+				break
+			}
+			autoSnapshot("before plugin upgrade")
+			failed := 0
+			for _, o := range todo {
+				fmt.Printf("Upgrading %s: %s -> %s\n", o.InstallName, o.Current, o.Wanted)
+				if _, err := plugin.PluginUpdate(envDir(), o.InstallName, "", "", "", ""); err != nil {
+					fmt.Fprintf(os.Stderr, "Plugin upgrade of %s failed: %v\n", o.InstallName, err)
+					failed++
+				}
+			}
+			fmt.Printf("Upgraded %d of %d plugin(s).\n", len(todo)-failed, len(todo))
+			if failed > 0 {
+				os.Exit(1)
+			}
 
 		case "list":
 			flags := config.ParseFlags(args[2:])
 			wantJSON := flags["json"] == "1"
-			r, err := plugin.LoadRegistry(".")
+			r, err := plugin.LoadRegistry(envDir())
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Plugin list failed: %v\n", err)
 				os.Exit(1)
@@ -351,7 +1310,7 @@ func main() {
 				os.Exit(2)
 			}
 			kws := args[2:]
-			res, err := plugin.SearchCenterPlugins(".", kws)
+			res, err := plugin.SearchCenterPlugins(envDir(), kws)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Plugin search failed: %v\n", err)
 				os.Exit(1)
@@ -372,7 +1331,7 @@ func main() {
 			sub2 := args[2]
 			switch sub2 {
 			case "sync":
-				p, err := plugin.CenterSync(".")
+				p, err := plugin.CenterSync(envDir())
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "Center sync failed: %v\n", err)
 					os.Exit(1)
@@ -430,7 +1389,7 @@ func main() {
 		}
 
 		// Call plugin runtime with options
-		if err := plugin.RunPluginCommand(ctx, ".", pl, cmd, passArgs, strategy, keepGoing); err != nil {
+		if err := plugin.RunPluginCommand(ctx, envDir(), pl, cmd, passArgs, strategy, keepGoing); err != nil {
 			fmt.Fprintf(os.Stderr, "Run failed: %v\n", err)
 			os.Exit(1)
 		}
@@ -442,6 +1401,85 @@ func main() {
 	}
 }
 
+var (
+	envFlag     string
+	resolvedEnv string
+	command     string
+)
+
+// envDir returns the environment the command operates on, resolving it on
+// first use so commands that do not need one (create, init) never fail.
+// Environments written by a newer lyenv are refused.
+func envDir() string {
+	if resolvedEnv == "" {
+		dir, err := env.Resolve(envFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		behind, err := migrate.Check(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if behind > 0 && command != "migrate" && command != "doctor" {
+			fmt.Fprintln(os.Stderr, "Note: environment layout is outdated; run `lyenv migrate`")
+		}
+		resolvedEnv = dir
+	}
+	return resolvedEnv
+}
+
+func printMigrationSteps(steps []migrate.Step) {
+	for _, st := range steps {
+		fmt.Printf("Migrated layout %d -> %d (backup: %s)\n", st.From, st.To, st.Backup)
+		for _, m := range st.Migrations {
+			fmt.Printf("  - %s\n", m.Description)
+		}
+	}
+}
+
+// layerTarget maps a --layer flag to the config file a write should edit.
+func layerTarget(v string) string {
+	layer, err := config.ParseLayer(v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	target, err := config.ResolveWriteTarget(envDir(), "lyenv.yaml", layer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return target
+}
+
+// autoSnapshot saves the environment before a risky change and aborts the
+// command when that fails, since the change could not be undone.
+func autoSnapshot(reason string) {
+	s, err := snapshot.Auto(envDir(), reason)
+	if err != nil && s == nil {
+		fmt.Fprintf(os.Stderr, "Error: automatic snapshot failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	fmt.Printf("Snapshot saved: %s (undo with: lyenv snapshot restore %s)\n", s.Name, s.Name)
+}
+
+// splitArgs separates positional arguments from --flags.
+func splitArgs(args []string) (pos, flags []string) {
+	for _, a := range args {
+		if strings.HasPrefix(a, "--") {
+			flags = append(flags, a)
+		} else {
+			pos = append(pos, a)
+		}
+	}
+	return pos, flags
+}
+
 func indexOf(arr []string, needle string) int {
 	for i, a := range arr {
 		if a == needle {
@@ -2,4 +2,6 @@ module lyenv
 
 go 1.21.4
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/BurntSushi/toml v1.4.0
@@ -0,0 +1,231 @@
+// Package bundle packs an environment into a portable .tar.gz and recreates
+// it elsewhere.
+//
+// A bundle holds lyenv-bundle.yaml (the manifest) followed by environment
+// files at their relative paths: lyenv.yaml and its profile overlays,
+// .lyenv/registry/, plugins/<install>/ (without logs) and the selected
+// workspace paths. Logs, caches, bin/ and secrets are never included; shims
+// are regenerated on import.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"lyenv/internal/plugin"
+	"lyenv/internal/version"
+)
+
+// manifestName is the first entry of every bundle.
+const manifestName = "lyenv-bundle.yaml"
+
+// formatVersion is bumped on incompatible layout changes.
+const formatVersion = 1
+
+// Manifest describes a bundle.
+type Manifest struct {
+	Format    int      `yaml:"format"`
+	Lyenv     string   `yaml:"lyenv"`
+	CreatedAt string   `yaml:"created_at"`
+	Home      string   `yaml:"home"`                // absolute path of the exported environment
+	Workspace []string `yaml:"workspace,omitempty"` // exported workspace paths
+	Plugins   []Plugin `yaml:"plugins,omitempty"`
+}
+
+// Plugin records how one plugin travels in the bundle.
+type Plugin struct {
+	InstallName string `yaml:"install_name"`
+	Name        string `yaml:"name"`
+	Version     string `yaml:"version,omitempty"`
+	Center      string `yaml:"center,omitempty"` // plugin center name, for plugins installed from it
+	Included    bool   `yaml:"included"`         // tree packed in the bundle; otherwise reinstalled from the plugin center
+}
+
+// ExportOptions selects optional content.
+type ExportOptions struct {
+	SourcesOnly bool     // pack only plugin sources; center plugins are reinstalled on import
+	Workspace   []string // paths relative to workspace/ to include
+}
+
+// Export writes the environment at envDir to the gzip-compressed tar out.
+func Export(envDir, out string, opts ExportOptions) (*Manifest, error) {
+	home, err := filepath.Abs(envDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve environment directory: %w", err)
+	}
+	m := &Manifest{
+		Format:    formatVersion,
+		Lyenv:     version.Version,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Home:      home,
+	}
+	var files []string // relative, slash-separated
+
+	cfgs, err := filepath.Glob(filepath.Join(home, "lyenv*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cfgs {
+		files = append(files, filepath.Base(c))
+	}
+	reg, err := walkFiles(home, filepath.Join(".lyenv", "registry"))
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, reg...)
+
+	r, err := plugin.LoadRegistry(home)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range r.Plugins {
+		p := Plugin{InstallName: ip.InstallName, Name: ip.Name, Version: ip.Version, Center: ip.CenterName(), Included: true}
+		// Only plugins from the plugin center can be fetched again by name.
+		if opts.SourcesOnly && p.Center != "" {
+			p.Included = false
+		}
+		if p.Included {
+			tree, err := walkFiles(home, filepath.Join("plugins", ip.InstallName), "logs")
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, tree...)
+		}
+		m.Plugins = append(m.Plugins, p)
+	}
+
+	for _, w := range opts.Workspace {
+		rel, err := cleanRel(w)
+		if err != nil {
+			return nil, fmt.Errorf("invalid workspace path %q: %w", w, err)
+		}
+		tree, err := walkFiles(home, filepath.Join("workspace", filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		if len(tree) == 0 {
+			return nil, fmt.Errorf("workspace path not found: %s", w)
+		}
+		files = append(files, tree...)
+		m.Workspace = append(m.Workspace, rel)
+	}
+
+	if err := writeArchive(home, out, m, files); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// walkFiles lists regular files under home/rel (slash-separated, relative to
+// home), skipping direct children of rel named in skip. A missing rel yields
+// no files.
+func walkFiles(home, rel string, skip ...string) ([]string, error) {
+	root := filepath.Join(home, rel)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil, nil
+	}
+	var out []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && filepath.Dir(p) == root {
+			for _, s := range skip {
+				if d.Name() == s {
+					return filepath.SkipDir
+				}
+			}
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if st, err := os.Stat(p); err != nil || !st.Mode().IsRegular() {
+			return nil // dangling links and special files are not portable
+		}
+		r, err := filepath.Rel(home, p)
+		if err != nil {
+			return err
+		}
+		out = append(out, filepath.ToSlash(r))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", rel, err)
+	}
+	return out, nil
+}
+
+func writeArchive(home, out string, m *Manifest, files []string) (err error) {
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(out)
+		}
+	}()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0o644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	for _, rel := range files {
+		if err := addFile(tw, home, rel); err != nil {
+			return fmt.Errorf("failed to add %s: %w", rel, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addFile(tw *tar.Writer, home, rel string) error {
+	p := filepath.Join(home, filepath.FromSlash(rel))
+	st, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	hdr := &tar.Header{Name: rel, Mode: int64(st.Mode().Perm()), Size: st.Size(), ModTime: st.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, src)
+	return err
+}
+
+// cleanRel validates a bundle-relative path and returns it slash-separated.
+func cleanRel(p string) (string, error) {
+	c := path.Clean(filepath.ToSlash(strings.TrimSpace(p)))
+	if c == "." || c == "" || path.IsAbs(c) || c == ".." || strings.HasPrefix(c, "../") || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return "", fmt.Errorf("path must be relative and stay inside the environment")
+	}
+	return c, nil
+}
@@ -0,0 +1,199 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"lyenv/internal/env"
+	"lyenv/internal/plugin"
+)
+
+// ImportResult summarizes an import.
+type ImportResult struct {
+	Manifest    *Manifest
+	Home        string // absolute path of the new environment
+	Rewritten   int    // files in which the old environment path was replaced
+	Reinstalled int    // plugins fetched again from the plugin center
+}
+
+// Import recreates the bundle file as a new environment at dir. Absolute
+// paths of the exported environment are rewritten to the new location in
+// every text file, plugins packed as sources only are reinstalled and all
+// shims are regenerated.
+func Import(file, dir string) (*ImportResult, error) {
+	home, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve target path: %w", err)
+	}
+	if env.IsLyenvDir(home) {
+		return nil, fmt.Errorf("target directory already looks like a lyenv environment: %s", home)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, fmt.Errorf("invalid bundle: %s must be the first entry", manifestName)
+	}
+	data, err := io.ReadAll(io.LimitReader(tr, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", manifestName, err)
+	}
+	if m.Format < 1 || m.Format > formatVersion {
+		return nil, fmt.Errorf("unsupported bundle format %d (this lyenv reads up to %d)", m.Format, formatVersion)
+	}
+
+	fresh := true
+	if ents, err := os.ReadDir(home); err == nil && len(ents) > 0 {
+		fresh = false
+	}
+	if err := env.CmdCreate(home); err != nil {
+		return nil, err
+	}
+	res, err := populate(tr, &m, home)
+	if err != nil {
+		if fresh {
+			// The target was missing or empty, so nothing of the user's is lost.
+			_ = os.RemoveAll(home)
+			_, _ = env.Unregister(home)
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// populate extracts the bundle entries after the manifest into the freshly
+// created environment at home, reinstalls center plugins and writes shims.
+func populate(tr *tar.Reader, m *Manifest, home string) (*ImportResult, error) {
+	res := &ImportResult{Manifest: m, Home: home}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		rel, err := cleanRel(hdr.Name)
+		if err != nil || !allowedEntry(rel) {
+			return nil, fmt.Errorf("invalid bundle entry: %s", hdr.Name)
+		}
+		rewritten, err := extractFile(tr, hdr, filepath.Join(home, filepath.FromSlash(rel)), m.Home, home)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", rel, err)
+		}
+		if rewritten {
+			res.Rewritten++
+		}
+	}
+
+	for _, p := range m.Plugins {
+		if p.Included {
+			continue
+		}
+		center := p.Center
+		if center == "" {
+			center = p.Name // bundles written before center names were recorded
+		}
+		as := ""
+		if p.InstallName != center {
+			as = p.InstallName
+		}
+		// Reinstall the exported version, keeping the recorded constraint
+		// for later updates.
+		old, _ := plugin.GetByInstallName(home, p.InstallName)
+		if err := plugin.PluginAdd(home, center, "", "", p.Version, "", as); err != nil {
+			return nil, fmt.Errorf("failed to reinstall plugin %s: %w", p.InstallName, err)
+		}
+		if old != nil && old.Constraint != p.Version {
+			if rec, err := plugin.GetByInstallName(home, p.InstallName); err == nil {
+				rec.Constraint = old.Constraint
+				if err := plugin.RegisterInstall(home, *rec); err != nil {
+					return nil, err
+				}
+			}
+		}
+		res.Reinstalled++
+	}
+	r, err := plugin.LoadRegistry(home)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range r.Plugins {
+		pluginDir := filepath.Join(home, "plugins", ip.InstallName)
+		if _, err := plugin.LoadManifest(pluginDir); err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", ip.InstallName, err)
+		}
+		_ = plugin.EnsureLogsDir(pluginDir)
+		if err := plugin.CreateShims(home, ip.InstallName, ip.Shims); err != nil {
+			return nil, fmt.Errorf("failed to create shims for %s: %w", ip.InstallName, err)
+		}
+	}
+	return res, nil
+}
+
+// allowedEntry limits a bundle to the locations Export writes.
+func allowedEntry(rel string) bool {
+	if !strings.Contains(rel, "/") {
+		return strings.HasPrefix(rel, "lyenv") && path.Ext(rel) == ".yaml"
+	}
+	for _, prefix := range []string{".lyenv/registry/", "plugins/", "workspace/"} {
+		if strings.HasPrefix(rel, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractFile writes one entry, replacing oldHome with newHome in text
+// content; it reports whether a replacement happened.
+func extractFile(r io.Reader, hdr *tar.Header, dst, oldHome, newHome string) (bool, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return false, err
+	}
+	mode := os.FileMode(hdr.Mode).Perm() | 0o200
+	if hdr.Size > env.MaxRewrite || oldHome == "" || oldHome == newHome {
+		out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+		if err != nil {
+			return false, err
+		}
+		if _, err := io.Copy(out, r); err != nil {
+			out.Close()
+			return false, err
+		}
+		return false, out.Close()
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+	data, rewritten := env.RewritePath(data, oldHome, newHome)
+	if err := os.WriteFile(dst, data, mode); err != nil {
+		return false, err
+	}
+	return rewritten, os.Chmod(dst, mode)
+}
@@ -0,0 +1,306 @@
+// Package cache manages the environment download cache (path.cache, by
+// default <env>/cache): plugin archives, git checkouts and center indexes,
+// keyed by URL (and ref). It also decides whether lyenv runs offline.
+//
+// Layout:
+//
+//	<cache>/<kind>/<key>/meta.json   what was fetched, when, and when last used
+//	<cache>/<kind>/<key>/data[.ext]  downloads and indexes
+//	<cache>/<kind>/<key>/tree/       git checkouts
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"lyenv/internal/config"
+	"lyenv/internal/env"
+)
+
+// Cache kinds.
+const (
+	Downloads = "downloads"
+	Git       = "git"
+	Index     = "index"
+)
+
+// Kinds lists every cache kind.
+var Kinds = []string{Downloads, Git, Index}
+
+// Entry describes one cached item.
+type Entry struct {
+	Kind      string `json:"kind"`
+	URL       string `json:"url"`
+	Ref       string `json:"ref,omitempty"`
+	Sha256    string `json:"sha256,omitempty"` // of the data file (not for git)
+	Size      int64  `json:"size"`
+	FetchedAt string `json:"fetched_at"`
+	UsedAt    string `json:"used_at"`
+
+	Dir string `json:"-"`
+}
+
+// Data returns the cached file (downloads, indexes) or directory (git).
+func (e *Entry) Data() string {
+	if e.Kind == Git {
+		return filepath.Join(e.Dir, "tree")
+	}
+	return filepath.Join(e.Dir, "data"+dataExt(e.URL))
+}
+
+// dataExt keeps extensions tools and format detection rely on.
+func dataExt(url string) string {
+	u := strings.ToLower(url)
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip", ".json", ".yaml", ".yml"} {
+		if strings.HasSuffix(u, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// Dir returns the cache directory of an environment: path.cache from the
+// effective config (relative to the environment), else <env>/cache.
+func Dir(envDir string) string {
+	cfg, _ := config.LoadEffective(envDir)
+	p := strings.TrimSpace(config.GetString(cfg, "path.cache"))
+	if p == "" {
+		return filepath.Join(envDir, "cache")
+	}
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(envDir, p)
+}
+
+// Key derives the entry name for a URL and ref.
+func Key(url, ref string) string {
+	h := sha256.Sum256([]byte(url + "\x00" + ref))
+	return hex.EncodeToString(h[:16])
+}
+
+func entryDir(envDir, kind, url, ref string) string {
+	return filepath.Join(Dir(envDir), kind, Key(url, ref))
+}
+
+// Lookup returns the cached entry for url and ref and marks it used.
+func Lookup(envDir, kind, url, ref string) (*Entry, bool) {
+	e, err := load(entryDir(envDir, kind, url, ref))
+	if err != nil {
+		return nil, false
+	}
+	if _, err := os.Stat(e.Data()); err != nil {
+		return nil, false
+	}
+	e.UsedAt = now()
+	_ = save(e)
+	return e, true
+}
+
+// Put fetches a new entry: fill writes the file or directory at the path it
+// is given. The previous entry for url and ref, if any, is replaced only
+// when fill succeeds.
+func Put(envDir, kind, url, ref string, fill func(dst string) error) (*Entry, error) {
+	parent := filepath.Join(Dir(envDir), kind)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	tmp, err := os.MkdirTemp(parent, ".tmp-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	e := &Entry{Kind: kind, URL: url, Ref: ref, Dir: tmp, FetchedAt: now()}
+	e.UsedAt = e.FetchedAt
+	if err := fill(e.Data()); err != nil {
+		return nil, err
+	}
+	if kind != Git {
+		sum, err := fileSHA256(e.Data())
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash download: %w", err)
+		}
+		e.Sha256 = sum
+	}
+	e.Size = size(e.Data())
+	if err := save(e); err != nil {
+		return nil, err
+	}
+	dst := entryDir(envDir, kind, url, ref)
+	if err := os.RemoveAll(dst); err != nil {
+		return nil, fmt.Errorf("failed to replace cache entry: %w", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return nil, fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	e.Dir = dst
+	return e, nil
+}
+
+// List returns every cache entry, most recently used first.
+func List(envDir string) ([]*Entry, error) {
+	var out []*Entry
+	for _, kind := range Kinds {
+		ents, err := os.ReadDir(filepath.Join(Dir(envDir), kind))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache: %w", err)
+		}
+		for _, d := range ents {
+			if !d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+				continue
+			}
+			e, err := load(filepath.Join(Dir(envDir), kind, d.Name()))
+			if err != nil {
+				continue // half-written or foreign; `cache clean` still removes it
+			}
+			out = append(out, e)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].UsedAt > out[j].UsedAt })
+	return out, nil
+}
+
+// Clean removes all entries of kind, or the whole cache when kind is "".
+// It returns the number of entries removed and the bytes freed.
+func Clean(envDir, kind string) (int, int64, error) {
+	kinds := Kinds
+	if kind != "" {
+		if !validKind(kind) {
+			return 0, 0, fmt.Errorf("unknown cache kind: %s (expected %s)", kind, strings.Join(Kinds, "|"))
+		}
+		kinds = []string{kind}
+	}
+	n, freed := 0, int64(0)
+	for _, k := range kinds {
+		dir := filepath.Join(Dir(envDir), k)
+		ents, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return n, freed, fmt.Errorf("failed to read cache: %w", err)
+		}
+		for _, d := range ents {
+			p := filepath.Join(dir, d.Name())
+			freed += size(p)
+			if err := os.RemoveAll(p); err != nil {
+				return n, freed, fmt.Errorf("failed to remove cache entry: %w", err)
+			}
+			n++
+		}
+	}
+	return n, freed, nil
+}
+
+// Prune removes entries not used within maxAge and returns them.
+func Prune(envDir string, maxAge time.Duration) ([]*Entry, int64, error) {
+	list, err := List(envDir)
+	if err != nil {
+		return nil, 0, err
+	}
+	cutoff := time.Now().Add(-maxAge).UTC().Format(time.RFC3339)
+	var out []*Entry
+	var freed int64
+	for _, e := range list {
+		if e.UsedAt >= cutoff {
+			continue
+		}
+		freed += size(e.Dir)
+		if err := os.RemoveAll(e.Dir); err != nil {
+			return out, freed, fmt.Errorf("failed to remove cache entry: %w", err)
+		}
+		out = append(out, e)
+	}
+	return out, freed, nil
+}
+
+// ParseAge parses a --older-than value: a Go duration ("36h") or a number
+// of days ("30d").
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if d, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(d); err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age: %q (e.g. 30d, 12h)", s)
+	}
+	return d, nil
+}
+
+func validKind(k string) bool {
+	for _, x := range Kinds {
+		if x == k {
+			return true
+		}
+	}
+	return false
+}
+
+func load(dir string) (*Entry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "meta.json"))
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	e.Dir = dir
+	return e, nil
+}
+
+func save(e *Entry) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := env.WriteFileAtomic(filepath.Join(e.Dir, "meta.json"), append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+func now() string { return time.Now().UTC().Format(time.RFC3339) }
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func size(path string) int64 {
+	var n int64
+	_ = filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			n += fi.Size()
+		}
+		return nil
+	})
+	return n
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"lyenv/internal/config"
+)
+
+var forceOffline bool
+
+// SetOffline forces offline mode for this process (the global --offline flag).
+func SetOffline(v bool) { forceOffline = v }
+
+// Offline reports whether network access is disabled: by --offline,
+// LYENV_OFFLINE=1, or config.network.offline: true in the environment.
+func Offline(envDir string) bool {
+	if forceOffline {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("LYENV_OFFLINE"))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	if envDir == "" {
+		return false
+	}
+	cfg, _ := config.LoadEffective(envDir)
+	v, ok := config.GetByPath(cfg, "config.network.offline")
+	return ok && v == true
+}
+
+// Miss is the error for something offline mode cannot fetch.
+func Miss(what string) error {
+	return fmt.Errorf("offline: %s is not cached (run once online, or pre-fetch it)", what)
+}
@@ -9,27 +9,96 @@ func Usage() {
 	fmt.Fprintf(os.Stderr, `lyenv - Directory-based isolated environment manager
 
 Usage:
-  lyenv create <DIR>                 Create a new lyenv environment directory with default config and structure
-  lyenv init <DIR>                   Verify and repair an existing lyenv environment (idempotent)
-  lyenv activate                     Print shell snippet to activate the current lyenv (bash/zsh); eval "$(lyenv activate)"
+  lyenv [--env=<DIR>] [--profile=<NAME>] [--offline] <COMMAND> ...
+                                     Global: --env selects the environment (default $LYENV_HOME, then the nearest parent with lyenv.yaml)
+                                             --profile selects lyenv.<NAME>.yaml overlay (default $LYENV_PROFILE)
+                                             --offline resolves plugins only from cache/ and the synced center index ($LYENV_OFFLINE, config.network.offline)
 
-  lyenv config set <KEY> <VALUE> [--type=string|int|float|bool|json]
+  lyenv create <DIR> [--template=<NAME|PATH|URL>]
+                                     Create a new lyenv environment directory with default config and structure (or from a template)
+  lyenv init <DIR>                   Verify and repair an existing lyenv environment (idempotent); runs pending migrations
+  lyenv migrate [--dry-run]          Upgrade the environment's on-disk layout (backups under .lyenv/backups/)
+  lyenv activate [--shell=bash|zsh|fish|powershell|nu]
+                                     Print shell snippet to activate the current lyenv; bash/zsh: eval "$(lyenv activate)"
+                                     Exports env.vars and plugin activate.env/activate.path entries (shell auto-detected)
+  lyenv deactivate [--shell=...]     Print shell snippet restoring PATH, prompt and variables saved by activate
+  lyenv env list [--json]            List environments from the user index (active marker, plugins, disk usage)
+  lyenv env clone <SRC> <DST> [--profile=<NAME>] [--copy]
+                                     Fork an environment: config, registry and plugins (reflinks/hardlinks), new shims, no logs
+  lyenv env rm <NAME|DIR> [--yes] [--keep-files]
+                                     Delete an indexed environment after confirmation (--keep-files only forgets it)
+  lyenv env rename <NAME|DIR> <NEW_NAME>
+                                     Rename an environment in the index
+  lyenv env use <NAME> [--shell=...] Print the activation snippet for a named environment
+  lyenv template list                List the built-in and saved environment templates
+  lyenv template save <NAME|DIR> [--force]
+                                     Save the current environment (config, workspace skeleton, plugins) as a template
+  lyenv doctor [--fix] [--json]      Check registry, plugins, shims, interpreters, tools, permissions and config; --fix repairs what it can
+  lyenv export <FILE.tar.gz> [--sources-only] [--workspace=<PATH>[,<PATH>...]]
+                                     Pack config, registry, plugins (or only their sources) and workspace paths into a bundle
+  lyenv import <FILE> <DIR>          Recreate an exported environment at DIR, rewriting paths and regenerating shims
+  lyenv snapshot create [NAME]       Save config, registry, state, shims and plugins (deduplicated under .lyenv/snapshots/)
+  lyenv snapshot list                List snapshots, including automatic ones taken before plugin update and config load
+  lyenv snapshot restore <NAME>      Atomically restore a snapshot (the replaced state is kept as an automatic snapshot)
+  lyenv snapshot rm <NAME>           Delete a snapshot and unreferenced stored files
+  lyenv cache list [--json]          List cached downloads, git checkouts and center indexes (size, last use)
+  lyenv cache clean [downloads|git|index]
+                                     Empty the environment cache (or one kind of entry)
+  lyenv cache prune --older-than=<AGE>
+                                     Remove cache entries not used for AGE (e.g. 30d, 12h)
+  lyenv store gc [--dry-run]         Remove plugin trees and archives in the shared store no environment uses any more
+  lyenv store verify [--repair]      Re-hash stored plugin trees and archives; --repair deletes corrupt entries
+  lyenv shell [--shell=...]          Start a subshell with the environment applied (exit returns to the original shell)
+  lyenv exec -- <CMD> [ARGS...]      Run a command with the environment's PATH and variables; exit code and signals pass through
+  lyenv hook [bash|zsh|fish|powershell]
+                                     Print a prompt hook that auto-activates trusted environments on cd; bash: eval "$(lyenv hook bash)"
+  lyenv allow [<DIR>]                Trust an environment for auto-activation (default: current environment)
+  lyenv deny [<DIR>]                 Revoke auto-activation trust
+
+  lyenv config set <KEY> <VALUE> [--type=string|int|float|bool|json] [--layer=user|env|profile]
                                      Set a configuration value (dot path) with optional type enforcement
-  lyenv config get <KEY>             Get a configuration value (dot path)
-  lyenv config dump [<KEY>] <FILE>   Dump full config or a specific key to a file (YAML or JSON by extension)
-  lyenv config load <FILE> [--merge=override|append|keep]
-                                     Load and merge a YAML or JSON file into lyenv.yaml with a merge strategy
-  lyenv config importjson <FILE> <JSON_KEY> [--to=<CONFIG_KEY>] [--type=string|int|float|bool|json] [--merge=override|append|keep] [--input=1]
+  lyenv config get <KEY> [--show-origin] [--raw]
+                                     Get a value (dot path) from the effective config (user < env < profile); --raw keeps ${...} references
+  lyenv config unset <KEY> [--layer=user|env|profile]
+                                     Remove a configuration key (dot path)
+  lyenv config dump [<KEY>] <FILE> [--format=yaml|json|toml|dotenv|ini]
+                                     Dump full config or a specific key to a file (format by extension unless --format)
+  lyenv config load <FILE> [--merge=override|append|keep] [--format=...] [--layer=user|env|profile]
+                                     Load and merge a YAML/JSON/TOML/dotenv/INI file into lyenv.yaml with a merge strategy
+  lyenv config import <FILE> <KEY> [--to=<CONFIG_KEY>] [--format=...] [--type=...] [--merge=...] [--input=1] [--layer=...]
+                                     Import a value (dot path) from a file in any supported format into lyenv.yaml
+  lyenv config importjson <FILE> <JSON_KEY> [--to=<CONFIG_KEY>] [--type=string|int|float|bool|json] [--merge=override|append|keep] [--input=1] [--layer=...]
                                      Import a value from a JSON file (dot path) into lyenv.yaml
-  lyenv config importyaml <FILE> <YAML_KEY> [--to=<CONFIG_KEY>] [--type=string|int|float|bool|json] [--merge=override|append|keep] [--input=1]
+  lyenv config importyaml <FILE> <YAML_KEY> [--to=<CONFIG_KEY>] [--type=string|int|float|bool|json] [--merge=override|append|keep] [--input=1] [--layer=...]
                                      Import a value from a YAML file (dot path) into lyenv.yaml
+  lyenv config validate [--json]    Validate lyenv.yaml and plugin configs against their schemas (violations by dot path)
+
+  lyenv secret set <NAME> [<VALUE>]  Store an encrypted secret under .lyenv/secrets (value read from stdin when omitted)
+  lyenv secret get <NAME>            Print a decrypted secret
+  lyenv secret rm <NAME>             Remove a secret
+
+  lyenv state list [--plugin=<NAME>] [--json]
+                                     List environment state (or a plugin's state file) as dot paths
+  lyenv state get <KEY> [--plugin=<NAME>]
+                                     Read a state value; keys other than notes/created_at/initialized_at/components live under values
+  lyenv state set <KEY> <VALUE> [--type=string|int|float|bool|json] [--plugin=<NAME>]
+                                     Store a state value (atomic update)
+  lyenv state unset <KEY> [--plugin=<NAME>]
+                                     Remove a state value
 
   lyenv plugin add <PATH> [--name=<INSTALL_NAME>]
                                      Install a local plugin from a directory (manifest: YAML or JSON) under a custom install name
   lyenv plugin install <NAME|PATH> [--name=<INSTALL_NAME>] [--repo=<org/repo>] [--ref=<branch|tag|commit|version>] [--source=<url>] [--proxy=<url>]
                                      Install a plugin from local path, remote repo, source archive, or by NAME via plugin center
-  lyenv plugin update <INSTALL_NAME> [--repo=<org/repo>] [--ref=<branch|tag|commit|version>] [--source=<url>] [--proxy=<url>]
-                                     Update an installed plugin in place (monorepo subpath or repo/source overrides)
+  lyenv plugin install [<NAME[@VERSION]>...] --from-cache=<DIR> [--name=<INSTALL_NAME>]
+                                     Install plugins from a directory written by 'plugin fetch' (no network)
+  lyenv plugin fetch <NAME[@VERSION]>... | --from-lock[=<FILE>] [--dir=<DIR>]
+                                     Download plugins, their center index and checksums into DIR (default: lyenv-cache)
+  lyenv plugin update <INSTALL_NAME|NAME> [--repo=<org/repo>] [--ref=<branch|tag|commit|constraint>] [--source=<url>] [--proxy=<url>]
+                                     Update an installed plugin in place (center installs re-resolve within their version constraint)
+  lyenv plugin outdated [--json]     List plugin center installs with newer versions (current/wanted/latest)
+  lyenv plugin upgrade --all | <INSTALL_NAME>...
+                                     Update center installs to the newest version their constraint allows
   lyenv plugin list [--json]         List installed plugins (JSON for machine-readable output)
   lyenv plugin info <INSTALL_NAME|LOGICAL_NAME>
                                      Show plugin manifest details, resolved install directory and exposed shims
@@ -50,14 +119,18 @@ Defaults written by 'lyenv create':
       env: { name: "default", platform: "auto" }
       path: { bin: "./bin", cache: "./cache", workspace: "./workspace" }
       plugins:
-        installed: []
         registry_url: "https://raw.githubusercontent.com/systemnb/lyenv-plugin-center/main/index.yaml"
         registry_format: "yaml"
         default_version_strategy: "latest"
       config:
         use_container: false
         pkg_manager: "auto"
-        network: { proxy_url: "" }     # set proxy if needed
+
+Dot paths:
+  a.b.c  list[0]  list[-1] (last)  list[+] (append, writes)  "key.with.dots"  a\.b  *  [*] (wildcards, reads)
+
+References (resolved when read; files keep the reference):
+  ${env:NAME}  ${file:path}  ${secret:NAME}  $${...} (literal)
 
 Examples:
   lyenv create android-env
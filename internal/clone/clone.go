@@ -0,0 +1,298 @@
+// Package clone implements `lyenv env clone`: a new environment sharing the
+// config, registry and plugins of an existing one without reinstalling.
+package clone
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lyenv/internal/config"
+	"lyenv/internal/env"
+	"lyenv/internal/migrate"
+	"lyenv/internal/plugin"
+)
+
+// Options tunes a clone.
+type Options struct {
+	Profile string // merge lyenv.<Profile>.yaml into the clone's lyenv.yaml
+	Copy    bool   // always copy plugin files instead of reflinking or hardlinking
+}
+
+// Result summarizes a clone.
+type Result struct {
+	Home      string
+	Plugins   int
+	Reflinked int // plugin trees cloned copy-on-write
+	Linked    int // plugin files hardlinked to the source
+	Copied    int // plugin files copied
+	Rewritten int // files in which the source path was replaced
+}
+
+// Clone creates dst from the environment at src. Plugin trees are cloned
+// copy-on-write when the filesystem supports reflinks, else files are
+// hardlinked (plugin config and state files are always copied, and files that
+// mention the source path are rewritten into fresh copies); Options.Copy
+// forces plain copies. Logs, caches, snapshots and workspace/ are not
+// cloned, and shims are generated for the new location.
+func Clone(src, dst string, opts Options) (*Result, error) {
+	srcAbs, err := filepath.Abs(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve source path: %w", err)
+	}
+	home, err := filepath.Abs(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve target path: %w", err)
+	}
+	if !env.IsLyenvDir(srcAbs) {
+		return nil, fmt.Errorf("not a lyenv environment: %s", srcAbs)
+	}
+	if _, err := migrate.Check(srcAbs); err != nil {
+		return nil, err
+	}
+	if ents, err := os.ReadDir(home); err == nil && len(ents) > 0 {
+		return nil, fmt.Errorf("target directory is not empty: %s", home)
+	}
+	if opts.Profile != "" {
+		if err := config.ValidProfileName(opts.Profile); err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(filepath.Join(srcAbs, config.ProfileFile("lyenv.yaml", opts.Profile))); err != nil {
+			return nil, fmt.Errorf("profile not found in source: %s", config.ProfileFile("lyenv.yaml", opts.Profile))
+		}
+	}
+
+	if err := env.CmdCreate(home); err != nil {
+		return nil, err
+	}
+	res, err := populate(srcAbs, home, opts)
+	if err != nil {
+		// The target was empty before, so nothing of the user's is lost.
+		_ = os.RemoveAll(home)
+		_, _ = env.Unregister(home)
+		return nil, err
+	}
+	return res, nil
+}
+
+// populate fills a freshly created environment from the source.
+func populate(srcAbs, home string, opts Options) (*Result, error) {
+	res := &Result{Home: home}
+	rw := rewriter{old: srcAbs, new: home, res: res}
+
+	// Metadata and config are small and often mention the source path: copy.
+	files, _ := filepath.Glob(filepath.Join(srcAbs, "lyenv*.yaml"))
+	for _, f := range files {
+		if err := rw.copyFile(f, filepath.Join(home, filepath.Base(f))); err != nil {
+			return nil, err
+		}
+	}
+	for _, sub := range []string{filepath.Join(".lyenv", "registry"), filepath.Join(".lyenv", "secrets")} {
+		if err := copyTree(filepath.Join(srcAbs, sub), filepath.Join(home, sub), rw.copyFile); err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %w", filepath.ToSlash(sub), err)
+		}
+	}
+	if err := rw.copyFile(env.VersionFile(srcAbs), env.VersionFile(home)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	st, err := env.LoadState(srcAbs)
+	if err != nil {
+		return nil, err
+	}
+	st.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	st.InitializedAt = ""
+	if err := env.SaveState(home, st); err != nil {
+		return nil, err
+	}
+
+	ents, err := os.ReadDir(filepath.Join(srcAbs, "plugins"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read plugins: %w", err)
+	}
+	for _, e := range ents {
+		if !e.IsDir() {
+			continue
+		}
+		if err := clonePlugin(filepath.Join(srcAbs, "plugins", e.Name()), filepath.Join(home, "plugins", e.Name()), opts.Copy, &rw); err != nil {
+			return nil, fmt.Errorf("failed to clone plugin %s: %w", e.Name(), err)
+		}
+		res.Plugins++
+	}
+
+	if opts.Profile != "" {
+		overlay, err := config.LoadAny(filepath.Join(home, config.ProfileFile("lyenv.yaml", opts.Profile)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read profile: %w", err)
+		}
+		if err := config.ConfigMergeMap(home, "lyenv.yaml", overlay, config.MergeOverride); err != nil {
+			return nil, fmt.Errorf("failed to apply profile %s: %w", opts.Profile, err)
+		}
+	}
+
+	r, err := plugin.LoadRegistry(home)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range r.Plugins {
+		if _, err := plugin.LoadManifest(filepath.Join(home, "plugins", ip.InstallName)); err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", ip.InstallName, err)
+		}
+		if err := plugin.CreateShims(home, ip.InstallName, ip.Shims); err != nil {
+			return nil, fmt.Errorf("failed to create shims for %s: %w", ip.InstallName, err)
+		}
+	}
+	if err := plugin.AddStoreRefs(home); err != nil {
+		return nil, err
+	}
+	if _, err := migrate.Run(home); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// clonePlugin duplicates one plugin tree without its logs.
+func clonePlugin(src, dst string, copyOnly bool, rw *rewriter) error {
+	if !copyOnly && env.ReflinkTree(src, dst) {
+		rw.res.Reflinked++
+		if err := os.RemoveAll(filepath.Join(dst, "logs")); err != nil {
+			return err
+		}
+		if err := rw.rewriteTree(dst); err != nil {
+			return err
+		}
+		return plugin.EnsureLogsDir(dst)
+	}
+	// Files lyenv itself edits in place must not be shared with the source.
+	private := map[string]bool{}
+	if man, err := plugin.LoadManifest(src); err == nil {
+		for _, f := range []string{man.Config.LocalFile, man.Config.StateFile} {
+			if strings.TrimSpace(f) != "" {
+				private[filepath.Join(src, f)] = true
+			}
+		}
+	}
+	err := copyTree(src, dst, func(from, to string) error {
+		if rel, _ := filepath.Rel(src, from); strings.HasPrefix(filepath.ToSlash(rel), "logs/") {
+			return nil
+		}
+		if !copyOnly && !private[from] && !rw.mentionsOld(from) {
+			if err := os.Link(from, to); err == nil {
+				rw.res.Linked++
+				return nil
+			}
+		}
+		rw.res.Copied++
+		return rw.copyFile(from, to)
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(dst, "logs")); err != nil {
+		return err
+	}
+	return plugin.EnsureLogsDir(dst)
+}
+
+// copyTree walks src and recreates directories and symlinks under dst,
+// handing regular files to copyFn. A missing src is not an error.
+func copyTree(src, dst string, copyFn func(from, to string) error) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, fi.Mode().Perm()|0o700)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case fi.Mode().IsRegular():
+			return copyFn(p, target)
+		}
+		return nil
+	})
+}
+
+// rewriter replaces the source environment path in copied text files.
+type rewriter struct {
+	old, new string
+	res      *Result
+}
+
+// mentionsOld reports whether a small text file contains the source path.
+func (rw *rewriter) mentionsOld(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Size() > env.MaxRewrite {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	return err == nil && env.ContainsPath(data, rw.old)
+}
+
+// copyFile copies one file, rewriting the source path in text content.
+func (rw *rewriter) copyFile(from, to string) error {
+	fi, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	mode := fi.Mode().Perm()
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+	if rw.mentionsOld(from) {
+		data, err := os.ReadFile(from)
+		if err != nil {
+			return err
+		}
+		data, _ = env.RewritePath(data, rw.old, rw.new)
+		rw.res.Rewritten++
+		return env.WriteFileAtomic(to, data, mode)
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(to, mode)
+}
+
+// rewriteTree replaces the source path in place in an already cloned tree.
+func (rw *rewriter) rewriteTree(dir string) error {
+	return filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() || !rw.mentionsOld(p) {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		data, _ = env.RewritePath(data, rw.old, rw.new)
+		rw.res.Rewritten++
+		return env.WriteFileAtomic(p, data, fi.Mode().Perm())
+	})
+}
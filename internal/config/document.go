@@ -0,0 +1,432 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document holds a YAML file as a node tree so that edits keep comments,
+// key order, quoting style and anchors of everything they do not touch.
+type Document struct {
+	root *yaml.Node // always a DocumentNode wrapping a MappingNode
+}
+
+// LoadDocument reads a YAML file into a Document.
+func LoadDocument(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDocument(data)
+}
+
+// ParseDocument parses YAML bytes; an empty input yields an empty mapping.
+func ParseDocument(data []byte) (*Document, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if root.Kind == 0 {
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{newMapping()}}
+	}
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil, fmt.Errorf("unexpected YAML document structure")
+	}
+	body := root.Content[0]
+	if body.Kind == yaml.ScalarNode && body.Tag == "!!null" {
+		root.Content[0] = newMapping()
+	} else if body.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("YAML root must be a mapping")
+	}
+	return &Document{root: &root}, nil
+}
+
+// Bytes renders the document with two-space indentation (the layout written by 'lyenv create').
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d.root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Save writes the document to path.
+func (d *Document) Save(path string) error {
+	out, err := d.Bytes()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0o644)
+}
+
+// Map decodes the document into plain Go values (aliases and merge keys resolved).
+func (d *Document) Map() (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := d.root.Decode(&m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+	return m, nil
+}
+
+// Get reads a value by dot path from the decoded document.
+func (d *Document) Get(path string) (interface{}, bool) {
+	m, err := d.Map()
+	if err != nil {
+		return nil, false
+	}
+	return GetByPath(m, path)
+}
+
+// Set writes val at path (see ParsePath). Missing intermediates are created;
+// traversing a scalar is an error. When a scalar replaces a scalar, the old
+// node's quoting style and comments are carried over.
+func (d *Document) Set(path string, val interface{}) error {
+	nv, err := valueNode(val)
+	if err != nil {
+		return err
+	}
+	slot, err := d.locate(path, true)
+	if err != nil {
+		return err
+	}
+	if old := slot.get(); old != nil {
+		nv = replaceNode(old, nv)
+	}
+	slot.put(nv)
+	return nil
+}
+
+// Unset removes the entry at path and reports whether it existed.
+func (d *Document) Unset(path string) (bool, error) {
+	slot, err := d.locate(path, false)
+	if err != nil {
+		if err == errPathNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if slot.get() == nil {
+		return false, nil
+	}
+	slot.remove()
+	return true, nil
+}
+
+// Merge deep-merges overlay into the document following the same rules as MergeMapWithStrategy.
+func (d *Document) Merge(overlay map[string]interface{}, strategy MergeStrategy) error {
+	if len(overlay) == 0 {
+		return nil
+	}
+	on, err := valueNode(overlay)
+	if err != nil {
+		return err
+	}
+	mergeNodes(d.body(), on, strategy)
+	return nil
+}
+
+// MergeAt merges val into the value at path: maps deep-merge, arrays follow
+// the strategy (append concatenates, keep leaves base), scalars or mismatched
+// types are replaced unless strategy is keep. A missing key is simply set.
+func (d *Document) MergeAt(path string, val interface{}, strategy MergeStrategy) error {
+	nv, err := valueNode(val)
+	if err != nil {
+		return err
+	}
+	slot, err := d.locate(path, true)
+	if err != nil {
+		return err
+	}
+	if old := slot.get(); old != nil {
+		nv = mergeValue(old, nv, strategy)
+	}
+	slot.put(nv)
+	return nil
+}
+
+var errPathNotFound = fmt.Errorf("path not found")
+
+// nodeSlot addresses one value position inside a mapping or sequence node.
+type nodeSlot struct {
+	parent *yaml.Node
+	key    string // mapping key (used when appending)
+	pos    int    // index of the value in parent.Content; -1 when absent
+}
+
+func (s *nodeSlot) get() *yaml.Node {
+	if s.pos < 0 {
+		return nil
+	}
+	return s.parent.Content[s.pos]
+}
+
+func (s *nodeSlot) put(n *yaml.Node) {
+	if s.pos >= 0 {
+		s.parent.Content[s.pos] = n
+		return
+	}
+	if s.parent.Kind == yaml.MappingNode {
+		s.parent.Content = append(s.parent.Content, keyNode(s.key), n)
+	} else {
+		s.parent.Content = append(s.parent.Content, n)
+	}
+	s.pos = len(s.parent.Content) - 1
+}
+
+func (s *nodeSlot) remove() {
+	c := s.parent.Content
+	if s.parent.Kind == yaml.MappingNode {
+		s.parent.Content = append(c[:s.pos-1:s.pos-1], c[s.pos+1:]...)
+	} else {
+		s.parent.Content = append(c[:s.pos:s.pos], c[s.pos+1:]...)
+	}
+	s.pos = -1
+}
+
+// locate walks path to the slot holding its last segment. With create set,
+// missing intermediates become mappings (or sequences before an index).
+func (d *Document) locate(path string, create bool) (*nodeSlot, error) {
+	segs, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if hasWildcard(segs) {
+		return nil, fmt.Errorf("wildcards are only allowed when reading: %s", path)
+	}
+	cur := d.body()
+	for i, seg := range segs {
+		slot, err := childSlot(cur, seg, segs[:i])
+		if err != nil {
+			return nil, err
+		}
+		if i == len(segs)-1 {
+			return slot, nil
+		}
+		child := slot.get()
+		if child != nil && child.Kind == yaml.ScalarNode && child.Tag == "!!null" {
+			child = nil
+		}
+		if child == nil {
+			if !create {
+				return nil, errPathNotFound
+			}
+			child = replaceNode(slot.get(), containerFor(segs[i+1]))
+		} else {
+			child = materialize(child)
+			if child.Kind != yaml.MappingNode && child.Kind != yaml.SequenceNode {
+				return nil, fmt.Errorf("cannot traverse scalar at %s", FormatPath(segs[:i+1]))
+			}
+		}
+		slot.put(child)
+		cur = child
+	}
+	return nil, errPathNotFound
+}
+
+func childSlot(cur *yaml.Node, seg PathSeg, done []PathSeg) (*nodeSlot, error) {
+	switch cur.Kind {
+	case yaml.MappingNode:
+		if seg.Kind != SegKey {
+			return nil, fmt.Errorf("cannot use %s on a map at %s", FormatPath([]PathSeg{seg}), pathOrRoot(done))
+		}
+		pos := mappingIndex(cur, seg.Key)
+		if pos >= 0 {
+			pos++
+		}
+		return &nodeSlot{parent: cur, key: seg.Key, pos: pos}, nil
+	case yaml.SequenceNode:
+		switch seg.Kind {
+		case SegAppend:
+			return &nodeSlot{parent: cur, pos: -1}, nil
+		case SegIndex:
+			idx, ok := resolveIndex(seg.Index, len(cur.Content))
+			if !ok {
+				return nil, fmt.Errorf("index %d out of range (len %d) at %s", seg.Index, len(cur.Content), pathOrRoot(done))
+			}
+			return &nodeSlot{parent: cur, pos: idx}, nil
+		default:
+			return nil, fmt.Errorf("cannot use key %q on a list at %s", seg.Key, pathOrRoot(done))
+		}
+	}
+	return nil, fmt.Errorf("cannot traverse scalar at %s", pathOrRoot(done))
+}
+
+func containerFor(next PathSeg) *yaml.Node {
+	if next.Kind == SegIndex || next.Kind == SegAppend {
+		return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+	return newMapping()
+}
+
+func (d *Document) body() *yaml.Node {
+	return d.root.Content[0]
+}
+
+// mergeNodes merges overlay mapping entries into base mapping in place.
+func mergeNodes(base, overlay *yaml.Node, strategy MergeStrategy) {
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		k, ov := overlay.Content[i], overlay.Content[i+1]
+		idx := mappingIndex(base, k.Value)
+		if idx < 0 {
+			base.Content = append(base.Content, k, ov)
+			continue
+		}
+		if strategy == MergeKeep {
+			continue
+		}
+		base.Content[idx+1] = mergeValue(base.Content[idx+1], ov, strategy)
+	}
+}
+
+// mergeValue combines an existing value with an overlay value and returns the result.
+func mergeValue(bv, ov *yaml.Node, strategy MergeStrategy) *yaml.Node {
+	if strategy == MergeKeep {
+		if bv.Kind == yaml.MappingNode && ov.Kind == yaml.MappingNode {
+			mergeNodes(bv, ov, strategy)
+		}
+		return bv
+	}
+	bv = materialize(bv)
+	if bv.Kind == yaml.MappingNode && ov.Kind == yaml.MappingNode {
+		mergeNodes(bv, ov, strategy)
+		return bv
+	}
+	if strategy == MergeAppend && bv.Kind == yaml.SequenceNode && ov.Kind == yaml.SequenceNode {
+		bv.Content = append(bv.Content, ov.Content...)
+		return bv
+	}
+	return replaceNode(bv, ov)
+}
+
+// mappingIndex returns the index of key k in mapping n, or -1.
+func mappingIndex(n *yaml.Node, k string) int {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == k {
+			return i
+		}
+	}
+	return -1
+}
+
+// materialize replaces an alias with a private copy of its target so that
+// edits below it do not leak into the anchored node.
+func materialize(n *yaml.Node) *yaml.Node {
+	if n.Kind != yaml.AliasNode || n.Alias == nil {
+		return n
+	}
+	cp := deepCopy(n.Alias)
+	cp.Anchor = ""
+	cp.HeadComment, cp.LineComment, cp.FootComment = n.HeadComment, n.LineComment, n.FootComment
+	return cp
+}
+
+func deepCopy(n *yaml.Node) *yaml.Node {
+	if n == nil {
+		return nil
+	}
+	cp := *n
+	if len(n.Content) > 0 {
+		cp.Content = make([]*yaml.Node, len(n.Content))
+		for i, c := range n.Content {
+			cp.Content[i] = deepCopy(c)
+		}
+	}
+	return &cp
+}
+
+// replaceNode returns nv carrying over comments (and, for scalar-to-string
+// replacements, the quoting style) from old.
+func replaceNode(old, nv *yaml.Node) *yaml.Node {
+	if old == nil {
+		return nv
+	}
+	if old.Kind == yaml.ScalarNode && nv.Kind == yaml.ScalarNode && nv.Tag == "!!str" && old.Style != 0 {
+		nv.Style = old.Style
+	}
+	if nv.HeadComment == "" {
+		nv.HeadComment = old.HeadComment
+	}
+	if nv.LineComment == "" {
+		nv.LineComment = old.LineComment
+	}
+	if nv.FootComment == "" {
+		nv.FootComment = old.FootComment
+	}
+	if old.Anchor != "" && nv.Anchor == "" && nv.Kind != yaml.AliasNode {
+		nv.Anchor = old.Anchor
+	}
+	return nv
+}
+
+func valueNode(v interface{}) (*yaml.Node, error) {
+	var n yaml.Node
+	if err := n.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode value: %w", err)
+	}
+	return &n, nil
+}
+
+func keyNode(k string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}
+}
+
+func newMapping() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
+
+// MergeFile merges overlay into a config file in place, keeping its format.
+// YAML files are edited as a Document (comments and order preserved); other
+// formats are decoded to maps and re-encoded.
+// When check is non-nil it receives the merged content and may veto the write.
+func MergeFile(path string, overlay map[string]interface{}, strategy MergeStrategy, check func(map[string]interface{}) error) error {
+	if DetectFormat(path).Name == "yaml" {
+		doc, err := LoadDocument(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+			doc, _ = ParseDocument(nil)
+		}
+		if err := doc.Merge(overlay, strategy); err != nil {
+			return err
+		}
+		if check != nil {
+			m, err := doc.Map()
+			if err != nil {
+				return err
+			}
+			if err := check(m); err != nil {
+				return err
+			}
+		}
+		return doc.Save(path)
+	}
+	base, err := LoadAny(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		base = make(map[string]interface{})
+	}
+	merged := MergeMapWithStrategy(base, overlay, strategy)
+	if check != nil {
+		if err := check(merged); err != nil {
+			return err
+		}
+	}
+	return SaveAny(path, merged)
+}
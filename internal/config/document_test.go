@@ -0,0 +1,165 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleDoc = `# environment config
+env:
+  name: "demo" # keep quotes
+  vars:
+    A: '1'
+list:
+  - a
+  - b
+  - c
+servers:
+  - host: h1
+    port: 1
+base: &base
+  x: 1
+derived:
+  <<: *base
+  y: 2
+`
+
+func parseSample(t *testing.T) *Document {
+	t.Helper()
+	d, err := ParseDocument([]byte(sampleDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func docString(t *testing.T, d *Document) string {
+	t.Helper()
+	out, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestDocumentSet(t *testing.T) {
+	cases := []struct {
+		path string
+		val  interface{}
+		want []string // substrings of the rendered document
+		err  string
+	}{
+		{path: "env.name", val: "prod", want: []string{`name: "prod" # keep quotes`, "# environment config"}},
+		{path: "env.vars.A", val: "2", want: []string{"A: '2'"}},
+		{path: "env.vars.B", val: "b", want: []string{"A: '1'\n    B: b"}},
+		{path: "list[-1]", val: "z", want: []string{"- b\n  - z\n"}},
+		{path: "list[+]", val: "d", want: []string{"- c\n  - d\n"}},
+		{path: "servers[0].port", val: 8080, want: []string{"port: 8080"}},
+		{path: "servers[+].host", val: "h2", want: []string{"- host: h2"}},
+		{path: "new.items[+]", val: "x", want: []string{"new:\n  items:\n    - x"}},
+		{path: `"a.b".c`, val: true, want: []string{"a.b:\n  c: true"}},
+		{path: "derived.y", val: 3, want: []string{"<<: *base\n  y: 3", "base: &base"}},
+		{path: "env.name.first", err: "cannot traverse scalar at env.name"},
+		{path: "servers[0].host.x", err: "cannot traverse scalar at servers[0].host"},
+		{path: "list[3]", err: "index 3 out of range (len 3) at list"},
+		{path: "list[-4]", err: "index -4 out of range (len 3) at list"},
+		{path: "list.x", err: `cannot use key "x" on a list at list`},
+		{path: "env[0]", err: "cannot use [0] on a map at env"},
+		{path: "env.*", err: "wildcards are only allowed when reading"},
+		{path: "env..name", err: "empty key"},
+	}
+	for _, tc := range cases {
+		d := parseSample(t)
+		err := d.Set(tc.path, tc.val)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Set(%q) error = %v, want %q", tc.path, err, tc.err)
+			}
+			if got := docString(t, d); got != docString(t, parseSample(t)) {
+				t.Errorf("Set(%q) failed but changed the document:\n%s", tc.path, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q): %v", tc.path, err)
+			continue
+		}
+		out := docString(t, d)
+		for _, w := range tc.want {
+			if !strings.Contains(out, w) {
+				t.Errorf("Set(%q): output lacks %q:\n%s", tc.path, w, out)
+			}
+		}
+		// The decoded view agrees with the edit.
+		get := strings.ReplaceAll(tc.path, "[+]", "[-1]")
+		if got, ok := d.Get(get); !ok || got != tc.val {
+			t.Errorf("Set(%q): Get(%q) = %v, %v", tc.path, get, got, ok)
+		}
+	}
+}
+
+func TestDocumentUnset(t *testing.T) {
+	cases := []struct {
+		path    string
+		removed bool
+		lacks   string
+		err     string
+	}{
+		{path: "env.vars.A", removed: true, lacks: "A: '1'"},
+		{path: "list[0]", removed: true, lacks: "- a\n"},
+		{path: "list[-1]", removed: true, lacks: "- c\n"},
+		{path: "servers[0].port", removed: true, lacks: "port: 1"},
+		{path: "missing", removed: false},
+		{path: "missing.deeper", removed: false},
+		{path: "list[9]", err: "index 9 out of range"},
+		{path: "env.name.x", err: "cannot traverse scalar at env.name"},
+		{path: "env.*", err: "wildcards are only allowed when reading"},
+	}
+	for _, tc := range cases {
+		d := parseSample(t)
+		removed, err := d.Unset(tc.path)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Unset(%q) error = %v, want %q", tc.path, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || removed != tc.removed {
+			t.Errorf("Unset(%q) = %v, %v; want %v", tc.path, removed, err, tc.removed)
+			continue
+		}
+		out := docString(t, d)
+		if tc.lacks != "" && strings.Contains(out, tc.lacks) {
+			t.Errorf("Unset(%q): output still has %q:\n%s", tc.path, tc.lacks, out)
+		}
+		if !removed && out != docString(t, parseSample(t)) {
+			t.Errorf("Unset(%q) removed nothing but changed the document:\n%s", tc.path, out)
+		}
+		if !strings.Contains(out, "# environment config") {
+			t.Errorf("Unset(%q) lost the head comment", tc.path)
+		}
+	}
+}
+
+func TestDocumentGetResolvesMergeKeys(t *testing.T) {
+	d := parseSample(t)
+	if got, ok := d.Get("derived.x"); !ok || got != 1 {
+		t.Errorf("derived.x = %v, %v; want 1 from the merge key", got, ok)
+	}
+}
+
+func TestParseDocumentRoot(t *testing.T) {
+	for _, in := range []string{"", "~\n", "# only a comment\n"} {
+		d, err := ParseDocument([]byte(in))
+		if err != nil {
+			t.Errorf("ParseDocument(%q): %v", in, err)
+			continue
+		}
+		if err := d.Set("a", 1); err != nil {
+			t.Errorf("Set on %q: %v", in, err)
+		}
+	}
+	if _, err := ParseDocument([]byte("- a\n")); err == nil || !strings.Contains(err.Error(), "root must be a mapping") {
+		t.Errorf("sequence root: %v", err)
+	}
+}
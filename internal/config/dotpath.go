@@ -1,37 +1,409 @@
 package config
 
-import "strings"
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
 
+// Path grammar (used by config get/set/unset/import and plugin mutations):
+//
+//	path    = segment { "." segment | index }
+//	segment = bare | '"' quoted '"' | "'" quoted "'" | "*"
+//	index   = "[" ( integer | "+" | "*" | quoted ) "]"
+//
+// Bare keys may escape '.', '[', ']' and '\' with a backslash. Negative
+// indices count from the end, "[+]" appends (writes only) and "*" / "[*]"
+// match every key or element (reads only).
+type SegKind int
+
+const (
+	SegKey      SegKind = iota // map key
+	SegIndex                   // list index (may be negative)
+	SegAppend                  // "[+]"
+	SegWildcard                // "*" or "[*]"
+)
+
+// PathSeg is one parsed path segment.
+type PathSeg struct {
+	Kind  SegKind
+	Key   string
+	Index int
+}
+
+// ParsePath parses a dot path into segments.
+func ParsePath(path string) ([]PathSeg, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	var segs []PathSeg
+	i, n := 0, len(path)
+	expectKey := true
+	for i < n {
+		c := path[i]
+		switch {
+		case c == '[':
+			end, seg, err := parseBracket(path, i)
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, seg)
+			i = end
+			expectKey = false
+		case c == '.':
+			if expectKey {
+				return nil, fmt.Errorf("invalid path %q: empty key at offset %d", path, i)
+			}
+			i++
+			expectKey = true
+			if i == n {
+				return nil, fmt.Errorf("invalid path %q: trailing '.'", path)
+			}
+		case c == '"' || c == '\'':
+			if !expectKey {
+				return nil, fmt.Errorf("invalid path %q: missing '.' before offset %d", path, i)
+			}
+			key, end, err := parseQuoted(path, i)
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, PathSeg{Kind: SegKey, Key: key})
+			i = end
+			expectKey = false
+		default:
+			if !expectKey {
+				return nil, fmt.Errorf("invalid path %q: missing '.' before offset %d", path, i)
+			}
+			var b strings.Builder
+			for i < n && path[i] != '.' && path[i] != '[' {
+				if path[i] == ']' {
+					return nil, fmt.Errorf("invalid path %q: unexpected ']' at offset %d", path, i)
+				}
+				if path[i] == '\\' && i+1 < n {
+					i++
+				}
+				b.WriteByte(path[i])
+				i++
+			}
+			if b.String() == "*" {
+				segs = append(segs, PathSeg{Kind: SegWildcard})
+			} else {
+				segs = append(segs, PathSeg{Kind: SegKey, Key: b.String()})
+			}
+			expectKey = false
+		}
+	}
+	return segs, nil
+}
+
+func parseBracket(path string, start int) (int, PathSeg, error) {
+	i := start + 1
+	if i < len(path) && (path[i] == '"' || path[i] == '\'') {
+		key, end, err := parseQuoted(path, i)
+		if err != nil {
+			return 0, PathSeg{}, err
+		}
+		if end >= len(path) || path[end] != ']' {
+			return 0, PathSeg{}, fmt.Errorf("invalid path %q: missing ']' at offset %d", path, end)
+		}
+		return end + 1, PathSeg{Kind: SegKey, Key: key}, nil
+	}
+	close := strings.IndexByte(path[i:], ']')
+	if close < 0 {
+		return 0, PathSeg{}, fmt.Errorf("invalid path %q: unterminated '[' at offset %d", path, start)
+	}
+	body := strings.TrimSpace(path[i : i+close])
+	end := i + close + 1
+	switch body {
+	case "+":
+		return end, PathSeg{Kind: SegAppend}, nil
+	case "*":
+		return end, PathSeg{Kind: SegWildcard}, nil
+	}
+	idx, err := strconv.Atoi(body)
+	if err != nil {
+		return 0, PathSeg{}, fmt.Errorf("invalid path %q: bad index [%s]", path, body)
+	}
+	return end, PathSeg{Kind: SegIndex, Index: idx}, nil
+}
+
+func parseQuoted(path string, start int) (string, int, error) {
+	q := path[start]
+	var b strings.Builder
+	for i := start + 1; i < len(path); i++ {
+		c := path[i]
+		if c == '\\' && q == '"' && i+1 < len(path) {
+			i++
+			b.WriteByte(path[i])
+			continue
+		}
+		if c == q {
+			return b.String(), i + 1, nil
+		}
+		b.WriteByte(c)
+	}
+	return "", 0, fmt.Errorf("invalid path %q: unterminated quote at offset %d", path, start)
+}
+
+// FormatPath renders segments back into canonical path syntax.
+func FormatPath(segs []PathSeg) string {
+	var b strings.Builder
+	for i, s := range segs {
+		switch s.Kind {
+		case SegKey:
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			if s.Key == "" || s.Key == "*" || strings.ContainsAny(s.Key, ".[]\"'\\") {
+				b.WriteString(strconv.Quote(s.Key))
+			} else {
+				b.WriteString(s.Key)
+			}
+		case SegIndex:
+			b.WriteString("[" + strconv.Itoa(s.Index) + "]")
+		case SegAppend:
+			b.WriteString("[+]")
+		case SegWildcard:
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString("*")
+		}
+	}
+	return b.String()
+}
+
+// resolveIndex turns a possibly negative index into an offset in [0,n).
+func resolveIndex(idx, n int) (int, bool) {
+	if idx < 0 {
+		idx += n
+	}
+	return idx, idx >= 0 && idx < n
+}
+
+func hasWildcard(segs []PathSeg) bool {
+	for _, s := range segs {
+		if s.Kind == SegWildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// GetByPath reads a single value. Invalid paths, wildcards and missing
+// entries all report false.
 func GetByPath(m map[string]interface{}, path string) (interface{}, bool) {
-	parts := strings.Split(path, ".")
+	segs, err := ParsePath(path)
+	if err != nil || hasWildcard(segs) {
+		return nil, false
+	}
 	var cur interface{} = m
-	for _, p := range parts {
-		obj, ok := cur.(map[string]interface{})
-		if !ok {
-			return nil, false
-		}
-		val, exists := obj[p]
-		if !exists {
+	for _, s := range segs {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			if s.Kind != SegKey {
+				return nil, false
+			}
+			v, ok := node[s.Key]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []interface{}:
+			if s.Kind != SegIndex {
+				return nil, false
+			}
+			i, ok := resolveIndex(s.Index, len(node))
+			if !ok {
+				return nil, false
+			}
+			cur = node[i]
+		default:
 			return nil, false
 		}
-		cur = val
 	}
 	return cur, true
 }
 
-func SetByPath(m map[string]interface{}, path string, val interface{}) {
-	parts := strings.Split(path, ".")
-	cur := m
-	for i, p := range parts {
-		if i == len(parts)-1 {
-			cur[p] = val
+// PathMatch is one result of a wildcard lookup.
+type PathMatch struct {
+	Path  string
+	Value interface{}
+}
+
+// GetAllByPath expands wildcards and returns every match in a stable order.
+func GetAllByPath(m map[string]interface{}, path string) ([]PathMatch, error) {
+	segs, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []PathMatch
+	var walk func(cur interface{}, rest []PathSeg, done []PathSeg)
+	walk = func(cur interface{}, rest []PathSeg, done []PathSeg) {
+		if len(rest) == 0 {
+			out = append(out, PathMatch{Path: FormatPath(done), Value: cur})
 			return
 		}
-		next, ok := cur[p].(map[string]interface{})
+		s := rest[0]
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			switch s.Kind {
+			case SegKey:
+				if v, ok := node[s.Key]; ok {
+					walk(v, rest[1:], appendSeg(done, s))
+				}
+			case SegWildcard:
+				keys := make([]string, 0, len(node))
+				for k := range node {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					walk(node[k], rest[1:], appendSeg(done, PathSeg{Kind: SegKey, Key: k}))
+				}
+			}
+		case []interface{}:
+			switch s.Kind {
+			case SegIndex:
+				if i, ok := resolveIndex(s.Index, len(node)); ok {
+					walk(node[i], rest[1:], appendSeg(done, PathSeg{Kind: SegIndex, Index: i}))
+				}
+			case SegWildcard:
+				for i, v := range node {
+					walk(v, rest[1:], appendSeg(done, PathSeg{Kind: SegIndex, Index: i}))
+				}
+			}
+		}
+	}
+	walk(m, segs, nil)
+	return out, nil
+}
+
+func appendSeg(done []PathSeg, s PathSeg) []PathSeg {
+	out := make([]PathSeg, len(done), len(done)+1)
+	copy(out, done)
+	return append(out, s)
+}
+
+// SetByPath writes val at path, creating missing maps (or lists before an
+// index/append segment). It fails when the path traverses a scalar, indexes
+// past the end of a list or uses a wildcard.
+func SetByPath(m map[string]interface{}, path string, val interface{}) error {
+	segs, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+	if hasWildcard(segs) {
+		return fmt.Errorf("wildcards are only allowed when reading: %s", path)
+	}
+	_, err = setIn(m, segs, 0, val)
+	return err
+}
+
+// setIn returns the (possibly new) container after writing segs[i:].
+func setIn(cur interface{}, segs []PathSeg, i int, val interface{}) (interface{}, error) {
+	if i == len(segs) {
+		return val, nil
+	}
+	s := segs[i]
+	if cur == nil {
+		cur = emptyContainerFor(s)
+	}
+	switch node := cur.(type) {
+	case map[string]interface{}:
+		if s.Kind != SegKey {
+			return nil, fmt.Errorf("cannot use %s on a map at %s", FormatPath(segs[i:i+1]), pathOrRoot(segs[:i]))
+		}
+		child, exists := node[s.Key]
+		if !exists {
+			child = nil
+		}
+		nv, err := setIn(child, segs, i+1, val)
+		if err != nil {
+			return nil, err
+		}
+		node[s.Key] = nv
+		return node, nil
+	case []interface{}:
+		switch s.Kind {
+		case SegAppend:
+			nv, err := setIn(nil, segs, i+1, val)
+			if err != nil {
+				return nil, err
+			}
+			return append(node, nv), nil
+		case SegIndex:
+			idx, ok := resolveIndex(s.Index, len(node))
+			if !ok {
+				return nil, fmt.Errorf("index %d out of range (len %d) at %s", s.Index, len(node), pathOrRoot(segs[:i]))
+			}
+			nv, err := setIn(node[idx], segs, i+1, val)
+			if err != nil {
+				return nil, err
+			}
+			node[idx] = nv
+			return node, nil
+		default:
+			return nil, fmt.Errorf("cannot use key %q on a list at %s", s.Key, pathOrRoot(segs[:i]))
+		}
+	default:
+		return nil, fmt.Errorf("cannot traverse scalar at %s", pathOrRoot(segs[:i]))
+	}
+}
+
+// DeleteByPath removes the entry at path; it reports false when absent.
+func DeleteByPath(m map[string]interface{}, path string) (bool, error) {
+	segs, err := ParsePath(path)
+	if err != nil {
+		return false, err
+	}
+	if hasWildcard(segs) {
+		return false, fmt.Errorf("wildcards are only allowed when reading: %s", path)
+	}
+	parentPath := FormatPath(segs[:len(segs)-1])
+	var parent interface{} = m
+	if len(segs) > 1 {
+		var ok bool
+		if parent, ok = GetByPath(m, parentPath); !ok {
+			return false, nil
+		}
+	}
+	last := segs[len(segs)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		if last.Kind != SegKey {
+			return false, fmt.Errorf("cannot use %s on a map at %s", FormatPath(segs[len(segs)-1:]), pathOrRoot(segs[:len(segs)-1]))
+		}
+		if _, ok := node[last.Key]; !ok {
+			return false, nil
+		}
+		delete(node, last.Key)
+		return true, nil
+	case []interface{}:
+		if last.Kind != SegIndex {
+			return false, fmt.Errorf("expected an index on list at %s", pathOrRoot(segs[:len(segs)-1]))
+		}
+		idx, ok := resolveIndex(last.Index, len(node))
 		if !ok {
-			next = make(map[string]interface{})
-			cur[p] = next
+			return false, nil
 		}
-		cur = next
+		return true, SetByPath(m, parentPath, append(node[:idx:idx], node[idx+1:]...))
+	default:
+		return false, fmt.Errorf("cannot traverse scalar at %s", pathOrRoot(segs[:len(segs)-1]))
+	}
+}
+
+func emptyContainerFor(s PathSeg) interface{} {
+	if s.Kind == SegIndex || s.Kind == SegAppend {
+		return []interface{}{}
+	}
+	return map[string]interface{}{}
+}
+
+func pathOrRoot(segs []PathSeg) string {
+	if len(segs) == 0 {
+		return "(root)"
 	}
+	return FormatPath(segs)
 }
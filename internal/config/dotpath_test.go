@@ -0,0 +1,300 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func key(k string) PathSeg { return PathSeg{Kind: SegKey, Key: k} }
+func idx(i int) PathSeg    { return PathSeg{Kind: SegIndex, Index: i} }
+
+var (
+	appendSegment = PathSeg{Kind: SegAppend}
+	wildSegment   = PathSeg{Kind: SegWildcard}
+)
+
+func TestParsePath(t *testing.T) {
+	cases := []struct {
+		path string
+		want []PathSeg
+		err  string
+	}{
+		{path: "a", want: []PathSeg{key("a")}},
+		{path: "a.b.c", want: []PathSeg{key("a"), key("b"), key("c")}},
+		{path: "a[0]", want: []PathSeg{key("a"), idx(0)}},
+		{path: "a[-1]", want: []PathSeg{key("a"), idx(-1)}},
+		{path: "a[ 2 ]", want: []PathSeg{key("a"), idx(2)}},
+		{path: "a[0][1].b", want: []PathSeg{key("a"), idx(0), idx(1), key("b")}},
+		{path: "a[+]", want: []PathSeg{key("a"), appendSegment}},
+		{path: "a.*", want: []PathSeg{key("a"), wildSegment}},
+		{path: "a[*].b", want: []PathSeg{key("a"), wildSegment, key("b")}},
+		{path: "*", want: []PathSeg{wildSegment}},
+		{path: `"a.b".c`, want: []PathSeg{key("a.b"), key("c")}},
+		{path: `'a"b'`, want: []PathSeg{key(`a"b`)}},
+		{path: `"a\"b\\c"`, want: []PathSeg{key(`a"b\c`)}},
+		{path: `'a\b'`, want: []PathSeg{key(`a\b`)}},
+		{path: `"*"`, want: []PathSeg{key("*")}},
+		{path: `""`, want: []PathSeg{key("")}},
+		{path: `a["x.y"]`, want: []PathSeg{key("a"), key("x.y")}},
+		{path: `a['[0]']`, want: []PathSeg{key("a"), key("[0]")}},
+		{path: `a\.b`, want: []PathSeg{key("a.b")}},
+		{path: `a\[0\]`, want: []PathSeg{key("a[0]")}},
+		{path: `a\\.b`, want: []PathSeg{key(`a\`), key("b")}},
+		{path: "[0]", want: []PathSeg{idx(0)}},
+
+		{path: "", err: "empty path"},
+		{path: "  ", err: "empty path"},
+		{path: ".a", err: "empty key at offset 0"},
+		{path: "a..b", err: "empty key at offset 2"},
+		{path: "a.", err: "trailing '.'"},
+		{path: "a]", err: "unexpected ']' at offset 1"},
+		{path: "a[0", err: "unterminated '[' at offset 1"},
+		{path: "a[x]", err: "bad index [x]"},
+		{path: "a[]", err: "bad index []"},
+		{path: `"a`, err: "unterminated quote at offset 0"},
+		{path: `a["x"`, err: "missing ']' at offset 5"},
+		{path: `"a"b`, err: "missing '.' before offset 3"},
+		{path: `a[0]b`, err: "missing '.' before offset 4"},
+		{path: `a[0]"b"`, err: "missing '.' before offset 4"},
+	}
+	for _, tc := range cases {
+		got, err := ParsePath(tc.path)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("ParsePath(%q) error = %v, want %q", tc.path, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePath(%q): %v", tc.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParsePath(%q) = %+v, want %+v", tc.path, got, tc.want)
+		}
+		again, err := ParsePath(FormatPath(got))
+		if err != nil || !reflect.DeepEqual(again, got) {
+			t.Errorf("FormatPath(%q) = %q does not parse back: %+v, %v", tc.path, FormatPath(got), again, err)
+		}
+	}
+}
+
+func TestFormatPath(t *testing.T) {
+	cases := map[string]string{
+		"a.b[0]":     "a.b[0]",
+		"a[ -1 ]":    "a[-1]",
+		`a["x.y"]`:   `a."x.y"`,
+		`a\.b.c`:     `"a.b".c`,
+		`'it''s'`:    "", // parse error: not a round-trip case
+		`"*".*[*]`:   `"*".*.*`,
+		`a[+]`:       "a[+]",
+		`"q\"".z`:    `"q\"".z`,
+		`"back\\\\"`: `"back\\\\"`,
+	}
+	for in, want := range cases {
+		segs, err := ParsePath(in)
+		if want == "" {
+			if err == nil {
+				t.Errorf("ParsePath(%q) succeeded, want an error", in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePath(%q): %v", in, err)
+			continue
+		}
+		if got := FormatPath(segs); got != want {
+			t.Errorf("FormatPath(ParsePath(%q)) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func sampleTree() map[string]interface{} {
+	return map[string]interface{}{
+		"name": "app",
+		"list": []interface{}{"a", "b", "c"},
+		"servers": []interface{}{
+			map[string]interface{}{"host": "h1", "port": 1},
+			map[string]interface{}{"host": "h2", "port": 2},
+		},
+		"dotted": map[string]interface{}{"a.b": "x"},
+		"maps": map[string]interface{}{
+			"one": map[string]interface{}{"v": 1},
+			"two": map[string]interface{}{"v": 2},
+		},
+	}
+}
+
+func TestGetByPath(t *testing.T) {
+	m := sampleTree()
+	cases := []struct {
+		path string
+		want interface{}
+		ok   bool
+	}{
+		{"name", "app", true},
+		{"list[0]", "a", true},
+		{"list[-1]", "c", true},
+		{"list[-3]", "a", true},
+		{"list[-4]", nil, false},
+		{"list[3]", nil, false},
+		{"servers[1].host", "h2", true},
+		{"servers[-2].port", 1, true},
+		{`dotted."a.b"`, "x", true},
+		{`dotted.a\.b`, "x", true},
+		{"dotted.a.b", nil, false},
+		{"name.x", nil, false},  // traversing a scalar
+		{"list.x", nil, false},  // key on a list
+		{"maps[0]", nil, false}, // index on a map
+		{"maps.*", nil, false},  // wildcards need GetAllByPath
+		{"list[", nil, false},   // invalid path
+	}
+	for _, tc := range cases {
+		got, ok := GetByPath(m, tc.path)
+		if ok != tc.ok || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("GetByPath(%q) = %v, %v; want %v, %v", tc.path, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestGetAllByPath(t *testing.T) {
+	m := sampleTree()
+	cases := []struct {
+		path string
+		want []PathMatch
+	}{
+		{"maps.*.v", []PathMatch{{"maps.one.v", 1}, {"maps.two.v", 2}}},
+		{"servers[*].host", []PathMatch{{"servers[0].host", "h1"}, {"servers[1].host", "h2"}}},
+		{"servers.*.port", []PathMatch{{"servers[0].port", 1}, {"servers[1].port", 2}}},
+		{"list[-1]", []PathMatch{{"list[2]", "c"}}},
+		{"dotted.*", []PathMatch{{`dotted."a.b"`, "x"}}},
+		{"name.*", nil},
+		{"missing.*", nil},
+	}
+	for _, tc := range cases {
+		got, err := GetAllByPath(m, tc.path)
+		if err != nil {
+			t.Errorf("GetAllByPath(%q): %v", tc.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("GetAllByPath(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+	if _, err := GetAllByPath(m, "a..b"); err == nil {
+		t.Error("GetAllByPath with an invalid path succeeded")
+	}
+}
+
+func TestSetByPath(t *testing.T) {
+	cases := []struct {
+		path string
+		val  interface{}
+		get  string // where to read the value back ("" = path)
+		err  string
+	}{
+		{path: "name", val: "new"},
+		{path: "a.b.c", val: 1},
+		{path: "list[-1]", val: "z", get: "list[2]"},
+		{path: "list[+]", val: "d", get: "list[3]"},
+		{path: "fresh[+]", val: "x", get: "fresh[0]"},
+		{path: "fresh[+].k", val: "v", get: "fresh[0].k"},
+		{path: "servers[0].tags[+]", val: "t", get: "servers[0].tags[0]"},
+		{path: `"x.y".z`, val: true},
+		{path: `maps.*`, val: 1, err: "wildcards are only allowed when reading"},
+		{path: "name.x", val: 1, err: "cannot traverse scalar at name"},
+		{path: "servers[0].port.x", val: 1, err: "cannot traverse scalar at servers[0].port"},
+		{path: "list[3]", val: 1, err: "index 3 out of range (len 3) at list"},
+		{path: "list[-4]", val: 1, err: "index -4 out of range (len 3) at list"},
+		{path: "fresh[0]", val: 1, err: "index 0 out of range (len 0) at fresh"},
+		{path: "list.x", val: 1, err: `cannot use key "x" on a list at list`},
+		{path: "maps[0]", val: 1, err: "cannot use [0] on a map at maps"},
+		{path: "[0]", val: 1, err: "cannot use [0] on a map at (root)"},
+		{path: "a..b", val: 1, err: "empty key"},
+	}
+	for _, tc := range cases {
+		m := sampleTree()
+		err := SetByPath(m, tc.path, tc.val)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("SetByPath(%q) error = %v, want %q", tc.path, err, tc.err)
+			}
+			if !reflect.DeepEqual(m, sampleTree()) {
+				t.Errorf("SetByPath(%q) failed but changed the tree: %v", tc.path, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SetByPath(%q): %v", tc.path, err)
+			continue
+		}
+		get := tc.get
+		if get == "" {
+			get = tc.path
+		}
+		if got, ok := GetByPath(m, get); !ok || !reflect.DeepEqual(got, tc.val) {
+			t.Errorf("after SetByPath(%q), %s = %v, %v; want %v", tc.path, get, got, ok, tc.val)
+		}
+	}
+}
+
+func TestDeleteByPath(t *testing.T) {
+	cases := []struct {
+		path    string
+		removed bool
+		check   string      // path to read afterwards
+		want    interface{} // expected value at check (nil = absent)
+		err     string
+	}{
+		{path: "name", removed: true, check: "name"},
+		{path: "list[0]", removed: true, check: "list", want: []interface{}{"b", "c"}},
+		{path: "list[-1]", removed: true, check: "list", want: []interface{}{"a", "b"}},
+		{path: "servers[1].port", removed: true, check: "servers[1]", want: map[string]interface{}{"host": "h2"}},
+		{path: `dotted."a.b"`, removed: true, check: "dotted", want: map[string]interface{}{}},
+		{path: "list[5]", removed: false, check: "list", want: []interface{}{"a", "b", "c"}},
+		{path: "missing", removed: false},
+		{path: "missing.deeper", removed: false},
+		{path: "maps.*", err: "wildcards are only allowed when reading"},
+		{path: "name.x", err: "cannot traverse scalar at name"},
+		{path: "list.x", err: "expected an index on list at list"},
+		{path: "maps[0]", err: "cannot use [0] on a map at maps"},
+		{path: "a[", err: "unterminated '['"},
+	}
+	for _, tc := range cases {
+		m := sampleTree()
+		removed, err := DeleteByPath(m, tc.path)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("DeleteByPath(%q) error = %v, want %q", tc.path, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || removed != tc.removed {
+			t.Errorf("DeleteByPath(%q) = %v, %v; want %v", tc.path, removed, err, tc.removed)
+			continue
+		}
+		if tc.check == "" {
+			continue
+		}
+		got, ok := GetByPath(m, tc.check)
+		if tc.want == nil {
+			if ok {
+				t.Errorf("after DeleteByPath(%q), %s = %v, want absent", tc.path, tc.check, got)
+			}
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("after DeleteByPath(%q), %s = %v, want %v", tc.path, tc.check, got, tc.want)
+		}
+	}
+}
+
+func TestDeleteByPathKeepsOtherSliceViews(t *testing.T) {
+	list := []interface{}{"a", "b", "c"}
+	m := map[string]interface{}{"list": list}
+	if _, err := DeleteByPath(m, "list[0]"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, []interface{}{"a", "b", "c"}) {
+		t.Errorf("original slice changed to %v", list)
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a config file codec. Files are matched to a format by extension
+// (or by name via --format); unknown extensions fall back to YAML.
+type Format struct {
+	Name   string
+	Exts   []string // lower-case, with leading dot; also matches exact base names like ".env"
+	Decode func(data []byte) (map[string]interface{}, error)
+	Encode func(v interface{}) ([]byte, error)
+}
+
+var formats []*Format
+
+// RegisterFormat adds a codec to the registry; later registrations win on
+// conflicting names or extensions.
+func RegisterFormat(f *Format) {
+	formats = append([]*Format{f}, formats...)
+}
+
+func init() {
+	RegisterFormat(&Format{Name: "yaml", Exts: []string{".yaml", ".yml"}, Decode: decodeYAML, Encode: yaml.Marshal})
+	RegisterFormat(&Format{Name: "json", Exts: []string{".json"}, Decode: decodeJSON, Encode: encodeJSON})
+	RegisterFormat(&Format{Name: "toml", Exts: []string{".toml"}, Decode: decodeTOML, Encode: encodeTOML})
+	RegisterFormat(&Format{Name: "dotenv", Exts: []string{".env"}, Decode: decodeDotenv, Encode: encodeDotenv})
+	RegisterFormat(&Format{Name: "ini", Exts: []string{".ini", ".cfg", ".conf"}, Decode: decodeINI, Encode: encodeINI})
+}
+
+// FormatNames lists registered format names in sorted order.
+func FormatNames() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, f := range formats {
+		if !seen[f.Name] {
+			seen[f.Name] = true
+			out = append(out, f.Name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// LookupFormat finds a format by name ("yml" and "env" are accepted aliases).
+func LookupFormat(name string) (*Format, error) {
+	n := strings.ToLower(strings.TrimSpace(name))
+	switch n {
+	case "yml":
+		n = "yaml"
+	case "env":
+		n = "dotenv"
+	}
+	for _, f := range formats {
+		if f.Name == n {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown format: %s (supported: %s)", name, strings.Join(FormatNames(), "|"))
+}
+
+// DetectFormat picks a format from the file name: by extension, or for
+// dotenv also by base names ".env" and ".env.<suffix>". Unknown names are YAML.
+func DetectFormat(path string) *Format {
+	if f, ok := formatOf(path); ok {
+		return f
+	}
+	f, _ := LookupFormat("yaml")
+	return f
+}
+
+// IsKnownFormat reports whether the file name maps to a registered format.
+func IsKnownFormat(path string) bool {
+	_, ok := formatOf(path)
+	return ok
+}
+
+func formatOf(path string) (*Format, bool) {
+	base := strings.ToLower(filepath.Base(path))
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range formats {
+		for _, e := range f.Exts {
+			if ext == e || base == e {
+				return f, true
+			}
+		}
+	}
+	if strings.HasPrefix(base, ".env.") {
+		f, err := LookupFormat("dotenv")
+		return f, err == nil
+	}
+	return nil, false
+}
+
+// resolveFormat returns the named format, or the one detected from path
+// when name is empty.
+func resolveFormat(path, name string) (*Format, error) {
+	if strings.TrimSpace(name) == "" {
+		return DetectFormat(path), nil
+	}
+	return LookupFormat(name)
+}
+
+// LoadFile decodes a config file with the given format (detected when empty).
+func LoadFile(path, format string) (map[string]interface{}, error) {
+	f, err := resolveFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := f.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", f.Name, err)
+	}
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+	return m, nil
+}
+
+// SaveFile encodes v with the given format (detected when empty).
+func SaveFile(path, format string, v interface{}) error {
+	f, err := resolveFormat(path, format)
+	if err != nil {
+		return err
+	}
+	out, err := f.Encode(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", f.Name, err)
+	}
+	return os.WriteFile(path, out, 0o644)
+}
+
+func decodeYAML(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	err := yaml.Unmarshal(data, &m)
+	return m, err
+}
+
+func decodeJSON(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	err := json.Unmarshal(data, &m)
+	return m, err
+}
+
+func encodeJSON(v interface{}) ([]byte, error) {
+	return json.MarshalIndent(v, "", "  ")
+}
@@ -0,0 +1,308 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ---- TOML ----
+
+func decodeTOML(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	_, err := toml.Decode(string(data), &m)
+	return m, err
+}
+
+func encodeTOML(v interface{}) ([]byte, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("root must be a table, got %T", v)
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(dropNulls(m)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// dropNulls removes null entries, which TOML cannot represent.
+func dropNulls(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		switch x := v.(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			out[k] = dropNulls(x)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// ---- shared helpers for line-based formats (dotenv, INI) ----
+
+// inferScalar types an unquoted value: true/false, integers and floats;
+// everything else stays a string.
+func inferScalar(s string) interface{} {
+	switch strings.ToLower(s) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "xXnN") {
+		return f
+	}
+	return s
+}
+
+// formatLineValue renders a scalar for dotenv/INI so that decoding returns
+// the same type: strings that would be re-typed or need escaping are quoted.
+// These formats have no lists (and dotenv no nesting), so anything else is
+// an error rather than a value that would come back as a different type.
+func formatLineValue(key string, v interface{}) (string, error) {
+	switch x := v.(type) {
+	case string:
+		if x == "" {
+			return `""`, nil
+		}
+		if _, isStr := inferScalar(x).(string); !isStr || x != strings.TrimSpace(x) || strings.ContainsAny(x, "\"'#;=\\\n\t") {
+			return strconv.Quote(x), nil
+		}
+		return x, nil
+	case bool, int, int64, float64, float32, uint64:
+		return fmt.Sprint(x), nil
+	case []interface{}:
+		return "", fmt.Errorf("%s: lists cannot be stored in this format", key)
+	case map[string]interface{}:
+		return "", fmt.Errorf("%s: nested maps cannot be stored in this format", key)
+	default:
+		return "", fmt.Errorf("%s: unsupported value type %T", key, v)
+	}
+}
+
+// parseLineValue decodes the right-hand side of KEY=VALUE. Double quotes
+// support Go-style escapes, single quotes are literal; unquoted values end at
+// an inline comment (" #" or " ;") and are typed with inferScalar.
+func parseLineValue(raw string, commentChars string) (interface{}, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	switch raw[0] {
+	case '"':
+		end := closingQuote(raw)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated quoted value: %s", raw)
+		}
+		s, err := strconv.Unquote(raw[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted value: %s", raw)
+		}
+		return s, nil
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated quoted value: %s", raw)
+		}
+		return raw[1 : end+1], nil
+	}
+	for i := 1; i < len(raw); i++ {
+		if strings.IndexByte(commentChars, raw[i]) >= 0 && (raw[i-1] == ' ' || raw[i-1] == '\t') {
+			raw = strings.TrimSpace(raw[:i])
+			break
+		}
+	}
+	return inferScalar(raw), nil
+}
+
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ---- dotenv ----
+
+// decodeDotenv reads KEY=VALUE lines (optionally prefixed with "export").
+// The result is flat: keys are never split on '.' or '_'.
+func decodeDotenv(data []byte) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		i := strings.IndexByte(line, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		v, err := parseLineValue(line[i+1:], "#")
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		m[strings.TrimSpace(line[:i])] = v
+	}
+	return m, sc.Err()
+}
+
+// encodeDotenv writes sorted KEY=VALUE lines. Values must be scalars; null
+// entries are dropped.
+func encodeDotenv(v interface{}) ([]byte, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("root must be a map, got %T", v)
+	}
+	var buf bytes.Buffer
+	for _, k := range sortedKeys(m) {
+		if m[k] == nil {
+			continue
+		}
+		val, err := formatLineValue(k, m[k])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", k, val)
+	}
+	return buf.Bytes(), nil
+}
+
+// ---- INI ----
+
+// decodeINI reads "key = value" (or "key: value") pairs; keys before the
+// first section go to the root and "[a.b]" sections map to nested tables.
+func decodeINI(data []byte) (map[string]interface{}, error) {
+	root := map[string]interface{}{}
+	cur := root
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed section header", n)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return nil, fmt.Errorf("line %d: empty section name", n)
+			}
+			cur = root
+			for _, part := range strings.Split(name, ".") {
+				part = strings.TrimSpace(part)
+				next, ok := cur[part].(map[string]interface{})
+				if !ok {
+					if _, exists := cur[part]; exists {
+						return nil, fmt.Errorf("line %d: section %q conflicts with a key", n, name)
+					}
+					next = map[string]interface{}{}
+					cur[part] = next
+				}
+				cur = next
+			}
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		v, err := parseLineValue(line[i+1:], "#;")
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		cur[strings.TrimSpace(line[:i])] = v
+	}
+	return root, sc.Err()
+}
+
+// encodeINI writes root scalars first, then one section per nested map
+// ("[a.b]" for deeper levels). Lists cannot be stored; null entries are
+// dropped.
+func encodeINI(v interface{}) ([]byte, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("root must be a map, got %T", v)
+	}
+	var buf bytes.Buffer
+	var write func(section string, m map[string]interface{}) error
+	write = func(section string, m map[string]interface{}) error {
+		keys := sortedKeys(m)
+		var subs []string
+		wroteHeader := section == ""
+		for _, k := range keys {
+			if _, ok := m[k].(map[string]interface{}); ok {
+				subs = append(subs, k)
+				continue
+			}
+			if m[k] == nil {
+				continue
+			}
+			name := k
+			if section != "" {
+				name = section + "." + k
+			}
+			val, err := formatLineValue(name, m[k])
+			if err != nil {
+				return err
+			}
+			if !wroteHeader {
+				if buf.Len() > 0 {
+					buf.WriteString("\n")
+				}
+				fmt.Fprintf(&buf, "[%s]\n", section)
+				wroteHeader = true
+			}
+			fmt.Fprintf(&buf, "%s = %s\n", k, val)
+		}
+		if !wroteHeader && len(subs) == 0 {
+			// keep empty sections so they survive a round trip
+			if buf.Len() > 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "[%s]\n", section)
+		}
+		for _, k := range subs {
+			name := k
+			if section != "" {
+				name = section + "." + k
+			}
+			if err := write(name, m[k].(map[string]interface{})); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := write("", m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type codec struct {
+	name   string
+	encode func(interface{}) ([]byte, error)
+	decode func([]byte) (map[string]interface{}, error)
+}
+
+var lineCodecs = []codec{
+	{"dotenv", encodeDotenv, decodeDotenv},
+	{"ini", encodeINI, decodeINI},
+}
+
+func TestLineCodecsRoundTripScalars(t *testing.T) {
+	in := map[string]interface{}{
+		"BOOL":     true,
+		"INT":      int64(42),
+		"NEG":      int64(-7),
+		"FLOAT":    1.5,
+		"PLAIN":    "hello",
+		"EMPTY":    "",
+		"NUMSTR":   "42",
+		"BOOLSTR":  "false",
+		"PADDED":   "  x  ",
+		"COMMENT":  "a #b ;c",
+		"QUOTES":   `say "hi" and 'bye'`,
+		"NEWLINE":  "line1\nline2\ttab",
+		"BACKSL":   `C:\path\to`,
+		"EQUALS":   "a=b",
+		"URL":      "https://example.com/x?y=1",
+		"HEXLIKE":  "0x1F",
+		"INFSTR":   "inf",
+		"UNICODE":  "héllo",
+		"LEADHASH": "#notacomment",
+	}
+	for _, c := range lineCodecs {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := c.encode(in)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			got, err := c.decode(data)
+			if err != nil {
+				t.Fatalf("decode: %v\n%s", err, data)
+			}
+			if !reflect.DeepEqual(got, in) {
+				for k, want := range in {
+					if !reflect.DeepEqual(got[k], want) {
+						t.Errorf("%s: got %#v, want %#v", k, got[k], want)
+					}
+				}
+				t.Logf("encoded:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestINIRoundTripSections(t *testing.T) {
+	in := map[string]interface{}{
+		"name": "app",
+		"server": map[string]interface{}{
+			"port": int64(8080),
+			"tls": map[string]interface{}{
+				"enabled": true,
+				"cert":    "/etc/ssl/app.pem",
+			},
+		},
+		"db": map[string]interface{}{"dsn": "user=a password=b"},
+	}
+	data, err := encodeINI(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeINI(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("round trip mismatch\n got: %#v\nwant: %#v\n%s", got, in, data)
+	}
+}
+
+func TestLineCodecsDropNulls(t *testing.T) {
+	for _, c := range lineCodecs {
+		data, err := c.encode(map[string]interface{}{"A": nil, "B": "x"})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		got, err := c.decode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if want := map[string]interface{}{"B": "x"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %#v, want %#v", c.name, got, want)
+		}
+	}
+}
+
+func TestLineCodecsRejectNonScalars(t *testing.T) {
+	cases := []struct {
+		codec string
+		in    map[string]interface{}
+		err   string
+	}{
+		{"dotenv", map[string]interface{}{"LIST": []interface{}{"a", "b"}}, "LIST: lists"},
+		{"dotenv", map[string]interface{}{"DB": map[string]interface{}{"HOST": "x"}}, "DB: nested maps"},
+		{"ini", map[string]interface{}{"list": []interface{}{int64(1)}}, "list: lists"},
+		{"ini", map[string]interface{}{"s": map[string]interface{}{"list": []interface{}{}}}, "s.list: lists"},
+		{"ini", map[string]interface{}{"s": map[string]interface{}{"v": struct{}{}}}, "s.v: unsupported value type"},
+	}
+	for _, tc := range cases {
+		var c codec
+		for _, lc := range lineCodecs {
+			if lc.name == tc.codec {
+				c = lc
+			}
+		}
+		_, err := c.encode(tc.in)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s %v: got error %v, want %q", tc.codec, tc.in, err, tc.err)
+		}
+	}
+}
@@ -10,3 +10,9 @@ func GetString(m map[string]interface{}, key string) string {
 	}
 	return ""
 }
+
+// GetResolvedString is GetString with ${env:}, ${file:} and ${secret:}
+// references resolved.
+func GetResolvedString(envDir string, m map[string]interface{}, key string) (string, error) {
+	return resolveString(envDir, GetString(m, key))
+}
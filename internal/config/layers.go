@@ -0,0 +1,224 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lyenv/internal/env"
+)
+
+// Layer names one source of configuration. Effective config is the merge of
+// user < env < profile (later layers override earlier ones).
+type Layer string
+
+const (
+	LayerUser    Layer = "user"    // <user config dir>/config.yaml
+	LayerEnv     Layer = "env"     // <env>/lyenv.yaml
+	LayerProfile Layer = "profile" // <env>/lyenv.<profile>.yaml
+)
+
+var profileOverride string
+
+// SetProfile selects the active profile (from the global --profile flag);
+// an empty value falls back to $LYENV_PROFILE.
+func SetProfile(p string) {
+	profileOverride = strings.TrimSpace(p)
+}
+
+// ActiveProfile returns the selected profile name or "" when none.
+func ActiveProfile() string {
+	if profileOverride != "" {
+		return profileOverride
+	}
+	return strings.TrimSpace(os.Getenv("LYENV_PROFILE"))
+}
+
+// ParseLayer parses a --layer value; empty means env.
+func ParseLayer(s string) (Layer, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "env":
+		return LayerEnv, nil
+	case "user":
+		return LayerUser, nil
+	case "profile":
+		return LayerProfile, nil
+	default:
+		return "", fmt.Errorf("unknown layer: %s (expected user|env|profile)", s)
+	}
+}
+
+// UserConfigFile is the user-level config layer.
+func UserConfigFile() string {
+	return filepath.Join(env.UserConfigDir(), "config.yaml")
+}
+
+// ProfileFile returns the overlay file name for a profile: lyenv.<profile>.yaml.
+func ProfileFile(cfgFile, profile string) string {
+	ext := filepath.Ext(cfgFile)
+	return strings.TrimSuffix(cfgFile, ext) + "." + profile + ext
+}
+
+// LayerFile resolves the file backing a layer, relative to envDir for env and
+// profile layers and absolute for the user layer.
+func LayerFile(cfgFile string, l Layer) (string, error) {
+	switch l {
+	case LayerUser:
+		return UserConfigFile(), nil
+	case LayerProfile:
+		p := ActiveProfile()
+		if p == "" {
+			return "", fmt.Errorf("no active profile (use --profile=<NAME> or LYENV_PROFILE)")
+		}
+		if err := ValidProfileName(p); err != nil {
+			return "", err
+		}
+		return ProfileFile(cfgFile, p), nil
+	default:
+		return cfgFile, nil
+	}
+}
+
+// ResolveWriteTarget returns the file a write to layer l should edit,
+// creating an empty user/profile layer file when it does not exist yet.
+func ResolveWriteTarget(envDir, cfgFile string, l Layer) (string, error) {
+	f, err := LayerFile(cfgFile, l)
+	if err != nil {
+		return "", err
+	}
+	if l == LayerEnv {
+		return f, nil
+	}
+	p := cfgPath(envDir, f)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+	if err := env.WriteFileIfNotExists(p, "", 0o644); err != nil {
+		return "", err
+	}
+	return f, nil
+}
+
+// LayerSource is one loaded layer.
+type LayerSource struct {
+	Layer Layer
+	Name  string // "user", "env" or "profile:<name>"
+	Path  string
+	Data  map[string]interface{}
+}
+
+// LoadLayers loads existing layers from lowest to highest precedence.
+// The env layer is mandatory; user and profile layers are optional.
+func LoadLayers(envDir, cfgFile string) ([]LayerSource, error) {
+	var out []LayerSource
+
+	up := UserConfigFile()
+	if _, err := os.Stat(up); err == nil {
+		m, err := LoadYAML(up)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read user config %s: %w", up, err)
+		}
+		out = append(out, LayerSource{Layer: LayerUser, Name: "user", Path: up, Data: m})
+	}
+
+	ep := cfgPath(envDir, cfgFile)
+	m, err := LoadYAML(ep)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, LayerSource{Layer: LayerEnv, Name: "env", Path: ep, Data: m})
+
+	if p := ActiveProfile(); p != "" {
+		if err := ValidProfileName(p); err != nil {
+			return nil, err
+		}
+		pp := cfgPath(envDir, ProfileFile(cfgFile, p))
+		if _, err := os.Stat(pp); err == nil {
+			m, err := LoadYAML(pp)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read profile %s: %w", pp, err)
+			}
+			out = append(out, LayerSource{Layer: LayerProfile, Name: "profile:" + p, Path: pp, Data: m})
+		} else {
+			return nil, fmt.Errorf("profile not found: %s (missing %s)", p, pp)
+		}
+	}
+	return out, nil
+}
+
+// LoadEffective returns the merged configuration of all layers.
+func LoadEffective(envDir string) (map[string]interface{}, error) {
+	layers, err := LoadLayers(envDir, "lyenv.yaml")
+	if err != nil {
+		return nil, err
+	}
+	return mergeLayers(layers), nil
+}
+
+func mergeLayers(layers []LayerSource) map[string]interface{} {
+	out := map[string]interface{}{}
+	for _, l := range layers {
+		// copy so the merge never aliases maps owned by a layer
+		out = MergeMapWithStrategy(out, deepCopyMap(l.Data), MergeOverride)
+	}
+	return out
+}
+
+// originOf reports which layers define path, highest precedence first. A
+// scalar or list comes from exactly one layer; a map may combine several.
+func originOf(layers []LayerSource, path string) []LayerSource {
+	var out []LayerSource
+	for i := len(layers) - 1; i >= 0; i-- {
+		v, ok := GetByPath(layers[i].Data, path)
+		if !ok {
+			continue
+		}
+		out = append(out, layers[i])
+		if _, isMap := v.(map[string]interface{}); !isMap {
+			break
+		}
+	}
+	return out
+}
+
+func deepCopyMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = deepCopyValue(v)
+	}
+	return out
+}
+
+func deepCopyValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return deepCopyMap(x)
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, e := range x {
+			out[i] = deepCopyValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// cfgPath joins a config file onto envDir unless it is already absolute.
+func cfgPath(envDir, cfgFile string) string {
+	if filepath.IsAbs(cfgFile) {
+		return cfgFile
+	}
+	return filepath.Join(envDir, cfgFile)
+}
+
+// ValidProfileName rejects profile names that could escape the environment.
+func ValidProfileName(p string) error {
+	for _, r := range p {
+		if !(r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return fmt.Errorf("invalid profile name: %q (allowed: letters, digits, '-', '_')", p)
+		}
+	}
+	return nil
+}
@@ -1,43 +1,136 @@
 package config
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"sort"
+	"strings"
 
 	"lyenv/internal/env"
+	"lyenv/internal/secret"
 
 	"gopkg.in/yaml.v3"
 )
 
 func ConfigSetWithType(envDir, cfgFile, key, rawValue, typeOpt string) error {
-	cfgPath := filepath.Join(envDir, cfgFile)
-	m, err := LoadYAML(cfgPath)
+	val, err := ParseWithType(rawValue, typeOpt)
 	if err != nil {
-		return fmt.Errorf("failed to read config: %w", err)
+		return err
 	}
-	val, err := ParseWithType(rawValue, typeOpt)
+	return editConfig(envDir, cfgFile, func(doc *Document) error {
+		return doc.Set(key, val)
+	})
+}
+
+// editConfig loads lyenv.yaml as a Document, applies edit, validates the
+// result against the config schemas and writes it back.
+func editConfig(envDir, cfgFile string, edit func(doc *Document) error) error {
+	path := cfgPath(envDir, cfgFile)
+	doc, err := LoadDocument(path)
 	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	before, _ := doc.Map()
+	if err := edit(doc); err != nil {
 		return err
 	}
-	SetByPath(m, key, val)
-	if err := SaveYAML(cfgPath, m); err != nil {
+	if err := checkDocument(envDir, before, doc); err != nil {
+		return err
+	}
+	if err := doc.Save(path); err != nil {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 	return nil
 }
 
+// ConfigGet reads a key from the effective config (user < env < profile layers),
+// resolving ${env:}, ${file:} and ${secret:} references.
 func ConfigGet(envDir, cfgFile, key string) (string, error) {
-	cfgPath := filepath.Join(envDir, cfgFile)
-	m, err := LoadYAML(cfgPath)
+	out, _, err := ConfigGetWithOrigin(envDir, cfgFile, key, true)
+	return out, err
+}
+
+// ConfigGetWithOrigin is ConfigGet that also reports the layer(s) the value
+// came from, e.g. "profile:dev (/env/lyenv.dev.yaml)". With resolve=false
+// references are returned as written.
+func ConfigGetWithOrigin(envDir, cfgFile, key string, resolve bool) (string, string, error) {
+	layers, err := LoadLayers(envDir, cfgFile)
 	if err != nil {
-		return "", fmt.Errorf("failed to read config: %w", err)
+		return "", "", fmt.Errorf("failed to read config: %w", err)
 	}
-	val, ok := GetByPath(m, key)
+	segs, err := ParsePath(key)
+	if err != nil {
+		return "", "", err
+	}
+	merged := mergeLayers(layers)
+
+	// Wildcard reads render every match as "<path>: <value>"
+	if hasWildcard(segs) {
+		matches, err := GetAllByPath(merged, key)
+		if err != nil {
+			return "", "", err
+		}
+		if len(matches) == 0 {
+			return "", "", fmt.Errorf("key not found: %s", key)
+		}
+		var b strings.Builder
+		var origins []string
+		for _, mt := range matches {
+			if resolve {
+				if mt.Value, err = ResolveRefs(envDir, mt.Value); err != nil {
+					return "", "", err
+				}
+			}
+			out, err := yaml.Marshal(map[string]interface{}{mt.Path: mt.Value})
+			if err != nil {
+				return "", "", fmt.Errorf("failed to serialize value: %w", err)
+			}
+			b.Write(out)
+			origins = append(origins, mt.Path+"="+describeOrigin(layers, mt.Path))
+		}
+		return b.String(), strings.Join(origins, "; "), nil
+	}
+
+	val, ok := GetByPath(merged, key)
 	if !ok {
-		return "", fmt.Errorf("key not found: %s", key)
+		return "", "", fmt.Errorf("key not found: %s", key)
+	}
+	if resolve {
+		if val, err = ResolveRefs(envDir, val); err != nil {
+			return "", "", err
+		}
 	}
+	out, err := FormatValue(val)
+	if err != nil {
+		return "", "", err
+	}
+	return out, describeOrigin(layers, key), nil
+}
+
+func describeOrigin(layers []LayerSource, key string) string {
+	var origins []string
+	for _, l := range originOf(layers, key) {
+		origins = append(origins, fmt.Sprintf("%s (%s)", l.Name, l.Path))
+	}
+	return strings.Join(origins, ", ")
+}
+
+// ConfigUnset removes a key (dot path) from the config file.
+func ConfigUnset(envDir, cfgFile, key string) error {
+	return editConfig(envDir, cfgFile, func(doc *Document) error {
+		ok, err := doc.Unset(key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("key not found: %s", key)
+		}
+		return nil
+	})
+}
+
+// FormatValue renders a value as `config get` prints it: scalars on one
+// line, maps and lists as YAML.
+func FormatValue(val interface{}) (string, error) {
 	switch v := val.(type) {
 	case string:
 		return v + "\n", nil
@@ -57,9 +150,29 @@ func ConfigGet(envDir, cfgFile, key string) (string, error) {
 	}
 }
 
-func ConfigDump(envDir, cfgFile, key, outFile string) error {
-	cfgPath := filepath.Join(envDir, cfgFile)
-	m, err := LoadYAML(cfgPath)
+// ConfigDump writes the config (or one key) to outFile in the given format
+// (detected from outFile when empty). References are kept unresolved and any
+// stored secret value found literally is masked.
+func ConfigDump(envDir, cfgFile, key, outFile, format string) error {
+	path := cfgPath(envDir, cfgFile)
+	f, err := resolveFormat(outFile, format)
+	if err != nil {
+		return err
+	}
+	red := secret.LoadRedactor(envDir)
+	if key == "" && f.Name == "yaml" {
+		// Full YAML dump: copy the document as-is so comments survive.
+		doc, err := LoadDocument(path)
+		if err != nil {
+			return fmt.Errorf("failed to read config: %w", err)
+		}
+		redactNode(doc.root, red)
+		if err := doc.Save(outFile); err != nil {
+			return fmt.Errorf("failed to write dump file: %w", err)
+		}
+		return nil
+	}
+	m, err := LoadYAML(path)
 	if err != nil {
 		return fmt.Errorf("failed to read config: %w", err)
 	}
@@ -72,143 +185,108 @@ func ConfigDump(envDir, cfgFile, key, outFile string) error {
 		}
 		toWrite = val
 	}
-	if err := SaveAny(outFile, toWrite); err != nil {
+	if err := SaveFile(outFile, f.Name, redactValue(toWrite, red)); err != nil {
 		return fmt.Errorf("failed to write dump file: %w", err)
 	}
 	return nil
 }
 
-func ConfigLoadWithStrategy(envDir, cfgFile, srcFile string, strategy MergeStrategy) error {
-	cfgPath := filepath.Join(envDir, cfgFile)
-	base, err := LoadYAML(cfgPath)
-	if err != nil {
-		return fmt.Errorf("failed to read base config: %w", err)
+func redactNode(n *yaml.Node, red *secret.Redactor) {
+	if n == nil {
+		return
 	}
-	overlay, err := LoadAny(srcFile)
-	if err != nil {
-		return fmt.Errorf("failed to read source config: %w", err)
+	if n.Kind == yaml.ScalarNode {
+		n.Value = red.String(n.Value)
 	}
-
-	merged := MergeMapWithStrategy(base, overlay, strategy)
-	if err := SaveYAML(cfgPath, merged); err != nil {
-		return fmt.Errorf("failed to write merged config: %w", err)
+	for _, c := range n.Content {
+		redactNode(c, red)
 	}
-	return nil
 }
 
-// Import a value from JSON file and write into lyenv.yaml, supporting type and merge strategy.
-func ConfigImportJSON(envDir, cfgFile, jsonFile, jsonKey, destKey, typeOpt string, strategy MergeStrategy, inputOn bool) error {
-	// Load JSON
-	jf, err := os.ReadFile(jsonFile)
-	if err != nil {
-		return fmt.Errorf("failed to read JSON file: %w", err)
-	}
-	var jm interface{}
-	if err := json.Unmarshal(jf, &jm); err != nil {
-		return fmt.Errorf("invalid JSON: %v", err)
-	}
-
-	// Extract value by dot path
-	jmap, ok := jm.(map[string]interface{})
-	var jval interface{}
-	var found bool
-	if ok {
-		jval, found = GetByPath(jmap, jsonKey)
-	}
-	if !found || jval == nil {
-		if inputOn {
-			// Prompt user for a value (raw text)
-			prompt := fmt.Sprintf("Enter value for JSON key '%s' (type=%s, or 'json'):", jsonKey, NonEmpty(typeOpt, "auto"))
-			in, err := env.PromptLine(prompt)
-			if err != nil {
-				return fmt.Errorf("input failed: %v", err)
-			}
-			// Parse with type
-			parsed, err := ParseWithType(in, typeOpt)
-			if err != nil {
-				return err
-			}
-			jval = parsed
-		} else {
-			return fmt.Errorf("JSON key not found or empty: %s", jsonKey)
+func redactValue(v interface{}, red *secret.Redactor) interface{} {
+	switch x := v.(type) {
+	case string:
+		return red.String(x)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			out[k] = redactValue(e, red)
 		}
-	}
-
-	// Coerce type if requested
-	if typeOpt != "" {
-		// If original is a complex object and typeOpt != json, we still allow coercion for scalars
-		raw := ToJSONStringIfNeeded(jval)
-		parsed, err := ParseWithType(raw, typeOpt)
-		if err != nil {
-			return err
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, e := range x {
+			out[i] = redactValue(e, red)
 		}
-		jval = parsed
+		return out
+	default:
+		return v
 	}
+}
 
-	// Load YAML config
-	cfgPath := filepath.Join(envDir, cfgFile)
-	m, err := LoadYAML(cfgPath)
+// ConfigLoadWithStrategy merges a whole file (format detected unless given)
+// into the config file.
+func ConfigLoadWithStrategy(envDir, cfgFile, srcFile, format string, strategy MergeStrategy) error {
+	overlay, err := LoadFile(srcFile, format)
 	if err != nil {
-		return fmt.Errorf("failed to read config: %w", err)
+		return fmt.Errorf("failed to read source config: %w", err)
 	}
+	return editConfig(envDir, cfgFile, func(doc *Document) error {
+		return doc.Merge(overlay, strategy)
+	})
+}
 
-	// If destination key exists and both sides are composite, apply merge strategy.
-	existing, exists := GetByPath(m, destKey)
-	if exists {
-		// Merge behavior:
-		em, eIsMap := existing.(map[string]interface{})
-		jm2, jIsMap := jval.(map[string]interface{})
-		ea, eIsArr := ToIfaceSlice(existing)
-		ja, jIsArr := ToIfaceSlice(jval)
+// ConfigMergeMap merges an in-memory overlay (e.g. stdio mutations) into lyenv.yaml.
+func ConfigMergeMap(envDir, cfgFile string, overlay map[string]interface{}, strategy MergeStrategy) error {
+	return ConfigApplyMutations(envDir, cfgFile, overlay, nil, nil, strategy)
+}
 
-		if eIsMap && jIsMap {
-			merged := MergeMapWithStrategy(em, jm2, strategy)
-			SetByPath(m, destKey, merged)
-		} else if eIsArr && jIsArr {
-			switch strategy {
-			case MergeAppend:
-				SetByPath(m, destKey, append(ea, ja...))
-			case MergeKeep:
-				// keep base
-				// no-op
-			case MergeOverride:
-				SetByPath(m, destKey, jval)
+// ConfigApplyMutations applies stdio mutations to lyenv.yaml in one write:
+// merge overlay first, then explicit path sets, then path removals.
+func ConfigApplyMutations(envDir, cfgFile string, overlay, set map[string]interface{}, unset []string, strategy MergeStrategy) error {
+	return editConfig(envDir, cfgFile, func(doc *Document) error {
+		if err := doc.Merge(overlay, strategy); err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(set))
+		for k := range set {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := doc.Set(k, set[k]); err != nil {
+				return fmt.Errorf("set %s: %w", k, err)
 			}
-		} else {
-			// scalar or type mismatch -> follow strategy
-			switch strategy {
-			case MergeKeep:
-				// keep existing
-			case MergeOverride, MergeAppend:
-				// treat append as override for scalars/mismatch
-				SetByPath(m, destKey, jval)
+		}
+		for _, k := range unset {
+			if _, err := doc.Unset(k); err != nil {
+				return fmt.Errorf("unset %s: %w", k, err)
 			}
 		}
-	} else {
-		// Not exists -> set
-		SetByPath(m, destKey, jval)
-	}
-
-	if err := SaveYAML(cfgPath, m); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
-	}
-	return nil
+		return nil
+	})
 }
 
-// Import a value from YAML file and write into lyenv.yaml, supporting type and merge strategy.
-// Note: The YAML root must be a mapping for dot path traversal; list root is not supported in MVP.
-func ConfigImportYAML(envDir, cfgFile, yamlFile, yamlKey, destKey, typeOpt string, strategy MergeStrategy, inputOn bool) error {
-	// Load YAML (as map)
-	ymap, err := LoadYAML(yamlFile)
+// ConfigImport reads srcKey (dot path) from a file in any registered format
+// (detected from the extension unless format is given) and merges the value
+// into destKey of the config file, supporting type coercion and merge strategy.
+func ConfigImport(envDir, cfgFile, srcFile, srcKey, destKey, typeOpt, format string, strategy MergeStrategy, inputOn bool) error {
+	f, err := resolveFormat(srcFile, format)
+	if err != nil {
+		return err
+	}
+	label := strings.ToUpper(f.Name)
+	src, err := LoadFile(srcFile, f.Name)
 	if err != nil {
-		return fmt.Errorf("failed to read YAML file: %w", err)
+		return fmt.Errorf("failed to read %s file: %w", label, err)
 	}
 
 	// Extract value by dot path
-	yval, found := GetByPath(ymap, yamlKey)
-	if !found || yval == nil {
+	val, found := GetByPath(src, srcKey)
+	if !found || val == nil {
 		if inputOn {
-			prompt := fmt.Sprintf("Enter value for YAML key '%s' (type=%s, or 'json'):", yamlKey, NonEmpty(typeOpt, "auto"))
+			// Prompt user for a value (raw text)
+			prompt := fmt.Sprintf("Enter value for %s key '%s' (type=%s, or 'json'):", label, srcKey, NonEmpty(typeOpt, "auto"))
 			in, err := env.PromptLine(prompt)
 			if err != nil {
 				return fmt.Errorf("input failed: %v", err)
@@ -217,65 +295,33 @@ func ConfigImportYAML(envDir, cfgFile, yamlFile, yamlKey, destKey, typeOpt strin
 			if err != nil {
 				return err
 			}
-			yval = parsed
+			val = parsed
 		} else {
-			return fmt.Errorf("YAML key not found or empty: %s", yamlKey)
+			return fmt.Errorf("%s key not found or empty: %s", label, srcKey)
 		}
 	}
 
-	// Coerce type if requested
+	// Coerce type if requested; complex values are passed as JSON text
 	if typeOpt != "" {
-		raw := ToJSONStringIfNeeded(yval)
-		parsed, err := ParseWithType(raw, typeOpt)
+		parsed, err := ParseWithType(ToJSONStringIfNeeded(val), typeOpt)
 		if err != nil {
 			return err
 		}
-		yval = parsed
-	}
-
-	// Load lyenv YAML config
-	cfgPath := filepath.Join(envDir, cfgFile)
-	m, err := LoadYAML(cfgPath)
-	if err != nil {
-		return fmt.Errorf("failed to read config: %w", err)
+		val = parsed
 	}
 
-	// Merge into destination key according to strategy
-	existing, exists := GetByPath(m, destKey)
-	if exists {
-		em, eIsMap := existing.(map[string]interface{})
-		ym, yIsMap := yval.(map[string]interface{})
-		ea, eIsArr := ToIfaceSlice(existing)
-		ya, yIsArr := ToIfaceSlice(yval)
+	// Merge into destination key of lyenv.yaml according to strategy
+	return editConfig(envDir, cfgFile, func(doc *Document) error {
+		return doc.MergeAt(destKey, val, strategy)
+	})
+}
 
-		if eIsMap && yIsMap {
-			merged := MergeMapWithStrategy(em, ym, strategy)
-			SetByPath(m, destKey, merged)
-		} else if eIsArr && yIsArr {
-			switch strategy {
-			case MergeAppend:
-				SetByPath(m, destKey, append(ea, ya...))
-			case MergeKeep:
-				// keep base
-			case MergeOverride:
-				SetByPath(m, destKey, yval)
-			}
-		} else {
-			// scalar or mismatched types
-			switch strategy {
-			case MergeKeep:
-				// keep existing
-			case MergeOverride, MergeAppend:
-				SetByPath(m, destKey, yval)
-			}
-		}
-	} else {
-		// Not exists -> set
-		SetByPath(m, destKey, yval)
-	}
+// ConfigImportJSON is ConfigImport for a JSON source file.
+func ConfigImportJSON(envDir, cfgFile, jsonFile, jsonKey, destKey, typeOpt string, strategy MergeStrategy, inputOn bool) error {
+	return ConfigImport(envDir, cfgFile, jsonFile, jsonKey, destKey, typeOpt, "json", strategy, inputOn)
+}
 
-	if err := SaveYAML(cfgPath, m); err != nil {
-		return fmt.Errorf("failed to write config: %w", err)
-	}
-	return nil
+// ConfigImportYAML is ConfigImport for a YAML source file.
+func ConfigImportYAML(envDir, cfgFile, yamlFile, yamlKey, destKey, typeOpt string, strategy MergeStrategy, inputOn bool) error {
+	return ConfigImport(envDir, cfgFile, yamlFile, yamlKey, destKey, typeOpt, "yaml", strategy, inputOn)
 }
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"lyenv/internal/secret"
+)
+
+// Config strings may reference values that are resolved at read time:
+//
+//	${env:NAME}    environment variable (error when unset)
+//	${file:PATH}   file content without the trailing newline; relative to the env dir
+//	${secret:NAME} value from the encrypted store (lyenv secret set)
+//
+// "$${...}" escapes a literal "${...}". Files on disk always keep the
+// reference, never the resolved value.
+var refPattern = regexp.MustCompile(`\$?\$\{(env|file|secret):([^}]*)\}`)
+
+// ResolveRefs returns a copy of v with every reference in string values
+// (map values and list elements, at any depth) replaced by its value.
+func ResolveRefs(envDir string, v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case string:
+		return resolveString(envDir, x)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			r, err := ResolveRefs(envDir, e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, e := range x {
+			r, err := ResolveRefs(envDir, e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// ResolveMap is ResolveRefs for a map value.
+func ResolveMap(envDir string, m map[string]interface{}) (map[string]interface{}, error) {
+	r, err := ResolveRefs(envDir, m)
+	if err != nil {
+		return nil, err
+	}
+	return r.(map[string]interface{}), nil
+}
+
+func resolveString(envDir, s string) (string, error) {
+	var firstErr error
+	out := refPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		sub := refPattern.FindStringSubmatch(m)
+		val, err := resolveRef(envDir, sub[1], strings.TrimSpace(sub[2]))
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return val
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return out, nil
+}
+
+func resolveRef(envDir, kind, arg string) (string, error) {
+	if arg == "" {
+		return "", fmt.Errorf("empty ${%s:} reference", kind)
+	}
+	switch kind {
+	case "env":
+		v, ok := os.LookupEnv(arg)
+		if !ok {
+			return "", fmt.Errorf("environment variable not set: %s (referenced as ${env:%s})", arg, arg)
+		}
+		return v, nil
+	case "file":
+		p := arg
+		if strings.HasPrefix(p, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				p = filepath.Join(home, p[2:])
+			}
+		}
+		b, err := os.ReadFile(cfgPath(envDir, p))
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve ${file:%s}: %w", arg, err)
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r"), nil
+	default: // secret
+		v, err := secret.Get(envDir, arg)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve ${secret:%s}: %w", arg, err)
+		}
+		return v, nil
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"lyenv/internal/secret"
+)
+
+func TestResolveRefs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("LYENV_CONFIG_DIR", t.TempDir())
+	t.Setenv("LYENV_TEST_HOST", "db.local")
+	if err := os.WriteFile(filepath.Join(home, "token.txt"), []byte("tok-123\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	abs := filepath.Join(t.TempDir(), "crlf.txt")
+	if err := os.WriteFile(abs, []byte("win\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := secret.Set(home, "db_pass", "p@ss"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: "plain", want: "plain"},
+		{in: "${env:LYENV_TEST_HOST}", want: "db.local"},
+		{in: "host=${env: LYENV_TEST_HOST }:5432", want: "host=db.local:5432"},
+		{in: "${file:token.txt}", want: "tok-123"},
+		{in: "${file:" + abs + "}", want: "win"},
+		{in: "${secret:db_pass}", want: "p@ss"},
+		{in: "u:${env:LYENV_TEST_HOST}/${secret:db_pass}", want: "u:db.local/p@ss"},
+		{in: "$${env:LYENV_TEST_HOST}", want: "${env:LYENV_TEST_HOST}"},
+		{in: "${other:x} and ${env}", want: "${other:x} and ${env}"},
+		{in: "${env:LYENV_TEST_UNSET}", err: "environment variable not set: LYENV_TEST_UNSET"},
+		{in: "${env:}", err: "empty ${env:} reference"},
+		{in: "${file:missing.txt}", err: "failed to resolve ${file:missing.txt}"},
+		{in: "${secret:nope}", err: "failed to resolve ${secret:nope}: secret not found"},
+		{in: "${secret:../x}", err: "invalid secret name"},
+	}
+	for _, tc := range cases {
+		got, err := ResolveRefs(home, tc.in)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("ResolveRefs(%q) error = %v, want %q", tc.in, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("ResolveRefs(%q) = %v, %v; want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestResolveMapIsDeepAndCopies(t *testing.T) {
+	t.Setenv("LYENV_TEST_VAL", "v")
+	in := map[string]interface{}{
+		"a": "${env:LYENV_TEST_VAL}",
+		"n": map[string]interface{}{"list": []interface{}{"x-${env:LYENV_TEST_VAL}", 3, true, nil}},
+	}
+	got, err := ResolveMap(t.TempDir(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a": "v",
+		"n": map[string]interface{}{"list": []interface{}{"x-v", 3, true, nil}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if in["a"] != "${env:LYENV_TEST_VAL}" || in["n"].(map[string]interface{})["list"].([]interface{})[0] != "x-${env:LYENV_TEST_VAL}" {
+		t.Errorf("input was modified: %v", in)
+	}
+}
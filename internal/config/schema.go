@@ -0,0 +1,529 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema is a parsed JSON Schema document. Only the draft 2020-12 subset used
+// by lyenv is understood: type, enum, const, properties, required,
+// additionalProperties, patternProperties, propertyNames, items, prefixItems,
+// min/maxItems, uniqueItems, min/maxLength, pattern, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, multipleOf, min/maxProperties,
+// allOf, anyOf, oneOf, not and local $ref into $defs. Unknown keywords
+// (title, description, default, format, ...) are ignored.
+type Schema map[string]interface{}
+
+// Violation is one schema mismatch located by dot path.
+type Violation struct {
+	File    string `json:"file,omitempty"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	p := v.Path
+	if p == "" {
+		p = "(root)"
+	}
+	if v.File != "" {
+		return fmt.Sprintf("%s: %s: %s", v.File, p, v.Message)
+	}
+	return fmt.Sprintf("%s: %s", p, v.Message)
+}
+
+// LoadSchema reads a schema file (YAML or JSON by extension).
+func LoadSchema(path string) (Schema, error) {
+	m, err := LoadAny(path)
+	if err != nil {
+		return nil, err
+	}
+	return Schema(m), nil
+}
+
+// Validate checks v against the schema and returns every violation found.
+// prefix is prepended to reported paths (use "" for the document root).
+func (s Schema) Validate(v interface{}, prefix string) []Violation {
+	sv := &schemaValidator{root: s}
+	sv.validate(map[string]interface{}(s), v, prefix)
+	return sv.out
+}
+
+type schemaValidator struct {
+	root Schema
+	out  []Violation
+}
+
+func (sv *schemaValidator) fail(path, format string, args ...interface{}) {
+	sv.out = append(sv.out, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (sv *schemaValidator) validate(s map[string]interface{}, v interface{}, path string) {
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := sv.resolveRef(ref)
+		if err != nil {
+			sv.fail(path, "%v", err)
+		} else {
+			sv.validate(target, v, path)
+		}
+	}
+
+	if t, ok := s["type"]; ok && !matchesType(t, v) {
+		sv.fail(path, "expected %s, got %s", typeList(t), jsonType(v))
+		return
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			sv.fail(path, "value %s is not one of %s", render(v), render(enum))
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonEqual(c, v) {
+		sv.fail(path, "value must be %s", render(c))
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		sv.validateObject(s, val, path)
+	case []interface{}:
+		sv.validateArray(s, val, path)
+	case string:
+		sv.validateString(s, val, path)
+	default:
+		if f, ok := toFloat(v); ok {
+			sv.validateNumber(s, f, path)
+		}
+	}
+
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if m, ok := sub.(map[string]interface{}); ok {
+				sv.validate(m, v, path)
+			}
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		if sv.countMatches(anyOf, v, path) == 0 {
+			sv.fail(path, "value does not match any allowed schema (anyOf)")
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]interface{}); ok {
+		if n := sv.countMatches(oneOf, v, path); n != 1 {
+			sv.fail(path, "value must match exactly one schema (oneOf), matched %d", n)
+		}
+	}
+	if not, ok := s["not"].(map[string]interface{}); ok {
+		if sv.matches(not, v, path) {
+			sv.fail(path, "value must not match schema (not)")
+		}
+	}
+}
+
+func (sv *schemaValidator) validateObject(s map[string]interface{}, obj map[string]interface{}, path string) {
+	if req, ok := s["required"].([]interface{}); ok {
+		for _, r := range req {
+			k := fmt.Sprint(r)
+			if _, exists := obj[k]; !exists {
+				sv.fail(joinPath(path, k), "is required")
+			}
+		}
+	}
+	if n, ok := intKeyword(s, "minProperties"); ok && len(obj) < n {
+		sv.fail(path, "must have at least %d properties", n)
+	}
+	if n, ok := intKeyword(s, "maxProperties"); ok && len(obj) > n {
+		sv.fail(path, "must have at most %d properties", n)
+	}
+
+	props, _ := s["properties"].(map[string]interface{})
+	patProps, _ := s["patternProperties"].(map[string]interface{})
+	names, _ := s["propertyNames"].(map[string]interface{})
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := obj[k]
+		cp := joinPath(path, k)
+		if names != nil {
+			sv.validate(names, k, cp)
+		}
+		matched := false
+		if ps, ok := props[k].(map[string]interface{}); ok {
+			matched = true
+			sv.validate(ps, child, cp)
+		} else if b, ok := props[k].(bool); ok {
+			matched = true
+			if !b {
+				sv.fail(cp, "property is not allowed")
+			}
+		}
+		for pat, ps := range patProps {
+			re, err := regexp.Compile(pat)
+			if err != nil || !re.MatchString(k) {
+				continue
+			}
+			matched = true
+			if m, ok := ps.(map[string]interface{}); ok {
+				sv.validate(m, child, cp)
+			}
+		}
+		if matched {
+			continue
+		}
+		switch ap := s["additionalProperties"].(type) {
+		case bool:
+			if !ap {
+				sv.fail(cp, "unknown property%s", suggestKey(k, props))
+			}
+		case map[string]interface{}:
+			sv.validate(ap, child, cp)
+		}
+	}
+}
+
+func (sv *schemaValidator) validateArray(s map[string]interface{}, arr []interface{}, path string) {
+	if n, ok := intKeyword(s, "minItems"); ok && len(arr) < n {
+		sv.fail(path, "must have at least %d items", n)
+	}
+	if n, ok := intKeyword(s, "maxItems"); ok && len(arr) > n {
+		sv.fail(path, "must have at most %d items", n)
+	}
+	if u, ok := s["uniqueItems"].(bool); ok && u {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					sv.fail(indexPath(path, j), "duplicate of item %d", i)
+				}
+			}
+		}
+	}
+	start := 0
+	if prefix, ok := s["prefixItems"].([]interface{}); ok {
+		for i, ps := range prefix {
+			if i >= len(arr) {
+				break
+			}
+			if m, ok := ps.(map[string]interface{}); ok {
+				sv.validate(m, arr[i], indexPath(path, i))
+			}
+		}
+		start = len(prefix)
+	}
+	switch items := s["items"].(type) {
+	case map[string]interface{}:
+		for i := start; i < len(arr); i++ {
+			sv.validate(items, arr[i], indexPath(path, i))
+		}
+	case bool:
+		if !items && len(arr) > start {
+			sv.fail(path, "must have at most %d items", start)
+		}
+	}
+}
+
+func (sv *schemaValidator) validateString(s map[string]interface{}, str string, path string) {
+	n := len([]rune(str))
+	if min, ok := intKeyword(s, "minLength"); ok && n < min {
+		sv.fail(path, "must be at least %d characters", min)
+	}
+	if max, ok := intKeyword(s, "maxLength"); ok && n > max {
+		sv.fail(path, "must be at most %d characters", max)
+	}
+	if pat, ok := s["pattern"].(string); ok {
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			sv.fail(path, "invalid pattern in schema: %v", err)
+		} else if !re.MatchString(str) {
+			sv.fail(path, "value %q does not match pattern %q", str, pat)
+		}
+	}
+}
+
+func (sv *schemaValidator) validateNumber(s map[string]interface{}, f float64, path string) {
+	if m, ok := toFloat(s["minimum"]); ok && f < m {
+		sv.fail(path, "must be >= %v", m)
+	}
+	if m, ok := toFloat(s["maximum"]); ok && f > m {
+		sv.fail(path, "must be <= %v", m)
+	}
+	if m, ok := toFloat(s["exclusiveMinimum"]); ok && f <= m {
+		sv.fail(path, "must be > %v", m)
+	}
+	if m, ok := toFloat(s["exclusiveMaximum"]); ok && f >= m {
+		sv.fail(path, "must be < %v", m)
+	}
+	if m, ok := toFloat(s["multipleOf"]); ok && m != 0 {
+		if q := f / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			sv.fail(path, "must be a multiple of %v", m)
+		}
+	}
+}
+
+func (sv *schemaValidator) matches(s map[string]interface{}, v interface{}, path string) bool {
+	sub := &schemaValidator{root: sv.root}
+	sub.validate(s, v, path)
+	return len(sub.out) == 0
+}
+
+func (sv *schemaValidator) countMatches(list []interface{}, v interface{}, path string) int {
+	n := 0
+	for _, x := range list {
+		if m, ok := x.(map[string]interface{}); ok && sv.matches(m, v, path) {
+			n++
+		}
+	}
+	return n
+}
+
+// resolveRef supports "#" and JSON pointers into the root schema ("#/$defs/name").
+func (sv *schemaValidator) resolveRef(ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported $ref (only local refs): %s", ref)
+	}
+	var cur interface{} = map[string]interface{}(sv.root)
+	for _, tok := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if tok == "" {
+			continue
+		}
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref: %s", ref)
+		}
+		if cur, ok = m[tok]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref: %s", ref)
+		}
+	}
+	m, ok := cur.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("$ref does not point to a schema: %s", ref)
+	}
+	return m, nil
+}
+
+// ---- helpers ----
+
+func matchesType(t interface{}, v interface{}) bool {
+	switch tt := t.(type) {
+	case string:
+		return isType(tt, v)
+	case []interface{}:
+		for _, x := range tt {
+			if isType(fmt.Sprint(x), v) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isType(t string, v interface{}) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "number":
+		_, ok := toFloat(v)
+		return ok
+	case "integer":
+		f, ok := toFloat(v)
+		return ok && f == math.Trunc(f)
+	}
+	return false
+}
+
+func jsonType(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		if f, ok := toFloat(x); ok {
+			if f == math.Trunc(f) {
+				return "integer"
+			}
+			return "number"
+		}
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func typeList(t interface{}) string {
+	if arr, ok := t.([]interface{}); ok {
+		parts := make([]string, 0, len(arr))
+		for _, x := range arr {
+			parts = append(parts, fmt.Sprint(x))
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func intKeyword(s map[string]interface{}, k string) (int, bool) {
+	f, ok := toFloat(s[k])
+	return int(f), ok
+}
+
+// jsonEqual compares two decoded values, treating all numeric types alike.
+func jsonEqual(a, b interface{}) bool {
+	fa, aNum := toFloat(a)
+	fb, bNum := toFloat(b)
+	if aNum && bNum {
+		return fa == fb
+	}
+	am, aMap := a.(map[string]interface{})
+	bm, bMap := b.(map[string]interface{})
+	if aMap && bMap {
+		if len(am) != len(bm) {
+			return false
+		}
+		for k, av := range am {
+			bv, ok := bm[k]
+			if !ok || !jsonEqual(av, bv) {
+				return false
+			}
+		}
+		return true
+	}
+	aa, aArr := a.([]interface{})
+	ba, bArr := b.([]interface{})
+	if aArr && bArr {
+		if len(aa) != len(ba) {
+			return false
+		}
+		for i := range aa {
+			if !jsonEqual(aa[i], ba[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func render(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func indexPath(prefix string, i int) string {
+	return prefix + "[" + strconv.Itoa(i) + "]"
+}
+
+// suggestKey returns a "did you mean" hint for a misspelled property.
+func suggestKey(k string, props map[string]interface{}) string {
+	best, bestDist := "", 3
+	for p := range props {
+		if d := editDistance(k, p); d < bestDist {
+			best, bestDist = p, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
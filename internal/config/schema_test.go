@@ -0,0 +1,170 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func mustJSON(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("bad test JSON %s: %v", s, err)
+	}
+	return v
+}
+
+func TestSchemaValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema string
+		value  string
+		want   []string // Violation.String() values, in order
+	}{
+		{"type ok", `{"type": "string"}`, `"x"`, nil},
+		{"type mismatch", `{"type": "string"}`, `3`, []string{"(root): expected string, got integer"}},
+		{"type list", `{"type": ["string", "null"]}`, `null`, nil},
+		{"type list mismatch", `{"type": ["string", "null"]}`, `true`, []string{"(root): expected string or null, got boolean"}},
+		{"integer rejects fraction", `{"type": "integer"}`, `1.5`, []string{"(root): expected integer, got number"}},
+		{"integer accepts whole float", `{"type": "integer"}`, `2.0`, nil},
+
+		{"enum ok", `{"enum": ["a", 1]}`, `1`, nil},
+		{"enum mismatch", `{"enum": ["a", 1]}`, `"b"`, []string{`(root): value "b" is not one of ["a",1]`}},
+		{"const", `{"const": {"k": [1]}}`, `{"k": [2]}`, []string{`(root): value must be {"k":[1]}`}},
+
+		{
+			"nested properties",
+			`{"properties": {"server": {"properties": {"port": {"type": "integer", "maximum": 65535}}}}}`,
+			`{"server": {"port": 70000}}`,
+			[]string{"server.port: must be <= 65535"},
+		},
+		{
+			"required reports the missing key",
+			`{"properties": {"a": {"required": ["b", "c"]}}}`,
+			`{"a": {"c": 1}}`,
+			[]string{"a.b: is required"},
+		},
+		{
+			"additionalProperties false suggests a key",
+			`{"properties": {"version": {}}, "additionalProperties": false}`,
+			`{"verison": 1, "zzz": 2}`,
+			[]string{`verison: unknown property (did you mean "version"?)`, "zzz: unknown property"},
+		},
+		{
+			"additionalProperties schema",
+			`{"properties": {"a": {}}, "additionalProperties": {"type": "string"}}`,
+			`{"a": 1, "b": "ok", "c": 2}`,
+			[]string{"c: expected string, got integer"},
+		},
+		{
+			"patternProperties count as known",
+			`{"patternProperties": {"^x-": {"type": "boolean"}}, "additionalProperties": false}`,
+			`{"x-a": true, "x-b": 1, "y": 1}`,
+			[]string{"x-b: expected boolean, got integer", "y: unknown property"},
+		},
+		{"property false", `{"properties": {"old": false}}`, `{"old": 1}`, []string{"old: property is not allowed"}},
+
+		{"pattern ok", `{"pattern": "^[a-z]+$"}`, `"abc"`, nil},
+		{"pattern mismatch", `{"pattern": "^[a-z]+$"}`, `"aB"`, []string{`(root): value "aB" does not match pattern "^[a-z]+$"`}},
+		{"pattern invalid", `{"pattern": "("}`, `"x"`, []string{"(root): invalid pattern in schema: error parsing regexp: missing closing ): `(`"}},
+		{"length counts runes", `{"maxLength": 2}`, `"héé"`, []string{"(root): must be at most 2 characters"}},
+
+		{
+			"items paths",
+			`{"properties": {"list": {"items": {"type": "string"}, "uniqueItems": true}}}`,
+			`{"list": ["a", 1, "a"]}`,
+			[]string{"list[2]: duplicate of item 0", "list[1]: expected string, got integer"},
+		},
+		{
+			"prefixItems and closed items",
+			`{"prefixItems": [{"type": "string"}, {"type": "integer"}], "items": false}`,
+			`["a", "b", 3]`,
+			[]string{"[1]: expected integer, got string", "(root): must have at most 2 items"},
+		},
+
+		{
+			"$ref into $defs",
+			`{"$defs": {"port": {"type": "integer", "minimum": 1}}, "properties": {"p": {"$ref": "#/$defs/port"}}}`,
+			`{"p": 0}`,
+			[]string{"p: must be >= 1"},
+		},
+		{
+			"$ref escapes",
+			`{"$defs": {"a/b": {"type": "string"}}, "properties": {"p": {"$ref": "#/$defs/a~1b"}}}`,
+			`{"p": 1}`,
+			[]string{"p: expected string, got integer"},
+		},
+		{"$ref unresolvable", `{"$ref": "#/$defs/none"}`, `1`, []string{"(root): unresolvable $ref: #/$defs/none"}},
+		{"$ref remote", `{"$ref": "other.json"}`, `1`, []string{"(root): unsupported $ref (only local refs): other.json"}},
+		{
+			"recursive $ref",
+			`{"$defs": {"node": {"properties": {"v": {"type": "integer"}, "next": {"$ref": "#/$defs/node"}}}}, "$ref": "#/$defs/node"}`,
+			`{"v": 1, "next": {"v": 2, "next": {"v": "x"}}}`,
+			[]string{"next.next.v: expected integer, got string"},
+		},
+
+		{"anyOf ok", `{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `3`, nil},
+		{"anyOf mismatch", `{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `true`, []string{"(root): value does not match any allowed schema (anyOf)"}},
+		{
+			"anyOf path",
+			`{"properties": {"a": {"items": {"anyOf": [{"type": "string"}, {"minimum": 10}]}}}}`,
+			`{"a": ["x", 3]}`,
+			[]string{"a[1]: value does not match any allowed schema (anyOf)"},
+		},
+		{"oneOf ok", `{"oneOf": [{"type": "string"}, {"type": "integer"}]}`, `"s"`, nil},
+		{"oneOf none", `{"oneOf": [{"type": "string"}, {"type": "integer"}]}`, `null`, []string{"(root): value must match exactly one schema (oneOf), matched 0"}},
+		{"oneOf both", `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, `2`, []string{"(root): value must match exactly one schema (oneOf), matched 2"}},
+		{"not", `{"not": {"const": "root"}}`, `"root"`, []string{"(root): value must not match schema (not)"}},
+		{"allOf collects all", `{"allOf": [{"minimum": 5}, {"multipleOf": 2}]}`, `3`, []string{"(root): must be >= 5", "(root): must be a multiple of 2"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := Schema(mustJSON(t, tc.schema).(map[string]interface{}))
+			var got []string
+			for _, v := range s.Validate(mustJSON(t, tc.value), "") {
+				got = append(got, v.String())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("violations\n got: %q\nwant: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSchemaValidatePrefix(t *testing.T) {
+	s := Schema(mustJSON(t, `{"properties": {"port": {"type": "integer"}}}`).(map[string]interface{}))
+	vs := s.Validate(map[string]interface{}{"port": "80"}, "plugins.web")
+	if len(vs) != 1 || vs[0].Path != "plugins.web.port" {
+		t.Fatalf("got %v, want one violation at plugins.web.port", vs)
+	}
+}
+
+func TestSchemaValidateYAMLNumbers(t *testing.T) {
+	// YAML decodes integers as int, not float64 like JSON.
+	s := Schema(mustJSON(t, `{"type": "integer", "enum": [1, 2], "maximum": 1}`).(map[string]interface{}))
+	if vs := s.Validate(1, ""); len(vs) != 0 {
+		t.Errorf("int 1: %v", vs)
+	}
+	if vs := s.Validate(2, ""); len(vs) != 1 || vs[0].Message != "must be <= 1" {
+		t.Errorf("int 2: %v", vs)
+	}
+}
+
+func TestLyenvSchema(t *testing.T) {
+	s := LyenvSchema()
+	if vs := s.Validate(mustJSON(t, `{}`), ""); len(vs) != 0 {
+		t.Errorf("empty config: %v", vs)
+	}
+	var got []string
+	for _, v := range s.Validate(mustJSON(t, `{"env": {"vars": {"PATH": "/x"}}, "plugins": {"stroe": "copy"}}`), "") {
+		got = append(got, v.String())
+	}
+	want := []string{
+		"env.vars.PATH: value must not match schema (not)",
+		`plugins.stroe: unknown property (did you mean "store"?)`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("violations\n got: %q\nwant: %q", got, want)
+	}
+}
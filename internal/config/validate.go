@@ -0,0 +1,102 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//go:embed schema/lyenv.schema.json
+var lyenvSchemaJSON []byte
+
+// LyenvSchema returns the built-in schema for lyenv.yaml.
+func LyenvSchema() Schema {
+	var s Schema
+	if err := json.Unmarshal(lyenvSchemaJSON, &s); err != nil {
+		panic(fmt.Sprintf("embedded lyenv schema is invalid: %v", err))
+	}
+	return s
+}
+
+// NamespaceSchema is a schema contributed by a plugin for one subtree of lyenv.yaml.
+type NamespaceSchema struct {
+	Owner     string // install name of the contributing plugin
+	Namespace string // dot path inside lyenv.yaml
+	Schema    Schema
+}
+
+// SchemaProvider lists extra namespace schemas for an environment.
+type SchemaProvider func(envDir string) ([]NamespaceSchema, error)
+
+var schemaProviders []SchemaProvider
+
+// RegisterSchemaProvider adds a source of namespace schemas (the plugin
+// package registers one that reads installed manifests).
+func RegisterSchemaProvider(p SchemaProvider) {
+	schemaProviders = append(schemaProviders, p)
+}
+
+// ValidateConfig checks a decoded lyenv.yaml against the built-in schema and
+// every registered namespace schema.
+func ValidateConfig(envDir string, m map[string]interface{}) []Violation {
+	out := LyenvSchema().Validate(m, "")
+	for _, p := range schemaProviders {
+		list, err := p(envDir)
+		if err != nil {
+			out = append(out, Violation{Message: fmt.Sprintf("failed to load plugin schemas: %v", err)})
+			continue
+		}
+		for _, ns := range list {
+			val, ok := GetByPath(m, ns.Namespace)
+			if !ok {
+				continue
+			}
+			for _, v := range ns.Schema.Validate(val, ns.Namespace) {
+				v.Message = fmt.Sprintf("%s (schema of plugin %s)", v.Message, ns.Owner)
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+// checkConfig rejects a candidate lyenv.yaml that introduces violations not
+// already present in the previous version, so that a pre-existing problem
+// does not block unrelated edits.
+func checkConfig(envDir string, before, after map[string]interface{}) error {
+	seen := map[string]bool{}
+	if before != nil {
+		for _, v := range ValidateConfig(envDir, before) {
+			seen[v.String()] = true
+		}
+	}
+	var fresh []Violation
+	for _, v := range ValidateConfig(envDir, after) {
+		if !seen[v.String()] {
+			fresh = append(fresh, v)
+		}
+	}
+	return ViolationsError(fresh)
+}
+
+// checkDocument validates a modified Document against the original map.
+func checkDocument(envDir string, before map[string]interface{}, doc *Document) error {
+	after, err := doc.Map()
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	return checkConfig(envDir, before, after)
+}
+
+// ViolationsError folds violations into a single error (nil when empty).
+func ViolationsError(vs []Violation) error {
+	if len(vs) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(vs))
+	for _, v := range vs {
+		lines = append(lines, "  - "+v.String())
+	}
+	return fmt.Errorf("config validation failed:\n%s", strings.Join(lines, "\n"))
+}
@@ -1,7 +1,6 @@
 package config
 
 import (
-	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -37,39 +36,13 @@ func IsJSON(path string) bool {
 	return ext == ".json"
 }
 
+// LoadAny decodes a config file in the format detected from its name
+// (YAML, JSON, TOML, dotenv or INI; YAML when unknown).
 func LoadAny(path string) (map[string]interface{}, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	var m map[string]interface{}
-	if IsJSON(path) {
-		if err := json.Unmarshal(data, &m); err != nil {
-			return nil, err
-		}
-	} else {
-		if err := yaml.Unmarshal(data, &m); err != nil {
-			return nil, err
-		}
-	}
-	if m == nil {
-		m = make(map[string]interface{})
-	}
-	return m, nil
+	return LoadFile(path, "")
 }
 
+// SaveAny encodes v in the format detected from the file name.
 func SaveAny(path string, v interface{}) error {
-	var (
-		out []byte
-		err error
-	)
-	if IsJSON(path) {
-		out, err = json.MarshalIndent(v, "", "  ")
-	} else {
-		out, err = yaml.Marshal(v)
-	}
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(path, out, 0o644)
+	return SaveFile(path, "", v)
 }
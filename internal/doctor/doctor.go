@@ -0,0 +1,401 @@
+// Package doctor diagnoses an environment and repairs what it can.
+package doctor
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"lyenv/internal/env"
+	"lyenv/internal/migrate"
+	"lyenv/internal/plugin"
+)
+
+// Severities of an Issue.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Issue is one finding. Fixable issues carry the repair run by --fix.
+type Issue struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Subject  string `json:"subject"`
+	Message  string `json:"message"`
+	Fixable  bool   `json:"fixable"`
+	Fixed    bool   `json:"fixed"`
+	FixError string `json:"fix_error,omitempty"`
+
+	fix func() error
+}
+
+func (i Issue) String() string {
+	s := fmt.Sprintf("[%s] %s: %s: %s", i.Severity, i.Check, i.Subject, i.Message)
+	switch {
+	case i.Fixed:
+		s += " (fixed)"
+	case i.FixError != "":
+		s += " (fix failed: " + i.FixError + ")"
+	case i.Fixable:
+		s += " (fixable with --fix)"
+	}
+	return s
+}
+
+// Report is the result of Run.
+type Report struct {
+	Env    string  `json:"env"`
+	Issues []Issue `json:"issues"`
+}
+
+// Failed reports whether errors remain after any fixes.
+func (r *Report) Failed() bool {
+	for _, i := range r.Issues {
+		if i.Severity == SeverityError && !i.Fixed {
+			return true
+		}
+	}
+	return false
+}
+
+type checker struct {
+	home   string
+	issues []Issue
+}
+
+func (c *checker) add(check, severity, subject, message string, fix func() error) {
+	c.issues = append(c.issues, Issue{Check: check, Severity: severity, Subject: subject, Message: message, Fixable: fix != nil, fix: fix})
+}
+
+// Run checks the environment at envDir. With fix, repairs are applied in the
+// order the issues were found.
+func Run(envDir string, fix bool) (*Report, error) {
+	home, err := filepath.Abs(envDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve environment directory: %w", err)
+	}
+	c := &checker{home: home}
+	c.checkStructure()
+	c.checkLayout()
+	c.checkTools()
+	c.checkPlugins()
+	c.checkConfig()
+	if fix {
+		for i := range c.issues {
+			if c.issues[i].fix == nil {
+				continue
+			}
+			if err := c.issues[i].fix(); err != nil {
+				c.issues[i].FixError = err.Error()
+			} else {
+				c.issues[i].Fixed = true
+			}
+		}
+	}
+	if c.issues == nil {
+		c.issues = []Issue{}
+	}
+	return &Report{Env: home, Issues: c.issues}, nil
+}
+
+func (c *checker) checkStructure() {
+	for _, d := range []string{".lyenv", filepath.Join(".lyenv", "logs"), filepath.Join(".lyenv", "registry"), "bin", "cache", "plugins", "workspace"} {
+		p := filepath.Join(c.home, d)
+		if st, err := os.Stat(p); err != nil || !st.IsDir() {
+			c.add("structure", SeverityError, d, "directory is missing", func() error { return os.MkdirAll(p, 0o755) })
+		}
+	}
+	files := []struct{ rel, content string }{
+		{filepath.Join(".lyenv", "version"), env.VersionFileContent(1)}, // unknown layout: migrate from the oldest
+		{filepath.Join(".lyenv", "registry", "installed.yaml"), "plugins: []\n"},
+		{"lyenv.yaml", env.DefaultLyenvYAML()},
+	}
+	for _, f := range files {
+		p, content := filepath.Join(c.home, f.rel), f.content
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			c.add("structure", SeverityError, f.rel, "file is missing", func() error {
+				if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+					return err
+				}
+				return env.WriteFileIfNotExists(p, content, 0o644)
+			})
+		}
+	}
+}
+
+// tool is an external program lyenv relies on; any of names satisfies it.
+type tool struct {
+	names    []string
+	severity string
+	why      string
+}
+
+func (c *checker) checkLayout() {
+	behind, err := migrate.Check(c.home)
+	if err != nil {
+		c.add("layout", SeverityError, ".lyenv/version", err.Error(), nil)
+		return
+	}
+	if behind > 0 {
+		c.add("layout", SeverityWarning, ".lyenv/version", fmt.Sprintf("layout is %d version(s) behind %d", behind, env.LayoutVersion), func() error {
+			_, err := migrate.Run(c.home)
+			return err
+		})
+	}
+}
+
+func (c *checker) checkTools() {
+	tools := []tool{
+		{[]string{"git"}, SeverityWarning, "needed to install plugins from git and the plugin center"},
+		{[]string{"curl", "wget"}, SeverityWarning, "needed to download plugin archives and the center index"},
+		{[]string{"tar"}, SeverityWarning, "needed to extract .tgz plugin archives"},
+	}
+	if runtime.GOOS != "windows" {
+		tools = append(tools, tool{[]string{"bash"}, SeverityError, "shims in bin/ are bash scripts"})
+	}
+	for _, t := range tools {
+		found := false
+		for _, n := range t.names {
+			if _, err := exec.LookPath(n); err == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.add("tools", t.severity, strings.Join(t.names, "|"), "not found in PATH; "+t.why, nil)
+		}
+	}
+}
+
+func (c *checker) checkPlugins() {
+	r, err := plugin.LoadRegistry(c.home)
+	if err != nil {
+		c.add("registry", SeverityError, ".lyenv/registry/installed.yaml", err.Error(), nil)
+		return
+	}
+	// shim name -> install name, from registered plugins with valid manifests
+	expected := map[string]string{}
+	exposes := map[string][]string{}
+	registered := map[string]bool{}
+	for _, ip := range r.Plugins {
+		ip := ip
+		registered[ip.InstallName] = true
+		dir := filepath.Join(c.home, "plugins", ip.InstallName)
+		if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+			c.add("registry", SeverityError, ip.InstallName, "registered but plugins/"+ip.InstallName+" is missing", func() error {
+				if err := plugin.UnregisterByInstallName(c.home, ip.InstallName); err != nil {
+					return err
+				}
+				return plugin.ReleaseShims(c.home, ip.InstallName, ip.Shims)
+			})
+			continue
+		}
+		man, err := loadValidManifest(dir)
+		if err != nil {
+			c.add("manifest", SeverityError, ip.InstallName, err.Error(), nil)
+			continue
+		}
+		// A shim belongs to the install recording it; side-by-side installs
+		// of one plugin do not each get the shims they expose
+		for _, e := range man.Expose {
+			if _, taken := expected[e]; !taken || slices.Contains(ip.Shims, e) {
+				expected[e] = ip.InstallName
+			}
+		}
+		c.checkPluginFiles(ip.InstallName, dir)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(c.home, "plugins"))
+	for _, e := range entries {
+		if !e.IsDir() || registered[e.Name()] {
+			continue
+		}
+		name, dir := e.Name(), filepath.Join(c.home, "plugins", e.Name())
+		man, err := loadValidManifest(dir)
+		if err != nil {
+			c.add("registry", SeverityWarning, name, "plugins/"+name+" is not registered and has no valid manifest: "+err.Error(), nil)
+			continue
+		}
+		c.add("registry", SeverityWarning, name, "plugins/"+name+" is not registered", func() error {
+			shims, _, err := plugin.SyncShims(c.home, name, nil, man.Expose)
+			if err != nil {
+				return err
+			}
+			r, err := plugin.LoadRegistry(c.home)
+			if err != nil {
+				return err
+			}
+			r.Plugins = append(r.Plugins, plugin.InstalledPlugin{
+				Name: man.Name, InstallName: name, Version: man.Version, Source: "local",
+				Shims: shims, InstalledAt: time.Now().UTC(),
+			})
+			return plugin.SaveRegistry(c.home, r)
+		})
+	}
+
+	for shim, install := range expected {
+		exposes[install] = append(exposes[install], shim)
+	}
+	c.checkShims(expected, exposes)
+}
+
+func loadValidManifest(dir string) (*plugin.PluginManifest, error) {
+	man, err := plugin.LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := plugin.ValidateManifestStruct(man); err != nil {
+		return nil, err
+	}
+	return man, nil
+}
+
+func (c *checker) checkShims(expected map[string]string, exposes map[string][]string) {
+	binDir := filepath.Join(c.home, "bin")
+	regen := func(install string) func() error {
+		return func() error { return plugin.CreateShims(c.home, install, exposes[install]) }
+	}
+	seen := map[string]bool{}
+	entries, _ := os.ReadDir(binDir)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		file := e.Name()
+		p := filepath.Join(binDir, file)
+		shim := strings.TrimSuffix(strings.TrimSuffix(file, ".cmd"), ".ps1")
+		install, pinned, ok := plugin.ReadShim(p)
+		if !ok {
+			continue // not generated by lyenv
+		}
+		want, exposed := expected[shim]
+		switch {
+		case !exposed:
+			c.add("shims", SeverityWarning, "bin/"+file, fmt.Sprintf("dangling shim for %q, which no installed plugin exposes", install), func() error {
+				// An earlier fix (releasing a missing plugin's shims) may have removed it
+				if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				return nil
+			})
+			continue
+		case install != want:
+			c.add("shims", SeverityError, "bin/"+file, fmt.Sprintf("bound to install name %q, expected %q", install, want), regen(want))
+		case pinned == "":
+			c.add("shims", SeverityWarning, "bin/"+file, "not pinned to this environment (generated by an older lyenv)", regen(want))
+		case filepath.Clean(pinned) != c.home:
+			c.add("shims", SeverityError, "bin/"+file, "pinned to another environment: "+pinned, regen(want))
+		}
+		seen[shim] = true
+		if runtime.GOOS != "windows" && !strings.Contains(file, ".") {
+			if st, err := os.Stat(p); err == nil && st.Mode().Perm()&0o111 == 0 {
+				c.add("permissions", SeverityError, "bin/"+file, "shim is not executable", func() error { return os.Chmod(p, 0o755) })
+			}
+		}
+	}
+	names := make([]string, 0, len(expected))
+	for n := range expected {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if !seen[n] {
+			c.add("shims", SeverityError, "bin/"+n, fmt.Sprintf("missing shim for plugin %q", expected[n]), regen(expected[n]))
+		}
+	}
+}
+
+// checkPluginFiles verifies scripts with a shebang: the interpreter must
+// exist and the file must be executable.
+func (c *checker) checkPluginFiles(install, dir string) {
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != dir && d.Name() == "logs" && filepath.Dir(p) == dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		interp, ok := readShebang(p)
+		if !ok {
+			return nil
+		}
+		rel, _ := filepath.Rel(c.home, p)
+		if interp != "" && !interpreterExists(interp) {
+			c.add("interpreters", SeverityError, filepath.ToSlash(rel), "interpreter not found: "+interp, nil)
+		}
+		if runtime.GOOS != "windows" {
+			if st, err := os.Stat(p); err == nil && st.Mode().Perm()&0o111 == 0 {
+				c.add("permissions", SeverityError, filepath.ToSlash(rel), "script with shebang is not executable", func() error {
+					return os.Chmod(p, st.Mode().Perm()|0o755)
+				})
+			}
+		}
+		return nil
+	})
+}
+
+// readShebang returns the interpreter named by a "#!" line: the program, or
+// for "/usr/bin/env [-S] prog" the program env would run.
+func readShebang(p string) (string, bool) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return "", false
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return "", true
+	}
+	if filepath.Base(fields[0]) == "env" {
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+				return f, true
+			}
+		}
+	}
+	return fields[0], true
+}
+
+func interpreterExists(interp string) bool {
+	if filepath.IsAbs(interp) && runtime.GOOS != "windows" {
+		st, err := os.Stat(interp)
+		return err == nil && !st.IsDir()
+	}
+	_, err := exec.LookPath(filepath.Base(interp))
+	return err == nil
+}
+
+func (c *checker) checkConfig() {
+	vs, err := plugin.ValidateEnvConfig(c.home)
+	if err != nil {
+		c.add("config", SeverityError, "lyenv.yaml", err.Error(), nil)
+		return
+	}
+	for _, v := range vs {
+		subject := v.File
+		if subject == "" {
+			subject = "lyenv.yaml"
+		}
+		path := v.Path
+		if path == "" {
+			path = "(root)"
+		}
+		c.add("config", SeverityError, subject, path+": "+v.Message, nil)
+	}
+}
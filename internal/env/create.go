@@ -3,25 +3,28 @@ package env
 import (
 	"errors"
 	"fmt"
-	"lyenv/internal/version"
 	"os"
 	"path/filepath"
 	"time"
 )
 
+// DefaultLyenvYAML is the lyenv.yaml written by create and init when no
+// template provides one.
 func DefaultLyenvYAML() string {
-	return `version: "1.0"
-config:
-  network:
-    proxy_url: ""
-  workspace:
-    root: "./workspace"
-  logs:
-    dispatch_dir: ".lyenv/logs"
+	return `env:
+  name: "default"
+  platform: "auto"        # auto-detect system platform
+path:
+  bin: "./bin"
+  cache: "./cache"
+  workspace: "./workspace"
 plugins:
   registry_url: "https://raw.githubusercontent.com/systemnb/lyenv-plugin-center/main/index.yaml"
   registry_format: "yaml"
   default_version_strategy: "latest"
+config:
+  use_container: false
+  pkg_manager: "auto"     # auto-detect package manager
 `
 }
 
@@ -66,17 +69,13 @@ func CmdCreate(dir string) error {
 	}
 
 	// Write metadata
-	if err := WriteFileIfNotExists(filepath.Join(absDir, ".lyenv", "version"), version.Version+"\n", 0o644); err != nil {
+	if err := WriteFileIfNotExists(VersionFile(absDir), VersionFileContent(LayoutVersion), 0o644); err != nil {
 		return fmt.Errorf("failed to write .lyenv/version: %w", err)
 	}
-	stateJSON := `{
-  "created_at": "` + time.Now().Local().String() + `",
-  "components": [],
-  "notes": ""
-}
-`
-	if err := WriteFileIfNotExists(filepath.Join(absDir, ".lyenv", "state.json"), stateJSON, 0o644); err != nil {
-		return fmt.Errorf("failed to write .lyenv/state.json: %w", err)
+	if _, err := os.Stat(StateFile(absDir)); os.IsNotExist(err) {
+		if err := SaveState(absDir, &State{CreatedAt: time.Now().UTC().Format(time.RFC3339)}); err != nil {
+			return err
+		}
 	}
 
 	// Initialize registry file (empty list)
@@ -84,27 +83,11 @@ func CmdCreate(dir string) error {
 		return fmt.Errorf("failed to write .lyenv/registry/installed.yaml: %w", err)
 	}
 
-	// Default environment configuration (augmented with plugin center settings)
-	defaultCfg := `env:
-  name: "default"
-  platform: "auto"        # auto-detect system platform
-path:
-  bin: "./bin"
-  cache: "./cache"
-  workspace: "./workspace"
-plugins:
-  installed: []
-  registry_url: "https://raw.githubusercontent.com/systemnb/lyenv-plugin-center/main/index.yaml"
-  registry_format: "yaml"
-  default_version_strategy: "latest"
-config:
-  use_container: false
-  pkg_manager: "auto"     # auto-detect package manager
-`
 	cfgPath := filepath.Join(absDir, "lyenv.yaml")
-	if err := WriteFileIfNotExists(cfgPath, defaultCfg, 0o644); err != nil {
+	if err := WriteFileIfNotExists(cfgPath, DefaultLyenvYAML(), 0o644); err != nil {
 		return fmt.Errorf("failed to write lyenv.yaml: %w", err)
 	}
+	registerIndex(absDir)
 
 	return nil
 }
@@ -143,84 +126,51 @@ func CmdInit(dir string) error {
 		}
 	}
 
-	// Ensure metadata files exist
-	if err := WriteFileIfNotExists(filepath.Join(absDir, ".lyenv", "version"), version.Version+"\n", 0o644); err != nil {
+	// Ensure metadata files exist. An existing environment without a version
+	// file predates layout versioning, so it starts at layout 1 and is migrated.
+	layout := LayoutVersion
+	if _, err := os.Stat(filepath.Join(absDir, "lyenv.yaml")); err == nil {
+		layout = 1
+	}
+	if err := WriteFileIfNotExists(VersionFile(absDir), VersionFileContent(layout), 0o644); err != nil {
 		return fmt.Errorf("failed to write .lyenv/version: %w", err)
 	}
-	// Merge or create state.json with initialized_at (simple append if missing)
-	statePath := filepath.Join(absDir, ".lyenv", "state.json")
-	_ = EnsureInitializedAt(statePath)
+	// Merge or create state.json with initialized_at
+	_ = EnsureInitializedAt(absDir)
 
 	// Initialize registry file if missing
 	_ = WriteFileIfNotExists(filepath.Join(absDir, ".lyenv", "registry", "installed.yaml"), "plugins: []\n", 0o644)
 
-	// Ensure main config exists (augmented with plugin center settings)
-	defaultCfg := `env:
-  name: "default"
-  platform: "auto"        # auto-detect system platform
-path:
-  bin: "./bin"
-  cache: "./cache"
-  workspace: "./workspace"
-plugins:
-  installed: []
-  registry_url: "https://raw.githubusercontent.com/systemnb/lyenv-plugin-center/main/index.yaml"
-  registry_format: "yaml"
-  default_version_strategy: "latest"
-config:
-  use_container: false
-  pkg_manager: "auto"     # auto-detect package manager
-`
-	if err := WriteFileIfNotExists(filepath.Join(absDir, "lyenv.yaml"), defaultCfg, 0o644); err != nil {
+	// Ensure main config exists
+	if err := WriteFileIfNotExists(filepath.Join(absDir, "lyenv.yaml"), DefaultLyenvYAML(), 0o644); err != nil {
 		return fmt.Errorf("failed to write lyenv.yaml: %w", err)
 	}
 
+	registerIndex(absDir)
+
 	fmt.Println("OK: structure verified")
 	return nil
 }
 
-// ensureInitializedAt writes/updates initialized_at in state.json (best-effort).
-func EnsureInitializedAt(statePath string) error {
-	now := time.Now().UTC().Format(time.RFC3339)
-	// If not exists, create a minimal state.json with initialized_at
-	_, err := os.Stat(statePath)
-	if errors.Is(err, os.ErrNotExist) {
-		content := `{
-  "created_at": "` + now + `",
-  "initialized_at": "` + now + `",
-  "components": [],
-  "notes": ""
-}
-`
-		return os.WriteFile(statePath, []byte(content), 0o644)
-	}
-	// If exists, append a simple marker file next to it to avoid full JSON merge complexity in MVP
-	marker := statePath + ".initialized"
-	return os.WriteFile(marker, []byte(now+"\n"), 0o644)
+// EnsureInitializedAt sets initialized_at in state.json, creating the file
+// when it is missing and keeping every other field.
+func EnsureInitializedAt(home string) error {
+	return UpdateState(home, func(s *State) error {
+		now := time.Now().UTC().Format(time.RFC3339)
+		if s.CreatedAt == "" {
+			s.CreatedAt = now
+		}
+		s.InitializedAt = now
+		return nil
+	})
 }
 
-// cmdActivate prints a snippet to activate the lyenv environment.
-func CmdActivate() error {
-	// Use current working directory as LYENV_HOME
-	cwd, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get current working directory: %w", err)
-	}
-	bin := filepath.Join(cwd, "bin")
-
-	// Print shell snippet (bash/zsh compatible). User should: eval "$(lyenv activate)"
-	// NOTE: PS1 may be undefined in non-interactive shells; guard it to avoid 'unbound variable' with 'set -u'.
-	fmt.Printf("export LYENV_HOME=%q\n", cwd)
-	fmt.Printf("export PATH=%q:$PATH\n", bin)
-	fmt.Println(`export LYENV_ACTIVE=1`)
-	fmt.Println(`if [ -z "${LYENV_PROMPT_APPLIED+x}" ]; then`)
-	fmt.Println(`  export LYENV_PROMPT_APPLIED=1`)
-	fmt.Println(`  # Only modify PS1 if it is defined (handles 'set -u' non-interactive shells).`)
-	fmt.Println(`  if [ -n "${PS1+x}" ]; then`)
-	fmt.Println(`    export PS1="(lyenv) ${PS1}"`)
-	fmt.Println(`  fi`)
-	fmt.Println(`fi`)
-	return nil
+// registerIndex records the environment in the user-level index; a failure
+// (e.g. a read-only home) does not fail create or init.
+func registerIndex(dir string) {
+	if _, err := Register(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: environment not added to the index: %v\n", err)
+	}
 }
 
 // isLyenvDir checks if the directory already looks like a lyenv environment.
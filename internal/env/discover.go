@@ -0,0 +1,59 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Resolve locates the environment a command operates on, as an absolute
+// path. Precedence: explicit dir (global --env flag), then $LYENV_HOME, then
+// the nearest ancestor of the working directory that looks like an
+// environment (lyenv.yaml or .lyenv/version).
+func Resolve(explicit string) (string, error) {
+	if d := strings.TrimSpace(explicit); d != "" {
+		return checkEnvDir(d, "--env")
+	}
+	if d := strings.TrimSpace(os.Getenv("LYENV_HOME")); d != "" {
+		return checkEnvDir(d, "LYENV_HOME")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current working directory: %w", err)
+	}
+	if d, ok := Discover(cwd); ok {
+		return d, nil
+	}
+	return "", fmt.Errorf("not inside a lyenv environment: %s (use --env=<DIR> or set LYENV_HOME)", cwd)
+}
+
+// Discover walks up from start and returns the first directory that looks
+// like a lyenv environment.
+func Discover(start string) (string, bool) {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return "", false
+	}
+	for {
+		if IsLyenvDir(dir) {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func checkEnvDir(dir, source string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid environment directory from %s: %w", source, err)
+	}
+	if !IsLyenvDir(abs) {
+		return "", fmt.Errorf("not a lyenv environment (from %s): %s", source, abs)
+	}
+	return abs, nil
+}
@@ -0,0 +1,279 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IndexEntry is one known environment in the user-level index.
+type IndexEntry struct {
+	Name    string `yaml:"name" json:"name"`
+	Path    string `yaml:"path" json:"path"`
+	AddedAt string `yaml:"added_at,omitempty" json:"added_at,omitempty"`
+}
+
+type indexDoc struct {
+	Environments []IndexEntry `yaml:"environments"`
+}
+
+var indexName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// IndexFile lists the environments created or initialized by this user.
+func IndexFile() string {
+	return filepath.Join(UserConfigDir(), "environments.yaml")
+}
+
+// LoadIndex returns the indexed environments sorted by name.
+func LoadIndex() ([]IndexEntry, error) {
+	data, err := os.ReadFile(IndexFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environment index: %w", err)
+	}
+	var doc indexDoc
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid environment index %s: %w", IndexFile(), err)
+	}
+	sort.Slice(doc.Environments, func(i, j int) bool { return doc.Environments[i].Name < doc.Environments[j].Name })
+	return doc.Environments, nil
+}
+
+// LookupIndex finds an environment by index name or by directory.
+func LookupIndex(nameOrDir string) (IndexEntry, error) {
+	list, err := LoadIndex()
+	if err != nil {
+		return IndexEntry{}, err
+	}
+	for _, e := range list {
+		if e.Name == nameOrDir {
+			return e, nil
+		}
+	}
+	if abs, err := filepath.Abs(nameOrDir); err == nil {
+		for _, e := range list {
+			if e.Path == abs {
+				return e, nil
+			}
+		}
+	}
+	return IndexEntry{}, fmt.Errorf("environment not found in index: %s (see `lyenv env list`)", nameOrDir)
+}
+
+// Register adds an environment to the index under its directory name (with
+// a numeric suffix on clashes). Registering a known path keeps its entry.
+func Register(dir string) (IndexEntry, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return IndexEntry{}, fmt.Errorf("failed to resolve directory: %w", err)
+	}
+	var out IndexEntry
+	err = updateIndex(func(list []IndexEntry) ([]IndexEntry, error) {
+		taken := map[string]bool{}
+		for _, e := range list {
+			if e.Path == abs {
+				out = e
+				return list, nil
+			}
+			taken[e.Name] = true
+		}
+		base := sanitizeIndexName(filepath.Base(abs))
+		name := base
+		for i := 2; taken[name]; i++ {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		out = IndexEntry{Name: name, Path: abs, AddedAt: time.Now().UTC().Format(time.RFC3339)}
+		return append(list, out), nil
+	})
+	return out, err
+}
+
+// Unregister drops an environment from the index.
+func Unregister(nameOrDir string) (IndexEntry, error) {
+	e, err := LookupIndex(nameOrDir)
+	if err != nil {
+		return e, err
+	}
+	return e, updateIndex(func(list []IndexEntry) ([]IndexEntry, error) {
+		out := list[:0]
+		for _, x := range list {
+			if x.Path != e.Path {
+				out = append(out, x)
+			}
+		}
+		return out, nil
+	})
+}
+
+// RenameIndex changes the index name of an environment; its directory stays.
+func RenameIndex(nameOrDir, newName string) (IndexEntry, error) {
+	if !indexName.MatchString(newName) {
+		return IndexEntry{}, fmt.Errorf("invalid environment name: %q (letters, digits, '.', '_', '-')", newName)
+	}
+	e, err := LookupIndex(nameOrDir)
+	if err != nil {
+		return e, err
+	}
+	err = updateIndex(func(list []IndexEntry) ([]IndexEntry, error) {
+		for _, x := range list {
+			if x.Name == newName && x.Path != e.Path {
+				return nil, fmt.Errorf("environment name already in use: %s (%s)", newName, x.Path)
+			}
+		}
+		for i := range list {
+			if list[i].Path == e.Path {
+				list[i].Name = newName
+			}
+		}
+		return list, nil
+	})
+	e.Name = newName
+	return e, err
+}
+
+func sanitizeIndexName(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '.' || r == '_' || r == '-' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	name := strings.TrimLeft(b.String(), ".-_")
+	if name == "" {
+		return "env"
+	}
+	return name
+}
+
+func updateIndex(fn func([]IndexEntry) ([]IndexEntry, error)) error {
+	if err := os.MkdirAll(UserConfigDir(), 0o700); err != nil {
+		return fmt.Errorf("failed to create user config dir: %w", err)
+	}
+	unlock, err := LockFile(IndexFile() + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	list, err := LoadIndex()
+	if err != nil {
+		return err
+	}
+	if list, err = fn(list); err != nil {
+		return err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	data, err := yaml.Marshal(indexDoc{Environments: list})
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(IndexFile(), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write environment index: %w", err)
+	}
+	return nil
+}
+
+// IndexStatus is an indexed environment as shown by `lyenv env list`.
+type IndexStatus struct {
+	IndexEntry
+	Active  bool  `json:"active"`
+	Missing bool  `json:"missing"`
+	Plugins int   `json:"plugins"`
+	Size    int64 `json:"size_bytes"`
+}
+
+// IndexStatuses reports every indexed environment: whether it is the one
+// activated in this shell ($LYENV_HOME), its installed plugin count and
+// its disk usage.
+func IndexStatuses() ([]IndexStatus, error) {
+	list, err := LoadIndex()
+	if err != nil {
+		return nil, err
+	}
+	active := ""
+	if h := strings.TrimSpace(os.Getenv("LYENV_HOME")); h != "" {
+		active, _ = filepath.Abs(h)
+	}
+	out := make([]IndexStatus, 0, len(list))
+	for _, e := range list {
+		st := IndexStatus{IndexEntry: e, Active: e.Path == active}
+		if !IsLyenvDir(e.Path) {
+			st.Missing = true
+			out = append(out, st)
+			continue
+		}
+		st.Plugins = countPlugins(e.Path)
+		st.Size = diskUsage(e.Path)
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// RemoveEnv deletes an indexed environment's directory (unless keepFiles)
+// and drops it from the index and the trust file.
+func RemoveEnv(e IndexEntry, keepFiles bool) error {
+	if !keepFiles {
+		if _, err := os.Stat(e.Path); err == nil {
+			if !IsLyenvDir(e.Path) {
+				return fmt.Errorf("refusing to delete %s: not a lyenv environment (use --keep-files to only forget it)", e.Path)
+			}
+			if err := os.RemoveAll(e.Path); err != nil {
+				return fmt.Errorf("failed to delete environment: %w", err)
+			}
+		}
+	}
+	if _, err := Deny(e.Path); err != nil {
+		return err
+	}
+	_, err := Unregister(e.Path)
+	return err
+}
+
+func countPlugins(home string) int {
+	data, err := os.ReadFile(filepath.Join(home, ".lyenv", "registry", "installed.yaml"))
+	if err != nil {
+		return 0
+	}
+	var reg struct {
+		Plugins []yaml.Node `yaml:"plugins"`
+	}
+	if yaml.Unmarshal(data, &reg) != nil {
+		return 0
+	}
+	return len(reg.Plugins)
+}
+
+// diskUsage sums the sizes of regular files under dir (best-effort).
+func diskUsage(dir string) int64 {
+	var n int64
+	_ = filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			n += fi.Size()
+		}
+		return nil
+	})
+	return n
+}
+
+// HumanSize formats a byte count with binary units (e.g. "12.3 MiB").
+func HumanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,77 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"lyenv/internal/version"
+)
+
+// LayoutVersion is the on-disk layout written by this binary. Older
+// environments are upgraded by the migrations in internal/migrate.
+const LayoutVersion = 2
+
+// VersionFile records the layout version of an environment.
+func VersionFile(home string) string {
+	return filepath.Join(home, ".lyenv", "version")
+}
+
+// VersionFileContent renders .lyenv/version for a layout.
+func VersionFileContent(layout int) string {
+	return fmt.Sprintf("layout: %d\nlyenv: %s\n", layout, version.Version)
+}
+
+// ReadLayout returns the layout version of the environment at home. Files
+// written before layouts were versioned hold only the lyenv version and are
+// layout 1; so is an environment whose version file is missing.
+func ReadLayout(home string) (int, error) {
+	data, err := os.ReadFile(VersionFile(home))
+	if os.IsNotExist(err) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read .lyenv/version: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(k) != "layout" {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid layout in .lyenv/version: %q", strings.TrimSpace(v))
+		}
+		return n, nil
+	}
+	return 1, nil
+}
+
+// WriteLayout records the layout version of the environment at home.
+func WriteLayout(home string, layout int) error {
+	return WriteFileAtomic(VersionFile(home), []byte(VersionFileContent(layout)), 0o644)
+}
+
+// WriteFileAtomic replaces path via a temporary file in the same directory,
+// so readers never observe a partially written file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
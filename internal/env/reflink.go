@@ -0,0 +1,27 @@
+package env
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// ReflinkTree clones a directory copy-on-write with the platform cp
+// (GNU cp --reflink on Linux, clonefile via cp -c on macOS). It reports
+// false, leaving nothing behind, when the filesystem cannot do it.
+func ReflinkTree(src, dst string) bool {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("cp", "-a", "--reflink=always", src, dst)
+	case "darwin":
+		cmd = exec.Command("cp", "-c", "-R", "-p", src, dst)
+	default:
+		return false
+	}
+	if err := cmd.Run(); err != nil {
+		_ = os.RemoveAll(dst)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package env
+
+import "bytes"
+
+// MaxRewrite caps the size of files scanned for an environment path when an
+// environment is cloned or imported elsewhere.
+const MaxRewrite = 4 << 20
+
+// pathByte reports whether c can continue a path component, so that a match
+// of "/tmp/e2" inside "/tmp/e20" or "/x/tmp/e2" is not taken for the path.
+func pathByte(c byte) bool {
+	return c >= 0x80 || c == '.' || c == '-' || c == '_' ||
+		('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// indexPath returns the offset of the next whole occurrence of old in data
+// at or after from, or -1.
+func indexPath(data, old []byte, from int) int {
+	for from <= len(data)-len(old) {
+		i := bytes.Index(data[from:], old)
+		if i < 0 {
+			return -1
+		}
+		i += from
+		end := i + len(old)
+		if (i == 0 || !pathByte(data[i-1])) && (end == len(data) || !pathByte(data[end])) {
+			return i
+		}
+		from = i + 1
+	}
+	return -1
+}
+
+// ContainsPath reports whether text data mentions the path old. Binary data
+// (anything with a NUL byte) never does.
+func ContainsPath(data []byte, old string) bool {
+	return old != "" && bytes.IndexByte(data, 0) < 0 && indexPath(data, []byte(old), 0) >= 0
+}
+
+// RewritePath replaces whole occurrences of the path old with new in text
+// data and reports whether anything changed. A match must end at a path
+// separator, a character that cannot be part of a file name, or the end of
+// the data.
+func RewritePath(data []byte, old, new string) ([]byte, bool) {
+	if !ContainsPath(data, old) {
+		return data, false
+	}
+	o := []byte(old)
+	var out bytes.Buffer
+	last := 0
+	for i := indexPath(data, o, 0); i >= 0; i = indexPath(data, o, last) {
+		out.Write(data[last:i])
+		out.WriteString(new)
+		last = i + len(o)
+	}
+	out.Write(data[last:])
+	return out.Bytes(), true
+}
@@ -0,0 +1,32 @@
+package env
+
+import "testing"
+
+func TestRewritePath(t *testing.T) {
+	cases := []struct {
+		in, want string
+		changed  bool
+	}{
+		{"home: /tmp/e2", "home: /new/env", true},
+		{"/tmp/e2/bin:/tmp/e2/plugins/x", "/new/env/bin:/new/env/plugins/x", true},
+		{`{"home":"/tmp/e2"}`, `{"home":"/new/env"}`, true},
+		{"file:///tmp/e2/a", "file:///new/env/a", true},
+		{"PATH=/tmp/e2;/tmp/e2\\bin", "PATH=/new/env;/new/env\\bin", true},
+		{"/tmp/e20/bin", "/tmp/e20/bin", false},
+		{"/tmp/e2.bak and /tmp/e2-old and /tmp/e2_x", "/tmp/e2.bak and /tmp/e2-old and /tmp/e2_x", false},
+		{"/x/tmp/e2", "/x/tmp/e2", false},
+		{"/tmp/e20 then /tmp/e2", "/tmp/e20 then /new/env", true},
+		{"/tmp/e2/tmp/e2", "/new/env/tmp/e2", true},
+		{"bin\x00/tmp/e2", "bin\x00/tmp/e2", false},
+		{"", "", false},
+	}
+	for _, tc := range cases {
+		got, changed := RewritePath([]byte(tc.in), "/tmp/e2", "/new/env")
+		if string(got) != tc.want || changed != tc.changed {
+			t.Errorf("RewritePath(%q) = %q, %v; want %q, %v", tc.in, got, changed, tc.want, tc.changed)
+		}
+		if ContainsPath([]byte(tc.in), "/tmp/e2") != tc.changed {
+			t.Errorf("ContainsPath(%q) = %v, want %v", tc.in, !tc.changed, tc.changed)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Component is something an environment provides (a toolchain, an SDK),
+// reported by the plugin that installed it.
+type Component struct {
+	Name      string `json:"name"`
+	Version   string `json:"version,omitempty"`
+	Plugin    string `json:"plugin,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// State is the content of .lyenv/state.json. Fields this binary does not
+// know are kept as-is so older and newer versions can share an environment.
+type State struct {
+	CreatedAt     string                 `json:"created_at,omitempty"`
+	InitializedAt string                 `json:"initialized_at,omitempty"`
+	Components    []Component            `json:"components"`
+	Notes         string                 `json:"notes"`
+	Values        map[string]interface{} `json:"values,omitempty"`
+
+	extra map[string]json.RawMessage
+}
+
+// stateFields are the keys State maps to typed fields.
+var stateFields = []string{"created_at", "initialized_at", "components", "notes", "values"}
+
+// StateFile returns the path of the environment state file.
+func StateFile(home string) string {
+	return filepath.Join(home, ".lyenv", "state.json")
+}
+
+func (s *State) UnmarshalJSON(data []byte) error {
+	type plain State
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	for _, k := range stateFields {
+		delete(all, k)
+	}
+	*s = State(p)
+	if len(all) > 0 {
+		s.extra = all
+	}
+	return nil
+}
+
+func (s State) MarshalJSON() ([]byte, error) {
+	type plain State
+	if s.Components == nil {
+		s.Components = []Component{}
+	}
+	data, err := json.Marshal(plain(s))
+	if err != nil || len(s.extra) == 0 {
+		return data, err
+	}
+	all := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for k, v := range s.extra {
+		if _, ok := all[k]; !ok {
+			all[k] = v
+		}
+	}
+	return json.Marshal(all)
+}
+
+// SetComponent records a component, replacing an earlier entry with the same name.
+func (s *State) SetComponent(c Component) {
+	if c.UpdatedAt == "" {
+		c.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	for i := range s.Components {
+		if s.Components[i].Name == c.Name {
+			s.Components[i] = c
+			return
+		}
+	}
+	s.Components = append(s.Components, c)
+	sort.SliceStable(s.Components, func(i, j int) bool { return s.Components[i].Name < s.Components[j].Name })
+}
+
+// RemoveComponents drops every component reported by plugin and returns how many were removed.
+func (s *State) RemoveComponents(plugin string) int {
+	kept := s.Components[:0]
+	for _, c := range s.Components {
+		if c.Plugin != plugin {
+			kept = append(kept, c)
+		}
+	}
+	n := len(s.Components) - len(kept)
+	s.Components = kept
+	return n
+}
+
+// LoadState reads .lyenv/state.json. A missing file yields an empty state.
+func LoadState(home string) (*State, error) {
+	s := &State{}
+	data, err := os.ReadFile(StateFile(home))
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state.json: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid state.json: %w", err)
+	}
+	return s, nil
+}
+
+// SaveState writes .lyenv/state.json atomically.
+func SaveState(home string, s *State) error {
+	out, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(StateFile(home), append(out, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write state.json: %w", err)
+	}
+	return nil
+}
+
+// UpdateState loads the state, applies fn and writes the result. Concurrent
+// updaters (parallel plugin runs, a shell and a CLI call) are serialized by a
+// lock file next to state.json; fn returning an error leaves the file untouched.
+func UpdateState(home string, fn func(*State) error) error {
+	unlock, err := LockFile(StateFile(home) + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	s, err := LoadState(home)
+	if err != nil {
+		return err
+	}
+	if err := fn(s); err != nil {
+		return err
+	}
+	return SaveState(home, s)
+}
+
+// lockTimeout bounds waiting for another updater; staleLock is the age after
+// which a lock left behind by a crashed process is broken.
+const (
+	lockTimeout = 10 * time.Second
+	staleLock   = 30 * time.Second
+)
+
+// LockFile takes an exclusive lock by creating path and returns its release.
+func LockFile(path string) (func(), error) {
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock %s: %w", filepath.Base(path), err)
+		}
+		if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > staleLock {
+			_ = os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to lock %s: held by another process (remove %s if stale)", filepath.Base(path), path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,180 @@
+package env
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeState(t *testing.T, home, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(StateFile(home)), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(StateFile(home), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readStateMap(t *testing.T, home string) map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(StateFile(home))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestStateKeepsUnknownFields(t *testing.T) {
+	home := t.TempDir()
+	writeState(t, home, `{
+  "created_at": "2026-01-01T00:00:00Z",
+  "notes": "old",
+  "components": [],
+  "future_field": {"nested": [1, "two"]},
+  "schema": 3
+}`)
+	err := UpdateState(home, func(s *State) error {
+		s.Notes = "new"
+		s.SetComponent(Component{Name: "jdk", Version: "21", Plugin: "jdk"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := readStateMap(t, home)
+	if !reflect.DeepEqual(m["future_field"], map[string]interface{}{"nested": []interface{}{1.0, "two"}}) || m["schema"] != 3.0 {
+		t.Errorf("unknown fields not preserved: %v", m)
+	}
+	if m["notes"] != "new" || m["created_at"] != "2026-01-01T00:00:00Z" {
+		t.Errorf("known fields: %v", m)
+	}
+	if comps, _ := m["components"].([]interface{}); len(comps) != 1 {
+		t.Errorf("components = %v", m["components"])
+	}
+}
+
+func TestStateUnknownFieldDoesNotShadowKnown(t *testing.T) {
+	s := &State{Notes: "typed", extra: map[string]json.RawMessage{"notes": json.RawMessage(`"stale"`), "x": json.RawMessage(`1`)}}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["notes"] != "typed" || m["x"] != 1.0 {
+		t.Errorf("got %s", data)
+	}
+}
+
+func TestLoadStateMissingAndInvalid(t *testing.T) {
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".lyenv"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadState(home)
+	if err != nil || s == nil || len(s.Components) != 0 {
+		t.Fatalf("missing state: %+v, %v", s, err)
+	}
+	if err := SaveState(home, s); err != nil {
+		t.Fatal(err)
+	}
+	if m := readStateMap(t, home); m["components"] == nil {
+		t.Errorf("components must be written as [], got %v", m)
+	}
+	writeState(t, home, "{not json")
+	if _, err := LoadState(home); err == nil {
+		t.Error("invalid state.json loaded")
+	}
+	if err := UpdateState(home, func(*State) error { return nil }); err == nil {
+		t.Error("UpdateState overwrote an invalid state.json")
+	}
+}
+
+func TestStateComponents(t *testing.T) {
+	s := &State{}
+	s.SetComponent(Component{Name: "node", Version: "20", Plugin: "node"})
+	s.SetComponent(Component{Name: "jdk", Version: "17", Plugin: "java"})
+	s.SetComponent(Component{Name: "maven", Version: "3", Plugin: "java"})
+	s.SetComponent(Component{Name: "jdk", Version: "21", Plugin: "java", UpdatedAt: "t"})
+	var names []string
+	for _, c := range s.Components {
+		names = append(names, c.Name+"@"+c.Version)
+		if c.UpdatedAt == "" {
+			t.Errorf("%s has no updated_at", c.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"jdk@21", "maven@3", "node@20"}) {
+		t.Errorf("components = %v", names)
+	}
+	if n := s.RemoveComponents("java"); n != 2 || len(s.Components) != 1 || s.Components[0].Name != "node" {
+		t.Errorf("RemoveComponents = %d, left %v", n, s.Components)
+	}
+}
+
+func TestUpdateStateSerializes(t *testing.T) {
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".lyenv"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- UpdateState(home, func(s *State) error {
+				count, _ := s.Values["count"].(float64)
+				if s.Values == nil {
+					s.Values = map[string]interface{}{}
+				}
+				s.Values["count"] = count + 1
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := LoadState(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Values["count"] != float64(n) {
+		t.Errorf("count = %v, want %d (lost updates)", s.Values["count"], n)
+	}
+}
+
+func TestLockFileBreaksStaleLock(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "x.lock")
+	if err := os.WriteFile(p, []byte("99999\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLock)
+	if err := os.Chtimes(p, old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := LockFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package env
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// TrustFile lists environment directories allowed to auto-activate through
+// `lyenv hook`, one absolute path per line.
+func TrustFile() string {
+	return filepath.Join(UserConfigDir(), "allowed")
+}
+
+// IsAllowed reports whether dir has been trusted with `lyenv allow`.
+func IsAllowed(dir string) bool {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	dirs, err := AllowedDirs()
+	if err != nil {
+		return false
+	}
+	for _, d := range dirs {
+		if d == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedDirs returns the trusted environment directories in sorted order.
+func AllowedDirs() ([]string, error) {
+	f, err := os.Open(TrustFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust file: %w", err)
+	}
+	defer f.Close()
+	var out []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			out = append(out, line)
+		}
+	}
+	sort.Strings(out)
+	return out, sc.Err()
+}
+
+// Allow trusts an environment directory for auto-activation.
+func Allow(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve directory: %w", err)
+	}
+	if !IsLyenvDir(abs) {
+		return "", fmt.Errorf("not a lyenv environment: %s", abs)
+	}
+	return abs, updateTrust(func(set map[string]bool) { set[abs] = true })
+}
+
+// Deny revokes trust for an environment directory; it need not exist anymore.
+func Deny(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve directory: %w", err)
+	}
+	return abs, updateTrust(func(set map[string]bool) { delete(set, abs) })
+}
+
+func updateTrust(fn func(map[string]bool)) error {
+	dirs, err := AllowedDirs()
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	for _, d := range dirs {
+		set[d] = true
+	}
+	fn(set)
+	out := make([]string, 0, len(set))
+	for d := range set {
+		out = append(out, d)
+	}
+	sort.Strings(out)
+	if err := os.MkdirAll(UserConfigDir(), 0o700); err != nil {
+		return fmt.Errorf("failed to create user config dir: %w", err)
+	}
+	data := ""
+	if len(out) > 0 {
+		data = strings.Join(out, "\n") + "\n"
+	}
+	if err := os.WriteFile(TrustFile(), []byte(data), 0o600); err != nil {
+		return fmt.Errorf("failed to write trust file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UserConfigDir returns the user-level lyenv directory:
+// $LYENV_CONFIG_DIR, else $XDG_CONFIG_HOME/lyenv, else ~/.config/lyenv.
+func UserConfigDir() string {
+	if d := strings.TrimSpace(os.Getenv("LYENV_CONFIG_DIR")); d != "" {
+		return d
+	}
+	if d := strings.TrimSpace(os.Getenv("XDG_CONFIG_HOME")); d != "" {
+		return filepath.Join(d, "lyenv")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lyenv")
+	}
+	return filepath.Join(home, ".config", "lyenv")
+}
+
+// UserStoreDir returns the plugin store shared by all environments:
+// $LYENV_STORE_DIR, else $XDG_DATA_HOME/lyenv/store, else ~/.local/share/lyenv/store.
+func UserStoreDir() string {
+	if d := strings.TrimSpace(os.Getenv("LYENV_STORE_DIR")); d != "" {
+		return d
+	}
+	if d := strings.TrimSpace(os.Getenv("XDG_DATA_HOME")); d != "" {
+		return filepath.Join(d, "lyenv", "store")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "lyenv-store")
+	}
+	return filepath.Join(home, ".local", "share", "lyenv", "store")
+}
@@ -0,0 +1,264 @@
+// Package migrate upgrades environments written by older lyenv versions to
+// the current on-disk layout (env.LayoutVersion).
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lyenv/internal/config"
+	"lyenv/internal/env"
+	"lyenv/internal/plugin"
+)
+
+// Migration upgrades an environment from layout From to From+1.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(home string) error
+}
+
+// migrations are ordered by From and must end at env.LayoutVersion-1.
+var migrations = []Migration{
+	{From: 1, Description: "normalize state.json timestamps and fold the .initialized marker into it", Apply: migrateState1},
+	{From: 1, Description: "fill missing registry install names and drop duplicate entries", Apply: migrateRegistry1},
+	{From: 1, Description: "drop plugins.installed from lyenv.yaml (the registry is authoritative)", Apply: migrateConfig1},
+}
+
+func init() {
+	for _, m := range migrations {
+		if m.From < 1 || m.From >= env.LayoutVersion {
+			panic(fmt.Sprintf("migrate: migration from layout %d is out of range", m.From))
+		}
+	}
+}
+
+// Check refuses environments written by a newer lyenv and reports how many
+// layout steps an older one is behind.
+func Check(home string) (behind int, err error) {
+	layout, err := env.ReadLayout(home)
+	if err != nil {
+		return 0, err
+	}
+	if layout > env.LayoutVersion {
+		return 0, fmt.Errorf("environment layout %d is newer than this lyenv supports (%d); upgrade lyenv", layout, env.LayoutVersion)
+	}
+	return env.LayoutVersion - layout, nil
+}
+
+// Pending lists the migrations that would run for the environment at home.
+func Pending(home string) ([]Migration, error) {
+	if _, err := Check(home); err != nil {
+		return nil, err
+	}
+	layout, err := env.ReadLayout(home)
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	for _, m := range migrations {
+		if m.From >= layout {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// Step is one applied layout upgrade.
+type Step struct {
+	From, To   int
+	Backup     string // directory holding the files as they were before the step
+	Migrations []Migration
+}
+
+// Run upgrades the environment at home to env.LayoutVersion one layout at a
+// time. Each step is preceded by a backup under .lyenv/backups/ and recorded
+// in .lyenv/version only after all its migrations succeed.
+func Run(home string) ([]Step, error) {
+	home, err := filepath.Abs(home)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve environment directory: %w", err)
+	}
+	if _, err := Check(home); err != nil {
+		return nil, err
+	}
+	layout, err := env.ReadLayout(home)
+	if err != nil {
+		return nil, err
+	}
+	var steps []Step
+	for ; layout < env.LayoutVersion; layout++ {
+		step := Step{From: layout, To: layout + 1}
+		for _, m := range migrations {
+			if m.From == layout {
+				step.Migrations = append(step.Migrations, m)
+			}
+		}
+		backup, err := backup(home, step.From, step.To)
+		if err != nil {
+			return steps, fmt.Errorf("failed to back up before migrating to layout %d: %w", step.To, err)
+		}
+		step.Backup = backup
+		for _, m := range step.Migrations {
+			if err := m.Apply(home); err != nil {
+				return steps, fmt.Errorf("migration to layout %d failed (%s): %w; backup: %s", step.To, m.Description, err, backup)
+			}
+		}
+		if err := env.WriteLayout(home, step.To); err != nil {
+			return steps, fmt.Errorf("failed to record layout %d: %w", step.To, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// backup copies the metadata migrations may touch: the config layers and
+// everything under .lyenv except logs and earlier backups.
+func backup(home string, from, to int) (string, error) {
+	dir := filepath.Join(home, ".lyenv", "backups", fmt.Sprintf("migrate-%d-to-%d-%s", from, to, time.Now().UTC().Format("20060102T150405Z")))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	cfgs, err := filepath.Glob(filepath.Join(home, "lyenv*.yaml"))
+	if err != nil {
+		return "", err
+	}
+	for _, c := range cfgs {
+		if err := copyFile(c, filepath.Join(dir, filepath.Base(c))); err != nil {
+			return "", err
+		}
+	}
+	meta := filepath.Join(home, ".lyenv")
+	err = filepath.WalkDir(meta, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(meta, p)
+		if d.IsDir() {
+			if rel == "logs" || rel == "backups" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(p, filepath.Join(dir, ".lyenv", rel))
+	})
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o644)
+}
+
+// ---- layout 1 -> 2 ----
+
+// legacyTime is how layout 1 wrote created_at (time.Time.String()).
+const legacyTime = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+func migrateState1(home string) error {
+	p := filepath.Join(home, ".lyenv", "state.json")
+	marker := p + ".initialized"
+	state := map[string]interface{}{}
+	data, err := os.ReadFile(p)
+	switch {
+	case os.IsNotExist(err):
+		state["components"] = []interface{}{}
+		state["notes"] = ""
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("invalid state.json: %w", err)
+		}
+	}
+	for _, k := range []string{"created_at", "initialized_at"} {
+		s, ok := state[k].(string)
+		if !ok {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, s); err == nil {
+			continue
+		}
+		if i := strings.Index(s, " m="); i >= 0 {
+			s = s[:i] // monotonic clock reading
+		}
+		if t, err := time.Parse(legacyTime, s); err == nil {
+			state[k] = t.UTC().Format(time.RFC3339)
+		}
+	}
+	if b, err := os.ReadFile(marker); err == nil {
+		if s := strings.TrimSpace(string(b)); s != "" {
+			state["initialized_at"] = s
+		}
+	}
+	out, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := env.WriteFileAtomic(p, append(out, '\n'), 0o644); err != nil {
+		return err
+	}
+	if err := os.Remove(marker); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func migrateRegistry1(home string) error {
+	r, err := plugin.LoadRegistry(home)
+	if err != nil {
+		return err
+	}
+	seen := map[string]int{}
+	out := make([]plugin.InstalledPlugin, 0, len(r.Plugins))
+	for _, ip := range r.Plugins {
+		if strings.TrimSpace(ip.InstallName) == "" {
+			ip.InstallName = strings.TrimSpace(ip.Name)
+		}
+		if ip.InstallName == "" {
+			continue
+		}
+		// Later entries were written by later installs; keep the last one.
+		if i, dup := seen[ip.InstallName]; dup {
+			out[i] = ip
+			continue
+		}
+		seen[ip.InstallName] = len(out)
+		out = append(out, ip)
+	}
+	r.Plugins = out
+	return plugin.SaveRegistry(home, r)
+}
+
+func migrateConfig1(home string) error {
+	p := filepath.Join(home, "lyenv.yaml")
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return nil
+	}
+	doc, err := config.LoadDocument(p)
+	if err != nil {
+		return err
+	}
+	removed, err := doc.Unset("plugins.installed")
+	if err != nil || !removed {
+		return err
+	}
+	return doc.Save(p)
+}
@@ -2,8 +2,6 @@ package plugin
 
 import (
 	"fmt"
-	"path/filepath"
-	"sort"
 	"strings"
 
 	"lyenv/internal/config"
@@ -11,11 +9,12 @@ import (
 
 // CenterRecord describes one plugin resolved from registry index.
 type CenterRecord struct {
+	Version string // version key picked from the index ("" when unversioned)
 	Repo    string
 	Ref     string
 	Subpath string
-	Source  string   // optional: archive URL (.zip/.tgz)
-    Sha256  string   // optional: expected sha256 for Source
+	Source  string // optional: archive URL (.zip/.tgz)
+	Sha256  string // optional: expected sha256 for Source
 	Shims   []string
 }
 
@@ -23,30 +22,51 @@ type CenterRecord struct {
 // registry_url can be local file path or HTTP URL (downloaded to temp by helper).
 // It returns repo/ref/subpath/shims for monorepo sparse checkout.
 func ResolveFromCenterMonorepo(envDir, name, wantVersion string) (*CenterRecord, error) {
-	cfg, err := config.LoadYAML(filepath.Join(envDir, "lyenv.yaml"))
+	_, idx, err := loadCenterIndex(envDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read lyenv.yaml: %w", err)
+		return nil, err
 	}
-	v, ok := config.GetByPath(cfg, "plugins.registry_url")
-	if !ok {
-		return nil, fmt.Errorf("plugins.registry_url not configured")
+	return resolveCenterRecord(idx, name, wantVersion)
+}
+
+// loadCenterIndex fetches (or reads from cache) the index at
+// plugins.registry_url and returns its local path and content.
+func loadCenterIndex(envDir string) (string, map[string]interface{}, error) {
+	cfg, err := config.LoadEffective(envDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read lyenv.yaml: %w", err)
+	}
+	if _, ok := config.GetByPath(cfg, "plugins.registry_url"); !ok {
+		return "", nil, fmt.Errorf("plugins.registry_url not configured")
+	}
+	regURL, err := config.GetResolvedString(envDir, cfg, "plugins.registry_url")
+	if err != nil {
+		return "", nil, err
 	}
-	regURL, _ := v.(string)
 	if strings.TrimSpace(regURL) == "" {
-		return nil, fmt.Errorf("plugins.registry_url empty")
+		return "", nil, fmt.Errorf("plugins.registry_url empty")
+	}
+	proxy, err := config.GetResolvedString(envDir, cfg, "config.network.proxy_url")
+	if err != nil {
+		return "", nil, err
 	}
-	proxy := config.GetString(cfg, "config.network.proxy_url")
 
-	indexPath, err := fetchToTempOrUseLocal(regURL, proxy)
+	indexPath, err := cachedIndex(envDir, regURL, proxy)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch registry index: %w", err)
+		return "", nil, fmt.Errorf("failed to fetch registry index: %w", err)
 	}
 
 	idx, err := config.LoadAny(indexPath)
 	if err != nil {
-		return nil, fmt.Errorf("invalid registry index: %w", err)
+		return "", nil, fmt.Errorf("invalid registry index: %w", err)
 	}
+	return indexPath, idx, nil
+}
 
+// resolveCenterRecord picks <NAME> from a loaded center index: the version
+// key wantVersion, else the newest version satisfying it as a constraint
+// (the newest overall when empty).
+func resolveCenterRecord(idx map[string]interface{}, name, wantVersion string) (*CenterRecord, error) {
 	pluginsRaw, ok := config.GetByPath(idx, "plugins")
 	if !ok {
 		return nil, fmt.Errorf("registry index missing 'plugins'")
@@ -76,40 +96,50 @@ func ResolveFromCenterMonorepo(envDir, name, wantVersion string) (*CenterRecord,
 		}
 	}
 
+	version := ""
 	if vMapRaw, ok := entry["versions"].(map[string]interface{}); ok && len(vMapRaw) > 0 {
-        versionKey := wantVersion
-        if strings.TrimSpace(versionKey) == "" {
-            versionKey = pickLatestVersionKey(vMapRaw)
-        }
-        vEntry, ok := vMapRaw[versionKey].(map[string]interface{})
-        if !ok {
-            return nil, fmt.Errorf("version not found: %s@%s", name, versionKey)
-        }
-        repo = nonEmpty(asString(vEntry["repo"]), repo)
-        ref = nonEmpty(asString(vEntry["ref"]), ref)
-        subpath = nonEmpty(asString(vEntry["subpath"]), subpath)
-        source := asString(vEntry["source"])
-        sha256 := asString(vEntry["sha256"])
-
-        if sArr2, ok := vEntry["shims"].([]interface{}); ok {
-            shims = shims[:0]
-            for _, x := range sArr2 { shims = append(shims, fmt.Sprint(x)) }
-        }
-
-        if strings.TrimSpace(source) != "" {
-            return &CenterRecord{
-                Source: source,
-                Sha256: sha256,
-                Shims:  shims,
-            }, nil
-        }
-    }
-
-    if strings.TrimSpace(repo) == "" || strings.TrimSpace(subpath) == "" {
-        return nil, fmt.Errorf("registry entry must provide repo and subpath for monorepo: %s", name)
-    }
-    if strings.TrimSpace(ref) == "" { ref = "main" }
-    return &CenterRecord{Repo: repo, Ref: ref, Subpath: subpath, Shims: shims}, nil
+		versionKey, err := pickVersionKey(vMapRaw, strings.TrimSpace(wantVersion))
+		if err != nil {
+			return nil, err
+		}
+		if versionKey == "" {
+			return nil, fmt.Errorf("version not found: %s@%s", name, wantVersion)
+		}
+		vEntry, ok := vMapRaw[versionKey].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid registry entry for: %s@%s", name, versionKey)
+		}
+		version = versionKey
+		repo = nonEmpty(asString(vEntry["repo"]), repo)
+		ref = nonEmpty(asString(vEntry["ref"]), ref)
+		subpath = nonEmpty(asString(vEntry["subpath"]), subpath)
+		source := asString(vEntry["source"])
+		sha256 := asString(vEntry["sha256"])
+
+		if sArr2, ok := vEntry["shims"].([]interface{}); ok {
+			shims = shims[:0]
+			for _, x := range sArr2 {
+				shims = append(shims, fmt.Sprint(x))
+			}
+		}
+
+		if strings.TrimSpace(source) != "" {
+			return &CenterRecord{
+				Version: versionKey,
+				Source:  source,
+				Sha256:  sha256,
+				Shims:   shims,
+			}, nil
+		}
+	}
+
+	if strings.TrimSpace(repo) == "" || strings.TrimSpace(subpath) == "" {
+		return nil, fmt.Errorf("registry entry must provide repo and subpath for monorepo: %s", name)
+	}
+	if strings.TrimSpace(ref) == "" {
+		ref = "main"
+	}
+	return &CenterRecord{Version: version, Repo: repo, Ref: ref, Subpath: subpath, Shims: shims}, nil
 
 }
 
@@ -127,12 +157,22 @@ func nonEmpty(s, fallback string) string {
 	return s
 }
 
-// pickLatestVersionKey chooses the latest semver-like key (simple string sort fallback).
-func pickLatestVersionKey(versions map[string]interface{}) string {
-	keys := make([]string, 0, len(versions))
+// pickVersionKey chooses the version key named by want, else the newest one
+// satisfying want as a constraint ("" for the newest overall). It returns ""
+// when nothing matches.
+func pickVersionKey(versions map[string]interface{}, want string) (string, error) {
+	if _, ok := versions[want]; ok && want != "" {
+		return want, nil
+	}
+	best := ""
 	for k := range versions {
-		keys = append(keys, k)
+		ok, err := matchVersion(want, k)
+		if err != nil {
+			return "", err
+		}
+		if ok && (best == "" || compareVersions(k, best) > 0) {
+			best = k
+		}
 	}
-	sort.Strings(keys)
-	return keys[len(keys)-1]
+	return best, nil
 }
@@ -5,23 +5,34 @@ import (
 	"os"
 	"path/filepath"
 
+	"lyenv/internal/cache"
 	"lyenv/internal/config"
 )
 
 // CenterSync fetches registry_url and caches it into .lyenv/registry/index.{yaml|json}
 func CenterSync(envDir string) (string, error) {
-	cfg, err := config.LoadYAML(filepath.Join(envDir, "lyenv.yaml"))
+	cfg, err := config.LoadEffective(envDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to read lyenv.yaml: %w", err)
 	}
-	regURL := config.GetString(cfg, "plugins.registry_url")
+	regURL, err := config.GetResolvedString(envDir, cfg, "plugins.registry_url")
+	if err != nil {
+		return "", err
+	}
 	if regURL == "" {
 		return "", fmt.Errorf("plugins.registry_url not configured")
 	}
-	proxy := config.GetString(cfg, "config.network.proxy_url")
+	proxy, err := config.GetResolvedString(envDir, cfg, "config.network.proxy_url")
+	if err != nil {
+		return "", err
+	}
+
+	if cache.Offline(envDir) {
+		return "", fmt.Errorf("offline: cannot sync the plugin center")
+	}
 
-	// Download or use local file
-	path, err := fetchToTempOrUseLocal(regURL, proxy)
+	// Download (through the cache) or use local file
+	path, err := cachedIndex(envDir, regURL, proxy)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch registry index: %w", err)
 	}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"lyenv/internal/secret"
 )
 
 type DispatchRecord struct {
@@ -26,6 +28,7 @@ func writeDispatchLog(envDir string, rec DispatchRecord) {
 		return
 	}
 	defer f.Close()
+	rec.Args = secret.LoadRedactor(envDir).Strings(rec.Args)
 	if rec.TS == "" {
 		rec.TS = time.Now().UTC().Format(time.RFC3339)
 	}
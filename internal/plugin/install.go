@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"lyenv/internal/config"
+	"lyenv/internal/store"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -47,11 +48,20 @@ func PluginAddLocal(envDir, srcPath, overrideName string) error {
 	if err := ValidateManifestStruct(man); err != nil {
 		return err
 	}
+	if _, err := loadPluginSchema(targetDir, man); err != nil {
+		return err
+	}
 
 	_ = NormalizePluginPermissions(targetDir)
 	_ = EnsureLogsDir(targetDir)
 
-	if err := CreateShims(envDir, installName, man.Expose); err != nil {
+	hash, err := linkFromStore(envDir, installName, targetDir, man)
+	if err != nil {
+		return err
+	}
+
+	shims, err := exposeShims(envDir, installName, man.Expose)
+	if err != nil {
 		return err
 	}
 
@@ -61,15 +71,16 @@ func PluginAddLocal(envDir, srcPath, overrideName string) error {
 		Version:     man.Version,
 		Source:      "local",
 		Ref:         "",
-		Shims:       man.Expose,
+		Shims:       shims,
 		InstalledAt: time.Now().UTC(),
+		StoreHash:   hash,
 	}
 	if err := RegisterInstall(envDir, ip); err != nil {
 		return err
 	}
 
 	fmt.Println("Plugin installed successfully.")
-	for _, e := range man.Expose {
+	for _, e := range shims {
 		fmt.Printf("Executable generated: bin/%s\n", e)
 	}
 	return nil
@@ -82,51 +93,46 @@ func PluginAdd(envDir, src, optSource, optRepo, optRef, optProxy, overrideName s
 	}
 
 	var name string
-	var srcType string // local|git|archive|url|git-subpath
-	var centerSha256 string
+	var spec sourceSpec // Kind: local|git|archive|url|git-subpath
+	var center, constraint string
 
 	// Case 1: explicit local path
 	if src != "" && (strings.HasPrefix(src, ".") || filepath.IsAbs(src)) {
 		if st, err := os.Stat(src); err == nil && st.IsDir() {
-			srcType = "local"
+			spec = sourceSpec{Kind: "local", URL: src}
 			name = filepath.Base(src)
 		}
 	}
 
 	// Case 2: explicit source URL (zip/tgz)
-	if srcType == "" && strings.TrimSpace(optSource) != "" {
-		srcType = detectSourceType(optSource)
+	if spec.Kind == "" && strings.TrimSpace(optSource) != "" {
+		spec = sourceSpec{Kind: detectSourceType(optSource), URL: optSource}
 		name = inferNameFromSource(optSource)
 	}
 
 	// Case 3: explicit repo (org/repo)
-	if srcType == "" && strings.TrimSpace(optRepo) != "" {
-		srcType = "git"
+	if spec.Kind == "" && strings.TrimSpace(optRepo) != "" {
+		spec = sourceSpec{Kind: "git", URL: optRepo, Ref: optRef}
 		name = strings.TrimSuffix(filepath.Base(optRepo), ".git")
 	}
 
-	// Case 4: center resolution when only NAME provided
-	if srcType == "" && src != "" {
-		rec, err := ResolveFromCenterMonorepo(envDir, strings.TrimSpace(src), strings.TrimSpace(optRef))
+	// Case 4: center resolution when only NAME provided; --ref is a version
+	// or version constraint, kept for `plugin update`
+	if spec.Kind == "" && src != "" {
+		center, constraint = strings.TrimSpace(src), strings.TrimSpace(optRef)
+		rec, err := ResolveFromCenterMonorepo(envDir, center, constraint)
 		if err != nil {
 			return fmt.Errorf("failed to resolve from plugin center: %w", err)
 		}
-
-		if strings.TrimSpace(rec.Source) != "" {
-			srcType = detectSourceType(rec.Source) // "url" for .zip, "archive" for .tgz
-			optSource = rec.Source
-			centerSha256 = strings.TrimSpace(rec.Sha256)
-			name = filepath.Base(strings.TrimSuffix(strings.TrimSuffix(rec.Source, ".zip"), ".tgz"))
+		spec = centerSource(rec)
+		if spec.Subpath != "" {
+			name = filepath.Base(spec.Subpath)
 		} else {
-			srcType = "git-subpath"
-			optRepo = rec.Repo
-			optRef = rec.Ref
-			src = rec.Subpath
-			name = filepath.Base(rec.Subpath)
+			name = inferNameFromSource(spec.URL)
 		}
 	}
 
-	if srcType == "" {
+	if spec.Kind == "" {
 		return errors.New("missing source: provide <PATH>, or --repo=<org/repo>, or --source=<url>, or configure plugin center")
 	}
 
@@ -140,100 +146,33 @@ func PluginAdd(envDir, src, optSource, optRepo, optRef, optProxy, overrideName s
 
 	// Proxy fallback from lyenv.yaml if not provided
 	if strings.TrimSpace(optProxy) == "" {
-		cfg, _ := config.LoadYAML(filepath.Join(envDir, "lyenv.yaml"))
-		if v, ok := config.GetByPath(cfg, "config.network.proxy_url"); ok {
-			if s, ok2 := v.(string); ok2 && strings.TrimSpace(s) != "" {
-				optProxy = strings.TrimSpace(s)
-			}
-		}
-	}
-
-	switch srcType {
-	case "local":
-		if err := copyDir(src, targetDir); err != nil {
-			return fmt.Errorf("failed to install local plugin: %w", err)
-		}
-
-	case "git":
-		if _, err := exec.LookPath("git"); err != nil {
-			return fmt.Errorf("'git' is not available. Please install git or use --source=<zip url>")
-		}
-		args := []string{"clone"}
-		if strings.TrimSpace(optRef) != "" {
-			args = append(args, "--branch", strings.TrimSpace(optRef))
-		}
-		args = append(args, "--depth", "1", repoURL(optRepo, optProxy), targetDir)
-		cmd := exec.Command("git", args...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("git clone failed: %w", err)
-		}
-
-	case "git-subpath":
-		work, err := cloneSparseSubpath("https://github.com/"+strings.TrimSpace(optRepo), strings.TrimSpace(optRef), optProxy)
+		cfg, _ := config.LoadEffective(envDir)
+		proxy, err := config.GetResolvedString(envDir, cfg, "config.network.proxy_url")
 		if err != nil {
 			return err
 		}
-		subAbs := filepath.Join(work, src)
-		if _, err := os.Stat(subAbs); err != nil {
-			return fmt.Errorf("subpath not found in monorepo: %s", src)
-		}
-		if err := copyDir(subAbs, targetDir); err != nil {
-			return fmt.Errorf("failed to copy subpath to target: %w", err)
-		}
-
-	case "archive":
-		tmp := filepath.Join(os.TempDir(), installName+"-plugin.tgz")
-		if err := fetchURL(optSource, tmp, optProxy); err != nil {
-			return err
-		}
-
-		if strings.TrimSpace(centerSha256) != "" {
-			if err := VerifySHA256(tmp, centerSha256); err != nil {
-				return err
-			}
-		}
-
-		if err := os.MkdirAll(targetDir, 0o755); err != nil {
-			return err
-		}
-		cmd := exec.Command("tar", "-xzf", tmp, "-C", targetDir, "--strip-components=1")
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("tar extract failed: %w", err)
-		}
-
-	case "url":
-		if !strings.HasSuffix(strings.ToLower(optSource), ".zip") {
-			return fmt.Errorf("unsupported URL type: %s (only .zip supported)", optSource)
-		}
-		tmp := filepath.Join(os.TempDir(), installName+"-plugin.zip")
-		if err := fetchURL(optSource, tmp, optProxy); err != nil {
-			return err
-		}
-
-		if strings.TrimSpace(centerSha256) != "" {
-			if err := VerifySHA256(tmp, centerSha256); err != nil {
-				return err
-			}
-		}
+		optProxy = strings.TrimSpace(proxy)
+	}
 
-		if err := os.MkdirAll(targetDir, 0o755); err != nil {
-			return err
-		}
-		cmd := exec.Command("unzip", "-o", tmp, "-d", targetDir)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("unzip failed: %w", err)
-		}
+	archiveSum, err := fetchSource(envDir, installName, spec, optProxy, targetDir)
+	if err != nil {
+		return err
+	}
 
-	default:
-		return fmt.Errorf("unsupported source type: %s", srcType)
+	ip := InstalledPlugin{
+		InstallName: installName,
+		Sha256:      archiveSum,
+		Center:      center,
+		Constraint:  constraint,
 	}
+	spec.record(&ip)
+	return completeInstall(envDir, targetDir, ip)
+}
 
+// completeInstall validates an unpacked plugin tree, links it from the
+// store, creates its shims and registers it. ip carries the install name
+// and source details; manifest fields are filled in here.
+func completeInstall(envDir, targetDir string, ip InstalledPlugin) error {
 	// Normalize permissions and ensure logs dir
 	_ = NormalizePluginPermissions(targetDir)
 	_ = EnsureLogsDir(targetDir)
@@ -246,37 +185,71 @@ func PluginAdd(envDir, src, optSource, optRepo, optRef, optProxy, overrideName s
 	if err := ValidateManifestStruct(man); err != nil {
 		return err
 	}
+	if _, err := loadPluginSchema(targetDir, man); err != nil {
+		return err
+	}
+
+	hash, err := linkFromStore(envDir, ip.InstallName, targetDir, man)
+	if err != nil {
+		return err
+	}
 
 	// Create shims bound to installName
-	if err := CreateShims(envDir, installName, man.Expose); err != nil {
+	shims, err := exposeShims(envDir, ip.InstallName, man.Expose)
+	if err != nil {
 		return err
 	}
 
 	// Register installation
-	ip := InstalledPlugin{
-		Name:        man.Name,
-		InstallName: installName,
-		Version:     man.Version,
-		Source:      srcType,
-		Ref:         strings.TrimSpace(optRef),
-		Shims:       man.Expose,
-		InstalledAt: time.Now().UTC(),
-	}
-	// For git-subpath, store repo URL for info
-	if srcType == "git-subpath" {
-		ip.Source = "https://github.com/" + strings.TrimSpace(optRepo)
-	}
+	ip.Name = man.Name
+	ip.Version = man.Version
+	ip.Shims = shims
+	ip.InstalledAt = time.Now().UTC()
+	ip.StoreHash = hash
 	if err := RegisterInstall(envDir, ip); err != nil {
 		return err
 	}
 
 	fmt.Println("Plugin installed successfully.")
-	for _, e := range man.Expose {
+	for _, e := range shims {
 		fmt.Printf("Executable generated: bin/%s\n", e)
 	}
 	return nil
 }
 
+// extractArchive unpacks a plugin archive into targetDir: tarballs
+// ("archive") without their top-level directory, zips ("url") as is.
+func extractArchive(archive, srcType, targetDir string) error {
+	if err := os.MkdirAll(targetDir, 0o755); err != nil {
+		return err
+	}
+	var cmd *exec.Cmd
+	if srcType == "archive" {
+		cmd = exec.Command("tar", "-xzf", archive, "-C", targetDir, "--strip-components=1")
+	} else {
+		cmd = exec.Command("unzip", "-o", archive, "-d", targetDir)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s extract failed: %w", cmd.Args[0], err)
+	}
+	return nil
+}
+
+// fetchArchive returns a plugin archive, verified against sha256 when
+// given. An archive with that checksum already in the plugin store is used
+// without downloading; otherwise it comes from the download cache.
+func fetchArchive(envDir, url, sha256, proxy string) (string, error) {
+	if sha256 = strings.TrimSpace(sha256); sha256 != "" && storeEnabled(envDir) {
+		if p, ok := store.Archive(sha256); ok {
+			fmt.Printf("Using archive from plugin store: %s\n", sha256[:12])
+			return p, nil
+		}
+	}
+	return cachedDownload(envDir, url, sha256, proxy)
+}
+
 // If you do not have this helper yet, you can include it:
 func sanitizeInstallName(s string) string {
 	s = strings.TrimSpace(s)
@@ -44,6 +44,13 @@ type ConfigSpec struct {
 	Namespace string `yaml:"namespace"`
 	LocalFile string `yaml:"local_file"`
 	StateFile string `yaml:"state_file"`
+	Schema    string `yaml:"schema"` // JSON Schema for local_file and the namespace in lyenv.yaml
+}
+
+// ActivateSpec declares what `lyenv activate` adds to the shell for this plugin.
+type ActivateSpec struct {
+	Env  map[string]string `yaml:"env"`  // exported variables; ${PLUGIN_DIR}, ${LYENV_HOME} and ${NAME} are expanded
+	Path []string          `yaml:"path"` // plugin-relative directories prepended to PATH
 }
 
 type PluginManifest struct {
@@ -53,6 +60,7 @@ type PluginManifest struct {
 	Config   ConfigSpec    `yaml:"config"`
 	Commands []CommandSpec `yaml:"commands"`
 	Expose   []string      `yaml:"expose"`
+	Activate ActivateSpec  `yaml:"activate"`
 }
 
 func LoadManifest(pluginDir string) (*PluginManifest, error) {
@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lyenv/internal/config"
+	"lyenv/internal/env"
+)
+
+// mutationTarget bundles what is needed to persist the 'mutations' of a stdio response.
+type mutationTarget struct {
+	envDir    string
+	pluginDir string
+	man       *PluginManifest
+	globalCfg map[string]interface{} // in-memory copy (unresolved) passed to later steps
+	pluginCfg map[string]interface{}
+	strategy  MergeStrategy
+
+	install    string
+	statePath  string                 // plugin state file; "" when config.state_file is unset
+	stateValue map[string]interface{} // current plugin state, sent with every stdio request
+}
+
+// apply persists mutations and mirrors them into the in-memory configs:
+//   - global: map deep-merged into lyenv.yaml with the run's merge strategy
+//   - set:    {"<dot path>": value} written into lyenv.yaml
+//   - unset:  ["<dot path>", ...] removed from lyenv.yaml
+//   - plugin: map merged (override) into the plugin-local config file
+//   - state:  map merged (override) into the plugin's state file
+//   - components: [{"name", "version"}] recorded in .lyenv/state.json
+func (t *mutationTarget) apply(muts map[string]interface{}) error {
+	g, _ := muts["global"].(map[string]interface{})
+	set, _ := muts["set"].(map[string]interface{})
+	var unset []string
+	if arr, ok := muts["unset"].([]interface{}); ok {
+		for _, x := range arr {
+			unset = append(unset, fmt.Sprint(x))
+		}
+	}
+	if g != nil || len(set) > 0 || len(unset) > 0 {
+		if err := config.ConfigApplyMutations(t.envDir, "lyenv.yaml", g, set, unset, t.strategy); err != nil {
+			return fmt.Errorf("failed to write global config: %w", err)
+		}
+		config.MergeMapWithStrategy(t.globalCfg, g, t.strategy)
+		for k, v := range set {
+			_ = config.SetByPath(t.globalCfg, k, v)
+		}
+		for _, k := range unset {
+			_, _ = config.DeleteByPath(t.globalCfg, k)
+		}
+		fmt.Printf("Global config updated (strategy=%s).\n", t.strategy)
+	}
+
+	if p, ok := muts["plugin"].(map[string]interface{}); ok && strings.TrimSpace(t.man.Config.LocalFile) != "" {
+		checkLocal := func(m map[string]interface{}) error {
+			return config.ViolationsError(validateLocalConfig(t.pluginDir, t.man, m))
+		}
+		if err := config.MergeFile(filepath.Join(t.pluginDir, t.man.Config.LocalFile), p, config.MergeOverride, checkLocal); err != nil {
+			return fmt.Errorf("failed to write plugin config: %w", err)
+		}
+		config.MergeMapWithStrategy(t.pluginCfg, p, config.MergeOverride)
+		fmt.Println("Plugin local config updated.")
+	}
+
+	if st, ok := muts["state"].(map[string]interface{}); ok {
+		if t.statePath == "" {
+			fmt.Fprintf(os.Stderr, "Warning: plugin %s returned state but declares no config.state_file; ignored\n", t.install)
+		} else {
+			config.MergeMapWithStrategy(t.stateValue, st, config.MergeOverride)
+			if err := SavePluginState(t.statePath, t.stateValue); err != nil {
+				return err
+			}
+			fmt.Println("Plugin state updated.")
+		}
+	}
+
+	if arr, ok := muts["components"].([]interface{}); ok {
+		var comps []env.Component
+		for _, x := range arr {
+			m, _ := x.(map[string]interface{})
+			name, _ := m["name"].(string)
+			if name = strings.TrimSpace(name); name == "" {
+				return fmt.Errorf("invalid components mutation: each entry needs a name")
+			}
+			c := env.Component{Name: name, Plugin: t.install}
+			if v, ok := m["version"]; ok && v != nil {
+				c.Version = fmt.Sprint(v)
+			}
+			comps = append(comps, c)
+		}
+		err := env.UpdateState(t.envDir, func(s *env.State) error {
+			for _, c := range comps {
+				s.SetComponent(c)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Components recorded: %d\n", len(comps))
+	}
+	return nil
+}
+
+// loadState reads (creating on first use) the plugin state file, if any.
+func (t *mutationTarget) loadState() error {
+	t.statePath = PluginStateFile(t.pluginDir, t.man)
+	if t.statePath == "" {
+		return nil
+	}
+	st, err := LoadPluginState(t.pluginDir, t.man)
+	if err != nil {
+		return err
+	}
+	t.stateValue = st
+	return nil
+}
+
+// prepareRequest sets the request's config block from the current in-memory
+// configs, resolving ${env:}, ${file:} and ${secret:} references so plugins
+// receive plain values while files on disk keep the references.
+func (t *mutationTarget) prepareRequest(req map[string]interface{}) error {
+	g, err := config.ResolveMap(t.envDir, t.globalCfg)
+	if err != nil {
+		return fmt.Errorf("failed to resolve global config: %w", err)
+	}
+	p, err := config.ResolveMap(t.envDir, t.pluginCfg)
+	if err != nil {
+		return fmt.Errorf("failed to resolve plugin config: %w", err)
+	}
+	req["config"] = map[string]interface{}{
+		"global": g,
+		"plugin": p,
+	}
+	if t.statePath != "" {
+		req["state"] = t.stateValue
+	}
+	return nil
+}
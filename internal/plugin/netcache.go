@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"lyenv/internal/cache"
+)
+
+// cachedDownload returns a local copy of url from the environment cache.
+// An entry matching sha256 is used as is; without a checksum the URL is
+// downloaded again when online (a failed download falls back to the cached
+// copy). Offline, only the cache is consulted.
+func cachedDownload(envDir, url, sha256, proxy string) (string, error) {
+	sha256 = strings.ToLower(strings.TrimSpace(sha256))
+	old, ok := cache.Lookup(envDir, cache.Downloads, url, "")
+	if ok && sha256 != "" && old.Sha256 == sha256 {
+		return old.Data(), nil
+	}
+	if cache.Offline(envDir) {
+		if !ok {
+			return "", cache.Miss(url)
+		}
+		if err := VerifySHA256(old.Data(), sha256); err != nil {
+			return "", fmt.Errorf("offline: cached %s: %w", url, err)
+		}
+		return old.Data(), nil
+	}
+	e, err := cache.Put(envDir, cache.Downloads, url, "", func(dst string) error {
+		if err := fetchURL(url, dst, proxy); err != nil {
+			return fmt.Errorf("download failed: %w", err)
+		}
+		return VerifySHA256(dst, sha256)
+	})
+	if err != nil {
+		if ok && sha256 == "" {
+			fmt.Fprintf(os.Stderr, "Warning: %v; using cached copy from %s\n", err, old.FetchedAt)
+			return old.Data(), nil
+		}
+		return "", err
+	}
+	return e.Data(), nil
+}
+
+// cachedCheckout returns a shallow checkout of repo at ref (the default
+// branch when empty) from the environment cache. Online it is cloned afresh,
+// since branches move; offline the cached checkout is used. key is the repo
+// URL without proxy prefix, cloneURL the one to clone from.
+func cachedCheckout(envDir, key, cloneURL, ref string) (string, error) {
+	what := key
+	if ref != "" {
+		what += "@" + ref
+	}
+	old, ok := cache.Lookup(envDir, cache.Git, key, ref)
+	if cache.Offline(envDir) {
+		if !ok {
+			return "", cache.Miss(what)
+		}
+		return old.Data(), nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		if ok {
+			return old.Data(), nil
+		}
+		return "", fmt.Errorf("'git' is not available. Please install git or use --source=<zip url>")
+	}
+	e, err := cache.Put(envDir, cache.Git, key, ref, func(dst string) error {
+		args := []string{"clone"}
+		if ref != "" {
+			args = append(args, "--branch", ref)
+		}
+		args = append(args, "--depth", "1", cloneURL, dst)
+		cmd := exec.Command("git", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("git clone failed: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if ok {
+			fmt.Fprintf(os.Stderr, "Warning: %v; using cached checkout of %s from %s\n", err, what, old.FetchedAt)
+			return old.Data(), nil
+		}
+		return "", err
+	}
+	return e.Data(), nil
+}
+
+// cachedIndex returns the center index at regURL. Local files are used in
+// place. Online the index is downloaded and cached; offline the index
+// synced by `lyenv plugin center sync` is preferred, then the cached one.
+func cachedIndex(envDir, regURL, proxy string) (string, error) {
+	if _, err := os.Stat(regURL); err == nil {
+		return regURL, nil
+	}
+	old, ok := cache.Lookup(envDir, cache.Index, regURL, "")
+	if cache.Offline(envDir) {
+		for _, name := range []string{"index.yaml", "index.json"} {
+			p := filepath.Join(envDir, ".lyenv", "registry", name)
+			if _, err := os.Stat(p); err == nil {
+				return p, nil
+			}
+		}
+		if !ok {
+			return "", cache.Miss("plugin center index " + regURL)
+		}
+		return old.Data(), nil
+	}
+	e, err := cache.Put(envDir, cache.Index, regURL, "", func(dst string) error {
+		if err := fetchURL(regURL, dst, proxy); err != nil {
+			return fmt.Errorf("download failed: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if ok {
+			fmt.Fprintf(os.Stderr, "Warning: %v; using cached index from %s\n", err, old.FetchedAt)
+			return old.Data(), nil
+		}
+		return "", err
+	}
+	return e.Data(), nil
+}
+
+// copyCheckout copies a cached checkout without its .git directory.
+func copyCheckout(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(src, p)
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0o644)
+	})
+}
@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+)
+
+// OutdatedPlugin is a plugin center install with a newer version available.
+type OutdatedPlugin struct {
+	InstallName string `json:"install_name"`
+	Name        string `json:"name"` // center name
+	Constraint  string `json:"constraint,omitempty"`
+	Current     string `json:"current"`
+	Wanted      string `json:"wanted"` // newest version satisfying Constraint
+	Latest      string `json:"latest"`
+}
+
+// Upgradable reports whether the constraint allows a newer version.
+func (o OutdatedPlugin) Upgradable() bool {
+	return compareVersions(o.Wanted, o.Current) > 0
+}
+
+// Outdated checks every plugin center install against the center index.
+// Installs the center no longer knows, or that are unversioned there, are
+// skipped with a warning.
+func Outdated(envDir string) ([]OutdatedPlugin, error) {
+	r, err := LoadRegistry(envDir)
+	if err != nil {
+		return nil, err
+	}
+	var out []OutdatedPlugin
+	var idx map[string]interface{}
+	for _, ip := range r.Plugins {
+		center := ip.CenterName()
+		if center == "" {
+			continue
+		}
+		if idx == nil {
+			if _, idx, err = loadCenterIndex(envDir); err != nil {
+				return nil, err
+			}
+		}
+		wanted, err := resolveCenterRecord(idx, center, ip.Constraint)
+		if err == nil && wanted.Version == "" {
+			err = fmt.Errorf("no versions listed in plugin center")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", ip.InstallName, err)
+			continue
+		}
+		latest, err := resolveCenterRecord(idx, center, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", ip.InstallName, err)
+			continue
+		}
+		o := OutdatedPlugin{
+			InstallName: ip.InstallName,
+			Name:        center,
+			Constraint:  ip.Constraint,
+			Current:     ip.Version,
+			Wanted:      wanted.Version,
+			Latest:      latest.Version,
+		}
+		if o.Upgradable() || compareVersions(o.Latest, o.Current) > 0 {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
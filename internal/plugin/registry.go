@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -21,6 +22,45 @@ type InstalledPlugin struct {
 	Ref         string    `yaml:"ref"`
 	Shims       []string  `yaml:"shims"`
 	InstalledAt time.Time `yaml:"installed_at"`
+
+	// Plugin store entries in use: the linked tree and the downloaded archive
+	StoreHash string `yaml:"store_hash,omitempty"`
+	Sha256    string `yaml:"sha256,omitempty"`
+
+	// Where updates come from: the source kind (local|git|git-subpath|
+	// archive|url), its URL or org/repo, the monorepo subpath, and for
+	// plugin center installs the center name and version constraint
+	Kind       string `yaml:"kind,omitempty"`
+	URL        string `yaml:"url,omitempty"`
+	Subpath    string `yaml:"subpath,omitempty"`
+	Center     string `yaml:"center,omitempty"`
+	Constraint string `yaml:"constraint,omitempty"`
+}
+
+// SourceKind returns the recorded source kind, inferred from Source for
+// records written before kinds were recorded.
+func (ip *InstalledPlugin) SourceKind() string {
+	if ip.Kind != "" {
+		return ip.Kind
+	}
+	if strings.HasPrefix(ip.Source, "https://") {
+		return "git-subpath"
+	}
+	return ip.Source
+}
+
+// CenterName returns the plugin center name to update from, or "". Older
+// records did not keep it: monorepo installs only came from the center, and
+// archives without a recorded URL can only be found there again.
+func (ip *InstalledPlugin) CenterName() string {
+	if ip.Center != "" || ip.Kind != "" {
+		return ip.Center
+	}
+	switch ip.SourceKind() {
+	case "git-subpath", "archive", "url":
+		return ip.Name
+	}
+	return ""
 }
 
 type Registry struct {
@@ -44,6 +84,12 @@ func LoadRegistry(envDir string) (*Registry, error) {
 	if err := yaml.Unmarshal(data, &r); err != nil {
 		return nil, fmt.Errorf("invalid registry: %w", err)
 	}
+	// Records written before install names existed are keyed by name
+	for i := range r.Plugins {
+		if r.Plugins[i].InstallName == "" {
+			r.Plugins[i].InstallName = r.Plugins[i].Name
+		}
+	}
 	return &r, nil
 }
 
@@ -59,14 +105,19 @@ func SaveRegistry(envDir string, r *Registry) error {
 	return os.WriteFile(p, out, 0o644)
 }
 
+// RegisterInstall adds or replaces the record of ip.InstallName. Several
+// installs of the same plugin (Name) are kept side by side.
 func RegisterInstall(envDir string, ip InstalledPlugin) error {
+	if ip.InstallName == "" {
+		return fmt.Errorf("install name must not be empty")
+	}
 	r, err := LoadRegistry(envDir)
 	if err != nil {
 		return err
 	}
 	found := false
 	for i := range r.Plugins {
-		if r.Plugins[i].Name == ip.Name {
+		if r.Plugins[i].InstallName == ip.InstallName {
 			r.Plugins[i] = ip
 			found = true
 			break
@@ -108,3 +159,18 @@ func GetByInstallName(envDir, installName string) (*InstalledPlugin, error) {
 	}
 	return nil, fmt.Errorf("plugin not found: %s", installName)
 }
+
+// FindByName returns the records of every install of the logical plugin name.
+func FindByName(envDir, name string) ([]InstalledPlugin, error) {
+	r, err := LoadRegistry(envDir)
+	if err != nil {
+		return nil, err
+	}
+	var out []InstalledPlugin
+	for _, p := range r.Plugins {
+		if p.Name == name {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
@@ -11,27 +11,26 @@ func PluginRemove(envDir, installName string, force bool) error {
 
 	// Try registry first
 	if rec, err := GetByInstallName(envDir, installName); err == nil {
-		_ = DeleteShims(envDir, rec.Shims)
 		_ = os.RemoveAll(pluginDir)
 		_ = UnregisterByInstallName(envDir, installName)
+		_ = ReleaseShims(envDir, installName, rec.Shims)
+		forgetComponents(envDir, installName)
 		return nil
 	}
 
-	// Fallback: load manifest if plugin dir still exists
-	if man, err := LoadManifest(pluginDir); err == nil {
-		_ = DeleteShims(envDir, man.Expose)
-	}
+	// Fallback: not registered. Remove the directory and whatever shims in
+	// bin/ run this install name; shims of other installs are left alone.
 	_ = os.RemoveAll(pluginDir)
 	_ = UnregisterByInstallName(envDir, installName)
+	forgetComponents(envDir, installName)
 
-	// Final fallback: remove any file named like expose from bin/ if present
-	// (This is rare; only when manifest and registry both missing)
 	binDir := filepath.Join(envDir, "bin")
 	entries, _ := os.ReadDir(binDir)
 	for _, e := range entries {
-		// Heuristic: if it's executable and starts with installName prefix or looks like known shim name, remove.
 		p := filepath.Join(binDir, e.Name())
-		_ = os.Remove(p)
+		if install, _, ok := ReadShim(p); ok && install == installName {
+			_ = os.Remove(p)
+		}
 	}
 
 	if !force {
@@ -40,20 +39,3 @@ func PluginRemove(envDir, installName string, force bool) error {
 	}
 	return nil
 }
-
-
-
-func unregister(envDir, name string) error {
-	r, err := LoadRegistry(envDir)
-	if err != nil {
-		return err
-	}
-	out := make([]InstalledPlugin, 0, len(r.Plugins))
-	for _, p := range r.Plugins {
-		if p.Name != name {
-			out = append(out, p)
-		}
-	}
-	r.Plugins = out
-	return SaveRegistry(envDir, r)
-}
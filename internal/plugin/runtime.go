@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"lyenv/internal/config"
+	"lyenv/internal/secret"
 )
 
 type MergeStrategy = config.MergeStrategy
@@ -35,16 +36,22 @@ func ResolvePluginDir(envDir, name string) (pluginDir string, installName string
 		}
 	}
 
-	// 3) Fallback to registry: find record by manifest logical name
-	if r, loadErr := LoadRegistry(envDir); loadErr == nil {
-		for _, p := range r.Plugins {
-			if p.Name == name {
-				dir := filepath.Join(pluginsDir, p.InstallName)
-				if _, statErr3 := os.Stat(dir); statErr3 == nil {
-					return dir, p.InstallName, nil
-				}
+	// 3) Fallback to registry: find record by manifest logical name; with
+	// side-by-side installs the install name has to be given
+	if recs, findErr := FindByName(envDir, name); findErr == nil {
+		var found []string
+		for _, p := range recs {
+			if _, statErr3 := os.Stat(filepath.Join(pluginsDir, p.InstallName)); statErr3 == nil {
+				found = append(found, p.InstallName)
 			}
 		}
+		switch len(found) {
+		case 0:
+		case 1:
+			return filepath.Join(pluginsDir, found[0]), found[0], nil
+		default:
+			return "", "", fmt.Errorf("plugin %s is installed more than once (%s); use the install name", name, strings.Join(found, ", "))
+		}
 	}
 
 	return "", "", fmt.Errorf("plugin directory not found for: %s", name)
@@ -69,8 +76,8 @@ func RunPluginCommand(ctx context.Context, envDir, pluginName, command string, p
 		return err
 	}
 
-	// Load global config (lyenv.yaml, always YAML)
-	globalCfg, err := config.LoadYAML(filepath.Join(envDir, "lyenv.yaml"))
+	// Load effective global config (user layer < lyenv.yaml < active profile)
+	globalCfg, err := config.LoadEffective(envDir)
 	if err != nil {
 		return fmt.Errorf("failed to read global config: %w", err)
 	}
@@ -86,29 +93,42 @@ func RunPluginCommand(ctx context.Context, envDir, pluginName, command string, p
 		}
 	}
 
+	mt := &mutationTarget{
+		envDir:    envDir,
+		pluginDir: pluginDir,
+		man:       man,
+		globalCfg: globalCfg,
+		pluginCfg: pluginCfg,
+		strategy:  strategy,
+		install:   resolvedInstall,
+	}
+	if err := mt.loadState(); err != nil {
+		return err
+	}
+
 	// Prepare request JSON for stdio steps or single stdio run
+	paths := map[string]string{
+		"home":       envDir,
+		"bin":        filepath.Join(envDir, "bin"),
+		"workspace":  filepath.Join(envDir, "workspace"),
+		"plugin_dir": pluginDir,
+	}
+	if mt.statePath != "" {
+		paths["state_file"] = mt.statePath
+	}
 	req := map[string]interface{}{
 		"action": command,
 		"args":   passArgs,
-		"paths": map[string]string{
-			"home":       envDir,
-			"bin":        filepath.Join(envDir, "bin"),
-			"workspace":  filepath.Join(envDir, "workspace"),
-			"plugin_dir": pluginDir,
-		},
+		"paths":  paths,
 		"system": map[string]string{
 			"os":   runtime.GOOS,
 			"arch": runtime.GOARCH,
 		},
-		"config": map[string]interface{}{
-			"global": globalCfg,
-			"plugin": pluginCfg,
-		},
 		"merge_strategy": string(strategy),
 		"started_at":     time.Now().UTC().Format(time.RFC3339),
 	}
 
-	// Create plugin log file
+	// Create plugin log file; known secret values are masked on every line
 	logFile := logPath(pluginDir, command)
 	if err := os.MkdirAll(filepath.Dir(logFile), 0o755); err != nil {
 		return err
@@ -118,7 +138,9 @@ func RunPluginCommand(ctx context.Context, envDir, pluginName, command string, p
 		return fmt.Errorf("cannot open log file: %w", err)
 	}
 	defer lf.Close()
-	w := bufio.NewWriter(lf)
+	rw := secret.LoadRedactor(envDir).Writer(lf)
+	defer rw.Close()
+	w := bufio.NewWriter(rw)
 
 	// Console hint for resolution
 	fmt.Printf("Plugin resolved: name=%s install=%s dir=%s\n", pluginName, resolvedInstall, pluginDir)
@@ -227,6 +249,10 @@ func RunPluginCommand(ctx context.Context, envDir, pluginName, command string, p
 					Env:      st.Env,
 					UseStdio: true,
 				}
+				if err := mt.prepareRequest(req); err != nil {
+					writeLogLine(w, map[string]interface{}{"level": "error", "message": "config resolve failed", "step_index": idx, "error": err.Error()})
+					return err
+				}
 				resp, exitCode = spawnStdio(ctx, tmp, pluginDir, req, w)
 
 			default:
@@ -253,19 +279,8 @@ func RunPluginCommand(ctx context.Context, envDir, pluginName, command string, p
 					}
 				}
 				if muts, ok := resp["mutations"].(map[string]interface{}); ok {
-					if g, ok := muts["global"].(map[string]interface{}); ok {
-						merged := config.MergeMapWithStrategy(globalCfg, g, strategy)
-						if err := config.SaveYAML(filepath.Join(envDir, "lyenv.yaml"), merged); err != nil {
-							return fmt.Errorf("failed to write global config: %w", err)
-						}
-						fmt.Printf("Global config updated (strategy=%s).\n", strategy)
-					}
-					if p, ok := muts["plugin"].(map[string]interface{}); ok && strings.TrimSpace(man.Config.LocalFile) != "" {
-						merged := config.MergeMapWithStrategy(pluginCfg, p, config.MergeOverride)
-						if err := config.SaveAny(filepath.Join(pluginDir, man.Config.LocalFile), merged); err != nil {
-							return fmt.Errorf("failed to write plugin config: %w", err)
-						}
-						fmt.Println("Plugin local config updated.")
+					if err := mt.apply(muts); err != nil {
+						return err
 					}
 				}
 				// Optional: echo stdio logs/artifacts
@@ -314,6 +329,10 @@ func RunPluginCommand(ctx context.Context, envDir, pluginName, command string, p
 	case "stdio":
 		// Pass args to stdio program if needed, and also via req["args"]
 		// spec.Args = append(spec.Args, passArgs...)
+		if err := mt.prepareRequest(req); err != nil {
+			writeLogLine(w, map[string]interface{}{"level": "error", "message": "config resolve failed", "error": err.Error()})
+			return err
+		}
 		resp, exitCode = spawnStdio(ctx, spec, pluginDir, req, w)
 
 	case "shell":
@@ -330,19 +349,8 @@ func RunPluginCommand(ctx context.Context, envDir, pluginName, command string, p
 			return fmt.Errorf("plugin error: %v", resp["message"])
 		}
 		if muts, ok := resp["mutations"].(map[string]interface{}); ok {
-			if g, ok := muts["global"].(map[string]interface{}); ok {
-				merged := config.MergeMapWithStrategy(globalCfg, g, strategy)
-				if err := config.SaveYAML(filepath.Join(envDir, "lyenv.yaml"), merged); err != nil {
-					return fmt.Errorf("failed to write merged global config: %w", err)
-				}
-				fmt.Printf("Global config updated (strategy=%s).\n", strategy)
-			}
-			if p, ok := muts["plugin"].(map[string]interface{}); ok && strings.TrimSpace(man.Config.LocalFile) != "" {
-				merged := config.MergeMapWithStrategy(pluginCfg, p, config.MergeOverride)
-				if err := config.SaveAny(filepath.Join(pluginDir, man.Config.LocalFile), merged); err != nil {
-					return fmt.Errorf("failed to write plugin config: %w", err)
-				}
-				fmt.Println("Plugin local config updated.")
+			if err := mt.apply(muts); err != nil {
+				return err
 			}
 		}
 		// Echo logs/artifacts
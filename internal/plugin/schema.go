@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lyenv/internal/config"
+)
+
+func init() {
+	config.RegisterSchemaProvider(namespaceSchemas)
+}
+
+// namespaceSchemas collects config.schema declarations of installed plugins
+// that also declare a config.namespace inside lyenv.yaml.
+func namespaceSchemas(envDir string) ([]config.NamespaceSchema, error) {
+	r, err := LoadRegistry(envDir)
+	if err != nil {
+		return nil, err
+	}
+	var out []config.NamespaceSchema
+	for _, p := range r.Plugins {
+		dir := filepath.Join(envDir, "plugins", p.InstallName)
+		man, err := LoadManifest(dir)
+		if err != nil || strings.TrimSpace(man.Config.Namespace) == "" {
+			continue
+		}
+		s, err := loadPluginSchema(dir, man)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.InstallName, err)
+		}
+		if s == nil {
+			continue
+		}
+		out = append(out, config.NamespaceSchema{
+			Owner:     p.InstallName,
+			Namespace: strings.TrimSpace(man.Config.Namespace),
+			Schema:    s,
+		})
+	}
+	return out, nil
+}
+
+// loadPluginSchema reads the manifest's config.schema file (nil when not declared).
+func loadPluginSchema(pluginDir string, man *PluginManifest) (config.Schema, error) {
+	if strings.TrimSpace(man.Config.Schema) == "" {
+		return nil, nil
+	}
+	s, err := config.LoadSchema(filepath.Join(pluginDir, man.Config.Schema))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config schema: %w", err)
+	}
+	return s, nil
+}
+
+// validateLocalConfig checks a plugin-local config map against the plugin schema.
+func validateLocalConfig(pluginDir string, man *PluginManifest, cfg map[string]interface{}) []config.Violation {
+	s, err := loadPluginSchema(pluginDir, man)
+	if err != nil {
+		return []config.Violation{{Message: err.Error()}}
+	}
+	if s == nil {
+		return nil
+	}
+	return s.Validate(cfg, "")
+}
+
+// ValidateEnvConfig validates lyenv.yaml (built-in and plugin namespace
+// schemas) and every installed plugin's local config file.
+func ValidateEnvConfig(envDir string) ([]config.Violation, error) {
+	cfg, err := config.LoadYAML(filepath.Join(envDir, "lyenv.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lyenv.yaml: %w", err)
+	}
+	var out []config.Violation
+	for _, v := range config.ValidateConfig(envDir, cfg) {
+		v.File = "lyenv.yaml"
+		out = append(out, v)
+	}
+
+	r, err := LoadRegistry(envDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range r.Plugins {
+		dir := filepath.Join(envDir, "plugins", p.InstallName)
+		man, err := LoadManifest(dir)
+		if err != nil || strings.TrimSpace(man.Config.LocalFile) == "" || strings.TrimSpace(man.Config.Schema) == "" {
+			continue
+		}
+		rel := filepath.ToSlash(filepath.Join("plugins", p.InstallName, man.Config.LocalFile))
+		local := map[string]interface{}{}
+		if _, err := os.Stat(filepath.Join(dir, man.Config.LocalFile)); err == nil {
+			if local, err = config.LoadAny(filepath.Join(dir, man.Config.LocalFile)); err != nil {
+				out = append(out, config.Violation{File: rel, Message: fmt.Sprintf("failed to read: %v", err)})
+				continue
+			}
+		}
+		for _, v := range validateLocalConfig(dir, man, local) {
+			v.File = rel
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
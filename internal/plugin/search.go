@@ -17,15 +17,21 @@ func SearchCenterPlugins(envDir string, keywords []string) ([]string, error) {
 		return nil, fmt.Errorf("missing keywords")
 	}
 	// Load registry_url; use cache if available
-	cfg, err := config.LoadYAML(filepath.Join(envDir, "lyenv.yaml"))
+	cfg, err := config.LoadEffective(envDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read lyenv.yaml: %w", err)
 	}
-	regURL := config.GetString(cfg, "plugins.registry_url")
+	regURL, err := config.GetResolvedString(envDir, cfg, "plugins.registry_url")
+	if err != nil {
+		return nil, err
+	}
 	if strings.TrimSpace(regURL) == "" {
 		return nil, fmt.Errorf("plugins.registry_url not configured")
 	}
-	proxy := config.GetString(cfg, "config.network.proxy_url")
+	proxy, err := config.GetResolvedString(envDir, cfg, "config.network.proxy_url")
+	if err != nil {
+		return nil, err
+	}
 
 	// Use cached index if present
 	cachePath := filepath.Join(envDir, ".lyenv", "registry", "index.yaml")
@@ -33,17 +39,17 @@ func SearchCenterPlugins(envDir string, keywords []string) ([]string, error) {
 	if _, err := os.Stat(cachePath); err == nil {
 		idx, err = config.LoadAny(cachePath)
 		if err != nil {
-			return nil, fmt.Errorf("invalid cached index: %w")
+			return nil, fmt.Errorf("invalid cached index: %w", err)
 		}
 	} else {
 		// fetch remote
-		path, err := fetchToTempOrUseLocal(regURL, proxy)
+		path, err := cachedIndex(envDir, regURL, proxy)
 		if err != nil {
 			return nil, fmt.Errorf("failed to fetch registry index: %w", err)
 		}
 		idx, err = config.LoadAny(path)
 		if err != nil {
-			return nil, fmt.Errorf("invalid registry index: %w")
+			return nil, fmt.Errorf("invalid registry index: %w", err)
 		}
 	}
 
@@ -0,0 +1,150 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Center version keys are compared as dotted numbers ("1.10.0" > "1.9.2"),
+// with an optional leading "v" and pre-release suffix ("1.2.0-rc1" <
+// "1.2.0"). Keys that are not numeric compare as plain strings.
+
+type semver struct {
+	nums  [3]int
+	parts int // how many numbers were given ("1.2" -> 2)
+	pre   string
+}
+
+func parseSemver(s string) (semver, bool) {
+	var v semver
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		s, v.pre = s[:i], s[i+1:]
+	}
+	fields := strings.Split(s, ".")
+	if s == "" || len(fields) > 3 {
+		return v, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.nums[i] = n
+	}
+	v.parts = len(fields)
+	return v, true
+}
+
+// compareVersions returns -1, 0 or 1 as a is older than, equal to or newer
+// than b.
+func compareVersions(a, b string) int {
+	va, okA := parseSemver(a)
+	vb, okB := parseSemver(b)
+	if !okA || !okB {
+		return strings.Compare(a, b)
+	}
+	for i := 0; i < 3; i++ {
+		if va.nums[i] != vb.nums[i] {
+			if va.nums[i] < vb.nums[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case va.pre == vb.pre:
+		return 0
+	case va.pre == "":
+		return 1
+	case vb.pre == "":
+		return -1
+	}
+	return strings.Compare(va.pre, vb.pre)
+}
+
+// matchVersion reports whether version satisfies constraint. A constraint is
+// one or more clauses separated by commas or spaces, all of which must hold:
+//
+//	""  "*"  "latest"    any version
+//	1.2.3  =1.2.3        exactly
+//	1.2  1.2.x  1.*      any version with that prefix
+//	^1.2.3               same major (same minor below 1.0.0), >= 1.2.3
+//	~1.2.3               same minor, >= 1.2.3
+//	>=1.2  >1.2  <2  <=2.1
+func matchVersion(constraint, version string) (bool, error) {
+	clauses := strings.FieldsFunc(constraint, func(r rune) bool { return r == ',' || r == ' ' })
+	for _, c := range clauses {
+		ok, err := matchClause(c, version)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchClause(c, version string) (bool, error) {
+	if c == "*" || c == "latest" {
+		return true, nil
+	}
+	op := ""
+	for _, p := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(c, p) {
+			op, c = p, strings.TrimSpace(c[len(p):])
+			break
+		}
+	}
+	if op == "" || op == "=" {
+		if trimmed := strings.TrimRight(strings.TrimSuffix(strings.TrimSuffix(c, ".x"), ".*"), "."); trimmed != c {
+			c = trimmed
+		}
+	}
+	want, ok := parseSemver(c)
+	if !ok {
+		return false, fmt.Errorf("invalid version constraint: %q", c)
+	}
+	cmp := compareVersions(version, c)
+	switch op {
+	case ">=":
+		return cmp >= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case "<":
+		return cmp < 0, nil
+	}
+	have, ok := parseSemver(version)
+	if !ok {
+		return version == c, nil
+	}
+	switch op {
+	case "^":
+		if cmp < 0 {
+			return false, nil
+		}
+		if want.nums[0] > 0 || want.parts == 1 {
+			return have.nums[0] == want.nums[0], nil
+		}
+		return have.nums[0] == 0 && have.nums[1] == want.nums[1], nil
+	case "~":
+		if cmp < 0 {
+			return false, nil
+		}
+		if want.parts == 1 {
+			return have.nums[0] == want.nums[0], nil
+		}
+		return have.nums[0] == want.nums[0] && have.nums[1] == want.nums[1], nil
+	}
+	// Exact, or a prefix when fewer than three numbers are given
+	for i := 0; i < want.parts; i++ {
+		if have.nums[i] != want.nums[i] {
+			return false, nil
+		}
+	}
+	return want.parts < 3 || have.pre == want.pre, nil
+}
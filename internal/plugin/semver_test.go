@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10.0", "1.9.2", 1},
+		{"1.2.0", "1.2.0", 0},
+		{"v1.2.0", "1.2.0", 0},
+		{"1.2", "1.2.0", 0},
+		{"1.2.0+build.5", "1.2.0", 0},
+		{"1.2.0-rc1", "1.2.0", -1},
+		{"1.2.0-rc1", "1.2.0-rc2", -1},
+		{"2.0.0-rc1", "1.9.9", 1},
+		{"0.0.1", "0.1.0", -1},
+		{"nightly", "stable", -1},
+	}
+	for _, tc := range cases {
+		if got := compareVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := compareVersions(tc.b, tc.a); got != -tc.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestParseSemver(t *testing.T) {
+	for _, s := range []string{"", "v", "1.2.3.4", "1.x", "a.b", "1..2", "-1"} {
+		if _, ok := parseSemver(s); ok {
+			t.Errorf("parseSemver(%q) accepted", s)
+		}
+	}
+	v, ok := parseSemver(" v1.2-beta.1+sha ")
+	if !ok || v.nums != [3]int{1, 2, 0} || v.parts != 2 || v.pre != "beta.1" {
+		t.Errorf("parseSemver = %+v, %v", v, ok)
+	}
+}
+
+func TestMatchVersion(t *testing.T) {
+	cases := []struct {
+		constraint string
+		match      []string
+		miss       []string
+	}{
+		{"", []string{"0.0.1", "9.9.9"}, nil},
+		{"*", []string{"1.0.0"}, nil},
+		{"latest", []string{"1.0.0"}, nil},
+		{"^1.2", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.2.2", "0.3.0", "1.2.3"}},
+		{"^0", []string{"0.0.1", "0.9.0"}, []string{"1.0.0"}},
+		{"~1.2.0", []string{"1.2.0", "1.2.9"}, []string{"1.1.9", "1.3.0"}},
+		{"~1", []string{"1.0.0", "1.5.0"}, []string{"2.0.0"}},
+		{"1.x", []string{"1.0.0", "1.4.2"}, []string{"0.9.0", "2.0.0"}},
+		{"1.*", []string{"1.0.0"}, []string{"2.0.0"}},
+		{"1.2", []string{"1.2.0", "1.2.7"}, []string{"1.3.0"}},
+		{"=1.2.3", []string{"1.2.3", "v1.2.3"}, []string{"1.2.4", "1.2.3-rc1"}},
+		{"1.2.3", []string{"1.2.3"}, []string{"1.2.30"}},
+		{">=1.0, <2", []string{"1.0.0", "1.9.9"}, []string{"0.9.0", "2.0.0"}},
+		{">=1.0 <2", []string{"1.5.0"}, []string{"2.1.0"}},
+		{">1.0.0", []string{"1.0.1"}, []string{"1.0.0"}},
+		{"<=2.1", []string{"2.1.0", "2.0.5"}, []string{"2.1.1"}},
+		{"1.x", nil, []string{"nightly"}},
+	}
+	for _, tc := range cases {
+		for _, v := range tc.match {
+			if ok, err := matchVersion(tc.constraint, v); !ok || err != nil {
+				t.Errorf("matchVersion(%q, %q) = %v, %v; want true", tc.constraint, v, ok, err)
+			}
+		}
+		for _, v := range tc.miss {
+			if ok, err := matchVersion(tc.constraint, v); ok || err != nil {
+				t.Errorf("matchVersion(%q, %q) = %v, %v; want false", tc.constraint, v, ok, err)
+			}
+		}
+	}
+	for _, c := range []string{"^abc", ">=", "~1.2.3.4", "1.0, bogus"} {
+		if _, err := matchVersion(c, "1.0.0"); err == nil || !strings.Contains(err.Error(), "invalid version constraint") {
+			t.Errorf("matchVersion(%q) error = %v", c, err)
+		}
+	}
+}
+
+func TestPickVersionKey(t *testing.T) {
+	versions := map[string]interface{}{"0.9.0": nil, "0.10.0": nil, "1.0.0": nil, "1.1.0": nil}
+	cases := []struct {
+		want, got string
+	}{
+		{"", "1.1.0"},
+		{"latest", "1.1.0"},
+		{"0.10.0", "0.10.0"},
+		{"^0.9", "0.9.0"},
+		{"^1", "1.1.0"},
+		{"~1.0", "1.0.0"},
+		{"<1", "0.10.0"},
+		{"0", "0.10.0"},
+		{"^3", ""},
+	}
+	for _, tc := range cases {
+		got, err := pickVersionKey(versions, tc.want)
+		if err != nil || got != tc.got {
+			t.Errorf("pickVersionKey(%q) = %q, %v; want %q", tc.want, got, err, tc.got)
+		}
+	}
+	// A key is taken as written even when it is not a version.
+	if got, err := pickVersionKey(map[string]interface{}{"edge": nil, "1.0.0": nil}, "edge"); got != "edge" || err != nil {
+		t.Errorf("pickVersionKey(edge) = %q, %v", got, err)
+	}
+	if _, err := pickVersionKey(versions, "^x"); err == nil {
+		t.Error("pickVersionKey accepted an invalid constraint")
+	}
+}
+
+func TestUpgradable(t *testing.T) {
+	cases := []struct {
+		current, wanted string
+		want            bool
+	}{
+		{"1.9.0", "1.10.0", true},
+		{"1.2.0-rc1", "1.2.0", true},
+		{"1.2.0", "1.2.0", false},
+		{"1.2.0", "", false},
+	}
+	for _, tc := range cases {
+		o := OutdatedPlugin{Current: tc.current, Wanted: tc.wanted}
+		if got := o.Upgradable(); got != tc.want {
+			t.Errorf("Upgradable(%q -> %q) = %v", tc.current, tc.wanted, got)
+		}
+	}
+}
@@ -4,24 +4,34 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strings"
 )
 
+// CreateShims writes one launcher per exposed command. Shims pin the
+// environment with --env=<absolute envDir>, so they work from any directory
+// and are unaffected by LYENV_HOME.
 func CreateShims(envDir, installName string, expose []string) error {
-	binDir := filepath.Join(envDir, "bin")
+	home, err := filepath.Abs(envDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve environment directory: %w", err)
+	}
+	binDir := filepath.Join(home, "bin")
 	if err := os.MkdirAll(binDir, 0o755); err != nil {
 		return err
 	}
 	for _, name := range expose {
 		if runtime.GOOS == "windows" {
-			if err := createCmdShim(binDir, name, installName); err != nil {
+			if err := createCmdShim(binDir, home, name, installName); err != nil {
 				return err
 			}
-			if err := createPsShim(binDir, name, installName); err != nil {
+			if err := createPsShim(binDir, home, name, installName); err != nil {
 				return err
 			}
 		} else {
-			if err := createUnixShim(binDir, name, installName); err != nil {
+			if err := createUnixShim(binDir, home, name, installName); err != nil {
 				return err
 			}
 		}
@@ -29,35 +39,34 @@ func CreateShims(envDir, installName string, expose []string) error {
 	return nil
 }
 
-func createUnixShim(binDir, shimName, installName string) error {
+func createUnixShim(binDir, home, shimName, installName string) error {
 	shimPath := filepath.Join(binDir, shimName)
 	content := fmt.Sprintf(`#!/usr/bin/env bash
 set -euo pipefail
 # Prefer LYENV_BIN from environment; fallback to 'lyenv' in PATH
-exec "${LYENV_BIN:-lyenv}" run %s "$@"
-`, installName)
+exec "${LYENV_BIN:-lyenv}" --env=%s run %s "$@"
+`, "'"+strings.ReplaceAll(home, "'", `'\''`)+"'", installName)
 	return os.WriteFile(shimPath, []byte(content), 0o755)
 }
 
-func createCmdShim(binDir, shimName, installName string) error {
+func createCmdShim(binDir, home, shimName, installName string) error {
 	shimPath := filepath.Join(binDir, shimName+".cmd")
 	content := fmt.Sprintf(`@echo off
 setlocal
 set "_LYBIN=%%LYENV_BIN%%"
 if "%%_LYBIN%%"=="" set "_LYBIN=lyenv"
-%%_LYBIN%% run %s %%*
-`, installName)
+%%_LYBIN%% "--env=%s" run %s %%*
+`, home, installName)
 	return os.WriteFile(shimPath, []byte(content), 0o644)
 }
 
-
-func createPsShim(binDir, shimName, installName string) error {
+func createPsShim(binDir, home, shimName, installName string) error {
 	shimPath := filepath.Join(binDir, shimName+".ps1")
 	content := fmt.Sprintf(`#!/usr/bin/env pwsh
 $lybin = $env:LYENV_BIN
 if ([string]::IsNullOrEmpty($lybin)) { $lybin = "lyenv" }
-& $lybin run %s $args
-`, installName)
+& $lybin '--env=%s' run %s $args
+`, strings.ReplaceAll(home, "'", "''"), installName)
 	return os.WriteFile(shimPath, []byte(content), 0o644)
 }
 
@@ -77,3 +86,143 @@ func DeleteShims(envDir string, expose []string) error {
 	}
 	return nil
 }
+
+var shimPattern = regexp.MustCompile(`(?:--env=['"]?([^'"]+?)['"]?\s+)?run\s+(\S+)`)
+
+// ReadShim parses a shim written by CreateShims and returns the install name
+// it runs and the environment it is pinned to ("" for shims generated before
+// shims were pinned). ok is false if the file is not a lyenv shim.
+func ReadShim(path string) (installName, envDir string, ok bool) {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) > 4096 {
+		return "", "", false
+	}
+	m := shimPattern.FindStringSubmatch(string(data))
+	if m == nil || !strings.Contains(string(data), "LYENV_BIN") {
+		return "", "", false
+	}
+	return m[2], m[1], true
+}
+
+// ShimConflict is an exposed command whose shim another install provides.
+type ShimConflict struct {
+	Shim  string
+	Owner string
+}
+
+// SyncShims moves the shims of installName from old (what the registry
+// records) to expose: dropped shims are deleted, new ones created. A shim
+// another registered install already provides is left to it and returned as
+// a conflict, so side-by-side installs of one plugin do not steal each
+// other's commands. owned is what installName provides afterwards.
+func SyncShims(envDir, installName string, old, expose []string) (owned []string, conflicts []ShimConflict, err error) {
+	owners, err := shimOwners(envDir, installName)
+	if err != nil {
+		return nil, nil, err
+	}
+	keep := map[string]bool{}
+	for _, s := range expose {
+		if owner, taken := owners[s]; taken {
+			conflicts = append(conflicts, ShimConflict{Shim: s, Owner: owner})
+			continue
+		}
+		if !keep[s] {
+			keep[s] = true
+			owned = append(owned, s)
+		}
+	}
+	var dropped []string
+	for _, s := range old {
+		if !keep[s] {
+			if _, taken := owners[s]; !taken {
+				dropped = append(dropped, s)
+			}
+		}
+	}
+	if err := CreateShims(envDir, installName, owned); err != nil {
+		return nil, nil, err
+	}
+	if err := ReleaseShims(envDir, installName, dropped); err != nil {
+		return nil, nil, err
+	}
+	return owned, conflicts, nil
+}
+
+// shimOwners maps each shim recorded by an install other than installName
+// to that install.
+func shimOwners(envDir, installName string) (map[string]string, error) {
+	r, err := LoadRegistry(envDir)
+	if err != nil {
+		return nil, err
+	}
+	owners := map[string]string{}
+	for _, p := range r.Plugins {
+		if p.InstallName == installName {
+			continue
+		}
+		for _, s := range p.Shims {
+			owners[s] = p.InstallName
+		}
+	}
+	return owners, nil
+}
+
+// ReleaseShims deletes shims installName no longer provides and hands each
+// one to the next other registered install whose manifest exposes it.
+func ReleaseShims(envDir, installName string, shims []string) error {
+	if len(shims) == 0 {
+		return nil
+	}
+	if err := DeleteShims(envDir, shims); err != nil {
+		return err
+	}
+	r, err := LoadRegistry(envDir)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, s := range shims {
+		for i := range r.Plugins {
+			p := &r.Plugins[i]
+			if p.InstallName == installName {
+				continue
+			}
+			man, err := LoadManifest(filepath.Join(envDir, "plugins", p.InstallName))
+			if err != nil || !slices.Contains(man.Expose, s) || slices.Contains(p.Shims, s) {
+				continue
+			}
+			if err := CreateShims(envDir, p.InstallName, []string{s}); err != nil {
+				return err
+			}
+			p.Shims = append(p.Shims, s)
+			changed = true
+			fmt.Printf("Shim bin/%s now runs %s\n", s, p.InstallName)
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return SaveRegistry(envDir, r)
+}
+
+func printShimConflicts(installName string, conflicts []ShimConflict) {
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "Warning: bin/%s is provided by %s; not exposed for %s (use: lyenv run %s ...)\n", c.Shim, c.Owner, installName, installName)
+	}
+}
+
+// exposeShims syncs installName's shims from its current registry record
+// (none for a fresh install) to expose and warns about conflicts.
+func exposeShims(envDir, installName string, expose []string) ([]string, error) {
+	var old []string
+	if rec, err := GetByInstallName(envDir, installName); err == nil {
+		old = rec.Shims
+	}
+	owned, conflicts, err := SyncShims(envDir, installName, old, expose)
+	if err != nil {
+		return nil, err
+	}
+	printShimConflicts(installName, conflicts)
+	return owned, nil
+}
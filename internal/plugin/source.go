@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sourceSpec says where a plugin tree comes from.
+type sourceSpec struct {
+	Kind    string // local|git|git-subpath|archive|url
+	URL     string // local path, org/repo, or archive URL
+	Ref     string // git ref
+	Subpath string // git-subpath: directory inside the monorepo
+	Sha256  string // archive checksum from the plugin center
+}
+
+// centerSource turns a resolved center record into a source.
+func centerSource(rec *CenterRecord) sourceSpec {
+	if strings.TrimSpace(rec.Source) != "" {
+		return sourceSpec{Kind: detectSourceType(rec.Source), URL: rec.Source, Sha256: strings.TrimSpace(rec.Sha256)}
+	}
+	return sourceSpec{Kind: "git-subpath", URL: rec.Repo, Ref: rec.Ref, Subpath: rec.Subpath}
+}
+
+// fetchSource writes the plugin tree described by s to targetDir. For
+// archives it returns the SHA-256 kept in the plugin store ("" if none).
+func fetchSource(envDir, installName string, s sourceSpec, proxy, targetDir string) (string, error) {
+	switch s.Kind {
+	case "local":
+		if err := copyDir(s.URL, targetDir); err != nil {
+			return "", fmt.Errorf("failed to install local plugin: %w", err)
+		}
+
+	case "git":
+		work, err := cachedCheckout(envDir, repoURL(s.URL, ""), repoURL(s.URL, proxy), strings.TrimSpace(s.Ref))
+		if err != nil {
+			return "", err
+		}
+		if err := copyCheckout(work, targetDir); err != nil {
+			return "", fmt.Errorf("failed to copy checkout to target: %w", err)
+		}
+
+	case "git-subpath":
+		work, err := cloneSparseSubpath(envDir, "https://github.com/"+strings.TrimSpace(s.URL), strings.TrimSpace(s.Ref), proxy)
+		if err != nil {
+			return "", err
+		}
+		subAbs := filepath.Join(work, s.Subpath)
+		if _, err := os.Stat(subAbs); err != nil {
+			return "", fmt.Errorf("subpath not found in monorepo: %s", s.Subpath)
+		}
+		if err := copyDir(subAbs, targetDir); err != nil {
+			return "", fmt.Errorf("failed to copy subpath to target: %w", err)
+		}
+
+	case "archive", "url":
+		if strings.TrimSpace(s.URL) == "" {
+			return "", fmt.Errorf("%s source URL is empty", s.Kind)
+		}
+		if s.Kind == "url" && !strings.HasSuffix(strings.ToLower(s.URL), ".zip") {
+			return "", fmt.Errorf("unsupported URL type: %s (only .zip supported)", s.URL)
+		}
+		tmp, err := fetchArchive(envDir, s.URL, s.Sha256, proxy)
+		if err != nil {
+			return "", err
+		}
+		sum := keepArchive(envDir, installName, tmp)
+		if err := extractArchive(tmp, s.Kind, targetDir); err != nil {
+			return "", err
+		}
+		return sum, nil
+
+	default:
+		return "", fmt.Errorf("unsupported source type: %s", s.Kind)
+	}
+	return "", nil
+}
+
+// record stores s in ip so that `plugin update` can find it again.
+func (s sourceSpec) record(ip *InstalledPlugin) {
+	ip.Kind = s.Kind
+	ip.URL = s.URL
+	ip.Ref = strings.TrimSpace(s.Ref)
+	ip.Subpath = s.Subpath
+	ip.Source = s.Kind
+	// For git-subpath, store repo URL for info
+	if s.Kind == "git-subpath" {
+		ip.Source = "https://github.com/" + strings.TrimSpace(s.URL)
+	}
+	if s.Kind == "local" {
+		ip.URL = ""
+	}
+}
@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lyenv/internal/config"
+	"lyenv/internal/env"
+)
+
+// PluginStateFile returns the absolute path of the plugin's state file
+// (config.state_file), or "" when the manifest declares none.
+func PluginStateFile(pluginDir string, man *PluginManifest) string {
+	sf := strings.TrimSpace(man.Config.StateFile)
+	if sf == "" {
+		return ""
+	}
+	return filepath.Join(pluginDir, sf)
+}
+
+// LoadPluginState reads the plugin's state file, creating an empty one on
+// first use. Plugins without config.state_file have no state.
+func LoadPluginState(pluginDir string, man *PluginManifest) (map[string]interface{}, error) {
+	p := PluginStateFile(pluginDir, man)
+	if p == "" {
+		return nil, fmt.Errorf("plugin %s declares no config.state_file", man.Name)
+	}
+	st, err := config.LoadAny(p)
+	if os.IsNotExist(err) {
+		st = map[string]interface{}{}
+		if err := SavePluginState(p, st); err != nil {
+			return nil, err
+		}
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin state: %w", err)
+	}
+	if st == nil {
+		st = map[string]interface{}{}
+	}
+	return st, nil
+}
+
+// SavePluginState writes a plugin state file atomically in the format given
+// by its extension.
+func SavePluginState(path string, st map[string]interface{}) error {
+	out, err := config.DetectFormat(path).Encode(st)
+	if err != nil {
+		return fmt.Errorf("failed to encode plugin state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to write plugin state: %w", err)
+	}
+	if err := env.WriteFileAtomic(path, out, 0o644); err != nil {
+		return fmt.Errorf("failed to write plugin state: %w", err)
+	}
+	return nil
+}
+
+// carryPluginState copies the state file of a replaced install into the new
+// one, since state belongs to the environment rather than to a release.
+func carryPluginState(oldDir string, oldMan *PluginManifest, newDir string, newMan *PluginManifest) error {
+	if oldMan == nil {
+		return nil
+	}
+	src, dst := PluginStateFile(oldDir, oldMan), PluginStateFile(newDir, newMan)
+	if src == "" || dst == "" {
+		return nil
+	}
+	st, err := config.LoadAny(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return SavePluginState(dst, st)
+}
+
+// forgetComponents drops the components a removed plugin reported.
+func forgetComponents(envDir, installName string) {
+	_ = env.UpdateState(envDir, func(s *env.State) error {
+		s.RemoveComponents(installName)
+		return nil
+	})
+}
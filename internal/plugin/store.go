@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lyenv/internal/config"
+	"lyenv/internal/env"
+	"lyenv/internal/store"
+)
+
+// storeEnabled reports whether plugin trees are linked from the user-level
+// store (plugins.store: link, the default) rather than kept as private
+// copies (plugins.store: copy).
+func storeEnabled(envDir string) bool {
+	cfg, _ := config.LoadEffective(envDir)
+	return strings.TrimSpace(config.GetString(cfg, "plugins.store")) != "copy"
+}
+
+// linkFromStore moves a freshly installed plugin tree into the store and
+// replaces dir with links to it. The manifest's local_file and state_file
+// stay private writable copies. It returns the tree hash, or "" when the
+// store is disabled.
+func linkFromStore(envDir, installName, dir string, man *PluginManifest) (string, error) {
+	if !storeEnabled(envDir) {
+		return "", nil
+	}
+	hash, err := store.PutTree(dir)
+	if err != nil {
+		return "", err
+	}
+	private := map[string]bool{}
+	for _, f := range []string{man.Config.LocalFile, man.Config.StateFile} {
+		if f = strings.TrimSpace(f); f != "" {
+			private[filepath.ToSlash(filepath.Clean(f))] = true
+		}
+	}
+	staging := dir + ".store-tmp"
+	_ = os.RemoveAll(staging)
+	if err := store.LinkTree(hash, staging, private); err != nil {
+		_ = os.RemoveAll(staging)
+		return "", fmt.Errorf("failed to link plugin from store: %w", err)
+	}
+	if err := os.Rename(filepath.Join(dir, "logs"), filepath.Join(staging, "logs")); err != nil {
+		_ = EnsureLogsDir(staging)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		_ = os.RemoveAll(staging)
+		return "", fmt.Errorf("failed to replace plugin directory: %w", err)
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		return "", fmt.Errorf("failed to replace plugin directory: %w", err)
+	}
+	if err := store.AddRef(hash, envDir, installName); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// keepArchive adds a downloaded archive to the store and returns its SHA-256.
+// Failing to store it only costs a future download, so errors are warnings.
+func keepArchive(envDir, installName, path string) string {
+	if !storeEnabled(envDir) {
+		return ""
+	}
+	sum, err := store.PutArchive(path)
+	if err == nil {
+		err = store.AddRef(sum, envDir, installName)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: archive not kept in plugin store: %v\n", err)
+		return ""
+	}
+	return sum
+}
+
+// UsesStoreEntry reports whether installName in envDir still records the
+// store tree or archive hash; `lyenv store gc` keeps only such entries.
+func UsesStoreEntry(envDir, installName, hash string) bool {
+	if !env.IsLyenvDir(envDir) {
+		return false
+	}
+	rec, err := GetByInstallName(envDir, installName)
+	return err == nil && (rec.StoreHash == hash || rec.Sha256 == hash)
+}
+
+// AddStoreRefs records every store entry the environment's registry uses,
+// e.g. after cloning an environment whose plugins link to the store.
+func AddStoreRefs(envDir string) error {
+	r, err := LoadRegistry(envDir)
+	if err != nil {
+		return err
+	}
+	for _, ip := range r.Plugins {
+		for _, h := range []string{ip.StoreHash, ip.Sha256} {
+			if h == "" {
+				continue
+			}
+			if err := store.AddRef(h, envDir, ip.InstallName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -3,8 +3,8 @@ package plugin
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -12,141 +12,100 @@ import (
 )
 
 // PluginUpdate updates an installed plugin in-place.
-// - installName: physical directory under plugins/
-// - optRepo/optRef/optSource/optProxy override the original source if provided; otherwise fallback to registry record.
-func PluginUpdate(envDir, installName, optRepo, optRef, optSource, optProxy string) error {
-	pluginsDir := filepath.Join(envDir, "plugins")
-	installDir := filepath.Join(pluginsDir, installName)
-
-	rec, err := GetByInstallName(envDir, installName)
+// - name: install name (physical directory under plugins/), or the plugin name when installed once
+// - optRepo/optSource/optProxy override the original source if provided; otherwise fallback to registry record.
+// - optRef: git ref, or for plugin center installs a new version constraint
+// Center installs are resolved through the center again, honoring the
+// recorded version constraint; an archive already at that version is left
+// as is and false is returned.
+func PluginUpdate(envDir, name, optRepo, optRef, optSource, optProxy string) (bool, error) {
+	rec, err := findInstall(envDir, name)
 	if err != nil {
-		return fmt.Errorf("plugin not found in registry: %s", installName)
+		return false, err
 	}
+	installName := rec.InstallName
+	pluginsDir := filepath.Join(envDir, "plugins")
+	installDir := filepath.Join(pluginsDir, installName)
 
-	// Decide source type
-	srcType := ""
+	// Decide source
 	repo := strings.TrimSpace(optRepo)
 	ref := strings.TrimSpace(optRef)
 	source := strings.TrimSpace(optSource)
-
-	if repo != "" {
-		srcType = "git"
-	} else if source != "" {
-		st := detectSourceType(source)
-		if st == "archive" || st == "url" {
-			srcType = st
+	spec := sourceSpec{Kind: rec.SourceKind(), URL: rec.URL, Ref: rec.Ref, Subpath: rec.Subpath}
+	center, constraint := rec.CenterName(), rec.Constraint
+
+	switch {
+	case repo != "":
+		spec = sourceSpec{Kind: "git", URL: repo, Ref: ref}
+		center, constraint = "", ""
+	case source != "":
+		spec = sourceSpec{Kind: detectSourceType(source), URL: source}
+		center, constraint = "", ""
+	case center != "":
+		if ref != "" {
+			constraint = ref
 		}
-	} else {
-		// fallback to registry Source
-		switch rec.Source {
-		case "git":
-			srcType = "git"
-			// we don't know original org/repo string; rec.Source stored a final URL
-			// let repoURL() handle proxy prefix, so we reconstruct from rec.Source directly
-			source = rec.Source
-		case "archive", "url", "local":
-			srcType = rec.Source
+		crec, err := ResolveFromCenterMonorepo(envDir, center, constraint)
+		if err != nil {
+			return false, fmt.Errorf("failed to resolve from plugin center: %w", err)
+		}
+		spec = centerSource(crec)
+		if spec.Subpath == "" && crec.Version != "" && compareVersions(crec.Version, rec.Version) == 0 {
+			fmt.Printf("Already up to date: %s %s\n", installName, rec.Version)
+			rec.Center, rec.Constraint = center, constraint
+			return false, RegisterInstall(envDir, *rec)
+		}
+	default:
+		if ref != "" {
+			spec.Ref = ref
+		}
+		switch spec.Kind {
+		case "local":
+			// Update from current install directory itself? Not meaningful.
+			// If user wants local update, they should call add/install again.
+			return false, fmt.Errorf("local update not supported; use 'plugin add' to reinstall from local path")
+		case "git", "git-subpath", "archive", "url":
+			if spec.URL == "" {
+				return false, fmt.Errorf("no source recorded for %s; pass --source=<url> or --repo=<org/repo>", installName)
+			}
 		default:
-			return fmt.Errorf("unknown source in registry: %s", rec.Source)
+			return false, fmt.Errorf("unknown source in registry: %s", rec.Source)
 		}
 	}
 
 	// Proxy fallback from lyenv.yaml if not provided
 	if strings.TrimSpace(optProxy) == "" {
-		cfg, _ := config.LoadYAML(filepath.Join(envDir, "lyenv.yaml"))
-		if v, ok := config.GetByPath(cfg, "config.network.proxy_url"); ok {
-			if s, ok2 := v.(string); ok2 && strings.TrimSpace(s) != "" {
-				optProxy = strings.TrimSpace(s)
-			}
+		cfg, _ := config.LoadEffective(envDir)
+		proxy, err := config.GetResolvedString(envDir, cfg, "config.network.proxy_url")
+		if err != nil {
+			return false, err
 		}
+		optProxy = strings.TrimSpace(proxy)
 	}
 
 	// Prepare temp dir for safe update
 	tmp := filepath.Join(os.TempDir(), installName+"-update")
 	_ = os.RemoveAll(tmp)
-	if err := os.MkdirAll(tmp, 0o755); err != nil {
-		return err
-	}
-
-	switch srcType {
-	case "git":
-		if _, err := exec.LookPath("git"); err != nil {
-			return fmt.Errorf("'git' is not available. Please install git")
-		}
-		// Build clone command: if repo provided use repoURL(repo, proxy), else use 'source' URL from registry
-		var cloneURL string
-		if repo != "" {
-			cloneURL = repoURL(repo, optProxy)
-		} else {
-			cloneURL = source
-		}
-		args := []string{"clone"}
-		if ref != "" {
-			args = append(args, "--branch", ref)
-		}
-		args = append(args, "--depth", "1", cloneURL, tmp)
-		cmd := exec.Command("git", args...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("git clone failed: %w", err)
-		}
-
-	case "archive":
-		if _, err := exec.LookPath("tar"); err != nil {
-			return fmt.Errorf("'tar' is not available")
-		}
-		tgz := filepath.Join(os.TempDir(), installName+"-update.tgz")
-		if source == "" {
-			return fmt.Errorf("archive source URL is empty")
-		}
-		if err := fetchURL(source, tgz, optProxy); err != nil {
-			return err
-		}
-		cmd := exec.Command("tar", "-xzf", tgz, "-C", tmp, "--strip-components=1")
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("tar extract failed: %w", err)
-		}
-
-	case "url":
-		if _, err := exec.LookPath("unzip"); err != nil {
-			return fmt.Errorf("'unzip' is not available")
-		}
-		if source == "" {
-			return fmt.Errorf("zip source URL is empty")
-		}
-		zipf := filepath.Join(os.TempDir(), installName+"-update.zip")
-		if err := fetchURL(source, zipf, optProxy); err != nil {
-			return err
-		}
-		cmd := exec.Command("unzip", "-o", zipf, "-d", tmp)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("unzip failed: %w", err)
-		}
-
-	case "local":
-		// Update from current install directory itself? Not meaningful.
-		// If user wants local update, they should call add/install again.
-		return fmt.Errorf("local update not supported; use 'plugin add' to reinstall from local path")
-
-	default:
-		return fmt.Errorf("unsupported source type for update: %s", srcType)
+	defer os.RemoveAll(tmp)
+	archiveSum, err := fetchSource(envDir, installName, spec, optProxy, tmp)
+	if err != nil {
+		return false, err
 	}
 
 	// Validate manifest before replacing
 	man, err := LoadManifest(tmp)
 	if err != nil {
-		return err
+		return false, err
 	}
 	if err := ValidateManifestStruct(man); err != nil {
-		return err
+		return false, err
+	}
+	if _, err := loadPluginSchema(tmp, man); err != nil {
+		return false, err
 	}
 
 	// Replace install directory atomically (best-effort)
+	oldMan, _ := LoadManifest(installDir)
 	backup := installDir + ".bak"
 	_ = os.RemoveAll(backup)
 	if err := os.Rename(installDir, backup); err != nil {
@@ -156,27 +115,73 @@ func PluginUpdate(envDir, installName, optRepo, optRef, optSource, optProxy stri
 	if err := os.Rename(tmp, installDir); err != nil {
 		// restore on failure
 		_ = os.Rename(backup, installDir)
-		return fmt.Errorf("failed to replace plugin directory: %w", err)
+		return false, fmt.Errorf("failed to replace plugin directory: %w", err)
+	}
+	_ = NormalizePluginPermissions(installDir)
+	hash, err := linkFromStore(envDir, installName, installDir, man)
+	if err != nil {
+		_ = os.RemoveAll(installDir)
+		_ = os.Rename(backup, installDir)
+		return false, err
+	}
+	if err := carryPluginState(backup, oldMan, installDir, man); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: plugin state not carried over: %v\n", err)
 	}
 	_ = os.RemoveAll(backup)
 
-	// Recreate shims (expose may change)
-	if err := CreateShims(envDir, man.Name, man.Expose); err != nil {
-		return err
+	// Shims run the install name; add newly exposed ones, drop the rest
+	oldShims := rec.Shims
+	shims, conflicts, err := SyncShims(envDir, installName, oldShims, man.Expose)
+	if err != nil {
+		return false, err
 	}
+	printShimConflicts(installName, conflicts)
 
 	// Update registry record
 	rec.Name = man.Name
 	rec.Version = man.Version
-	rec.Shims = man.Expose
+	rec.Shims = shims
 	rec.InstalledAt = time.Now().UTC()
+	rec.StoreHash = hash
+	rec.Sha256 = archiveSum
+	rec.Center = center
+	rec.Constraint = constraint
+	spec.record(rec)
 	if err := RegisterInstall(envDir, *rec); err != nil {
-		return err
+		return false, err
 	}
 
 	fmt.Println("Update completed.")
-	for _, e := range man.Expose {
+	for _, e := range shims {
 		fmt.Printf("Executable ensured: bin/%s\n", e)
 	}
-	return nil
+	for _, e := range oldShims {
+		if !slices.Contains(shims, e) {
+			fmt.Printf("Executable removed: bin/%s\n", e)
+		}
+	}
+	return true, nil
+}
+
+// findInstall returns the record of an install name, or of the only
+// install of a plugin name.
+func findInstall(envDir, name string) (*InstalledPlugin, error) {
+	if rec, err := GetByInstallName(envDir, name); err == nil {
+		return rec, nil
+	}
+	recs, err := FindByName(envDir, name)
+	if err != nil {
+		return nil, err
+	}
+	switch len(recs) {
+	case 0:
+		return nil, fmt.Errorf("plugin not found in registry: %s", name)
+	case 1:
+		return &recs[0], nil
+	}
+	names := make([]string, 0, len(recs))
+	for _, r := range recs {
+		names = append(names, r.InstallName)
+	}
+	return nil, fmt.Errorf("plugin %s is installed more than once (%s); use the install name", name, strings.Join(names, ", "))
 }
@@ -29,7 +29,7 @@ func copyDir(src, dst string) error {
 func fetchURL(url, outPath, proxy string) error {
 	var cmd *exec.Cmd
 	if _, err := exec.LookPath("curl"); err == nil {
-		args := []string{"-L", "-o", outPath, url}
+		args := []string{"-fL", "-o", outPath, url}
 		if proxy != "" {
 			args = append([]string{"-x", proxy}, args...)
 		}
@@ -44,3 +44,8 @@ func fetchURL(url, outPath, proxy string) error {
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// FetchURL downloads url to outPath with curl (or wget), honoring proxy.
+func FetchURL(url, outPath, proxy string) error {
+	return fetchURL(url, outPath, proxy)
+}
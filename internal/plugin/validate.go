@@ -2,7 +2,10 @@ package plugin
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
+
+	"lyenv/internal/config"
 )
 
 // ValidateManifestStruct performs lightweight validation based on a JSON-Schema subset.
@@ -27,6 +30,44 @@ func ValidateManifestStruct(m *PluginManifest) error {
 			}
 		}
 	}
+	// Config schema must stay inside the plugin directory
+	if sp := strings.TrimSpace(m.Config.Schema); sp != "" {
+		if filepath.IsAbs(sp) || strings.HasPrefix(filepath.Clean(sp), "..") {
+			return fmt.Errorf("manifest validation failed: config.schema must be a plugin-relative path")
+		}
+	}
+	// Local config must stay inside the plugin directory and use a known format
+	if lf := strings.TrimSpace(m.Config.LocalFile); lf != "" {
+		if filepath.IsAbs(lf) || strings.HasPrefix(filepath.Clean(lf), "..") {
+			return fmt.Errorf("manifest validation failed: config.local_file must be a plugin-relative path")
+		}
+		if !config.IsKnownFormat(lf) {
+			return fmt.Errorf("manifest validation failed: config.local_file has an unsupported format (supported: %s)", strings.Join(config.FormatNames(), ", "))
+		}
+	}
+	// State file holds nested values, so only YAML and JSON qualify
+	if sf := strings.TrimSpace(m.Config.StateFile); sf != "" {
+		if filepath.IsAbs(sf) || strings.HasPrefix(filepath.Clean(sf), "..") {
+			return fmt.Errorf("manifest validation failed: config.state_file must be a plugin-relative path")
+		}
+		if f := config.DetectFormat(sf); !config.IsKnownFormat(sf) || (f.Name != "yaml" && f.Name != "json") {
+			return fmt.Errorf("manifest validation failed: config.state_file must be a .yaml, .yml or .json file")
+		}
+	}
+	// Activation entries: valid variable names and plugin-relative PATH dirs
+	for k := range m.Activate.Env {
+		if !IsEnvName(k) {
+			return fmt.Errorf("manifest validation failed: activate.env has invalid variable name: %q", k)
+		}
+		if k == "PATH" || strings.HasPrefix(k, "LYENV_") {
+			return fmt.Errorf("manifest validation failed: activate.env must not set %s (use activate.path for PATH)", k)
+		}
+	}
+	for i, p := range m.Activate.Path {
+		if strings.TrimSpace(p) == "" || filepath.IsAbs(p) || strings.HasPrefix(filepath.Clean(p), "..") {
+			return fmt.Errorf("manifest validation failed: activate.path[%d] must be a plugin-relative directory", i)
+		}
+	}
 	// Commands or entry required
 	if len(m.Commands) == 0 && strings.TrimSpace(m.Entry.Path) == "" {
 		return fmt.Errorf("manifest validation failed: either 'commands' or 'entry.path' must be provided")
@@ -65,3 +106,17 @@ func ValidateManifestStruct(m *PluginManifest) error {
 	}
 	return nil
 }
+
+// IsEnvName reports whether s is a portable environment variable name, safe
+// to put into shell code unquoted.
+func IsEnvName(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return true
+}
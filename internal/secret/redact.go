@@ -0,0 +1,115 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Mask replaces secret values in redacted output.
+const Mask = "***"
+
+// minRedactLen avoids masking very short values (e.g. "1") that would
+// mangle unrelated log text.
+const minRedactLen = 4
+
+// Redactor masks known secret values in strings and log streams.
+type Redactor struct {
+	values []string
+}
+
+// NewRedactor builds a redactor for the given plaintext values. JSON-escaped
+// forms are included so values are also masked inside JSON Lines output.
+func NewRedactor(values ...string) *Redactor {
+	seen := map[string]bool{}
+	r := &Redactor{}
+	add := func(v string) {
+		if len(v) >= minRedactLen && !seen[v] {
+			seen[v] = true
+			r.values = append(r.values, v)
+		}
+	}
+	for _, v := range values {
+		add(v)
+		if b, err := json.Marshal(v); err == nil {
+			add(string(b[1 : len(b)-1]))
+		}
+	}
+	// Longest first so a secret containing another is masked as a whole.
+	sort.Slice(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+	return r
+}
+
+// LoadRedactor decrypts every secret of the environment (best-effort) and
+// returns a redactor for them.
+func LoadRedactor(envDir string) *Redactor {
+	names, _ := List(envDir)
+	var values []string
+	for _, n := range names {
+		if v, err := Get(envDir, n); err == nil {
+			values = append(values, v)
+		}
+	}
+	return NewRedactor(values...)
+}
+
+// String masks every known secret in s.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, Mask)
+	}
+	return s
+}
+
+// Strings masks every element of list (the input is not modified).
+func (r *Redactor) Strings(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = r.String(s)
+	}
+	return out
+}
+
+// Writer wraps w so every complete line is redacted before it is written.
+// A trailing partial line is held until the next newline or Close.
+func (r *Redactor) Writer(w io.Writer) io.WriteCloser {
+	return &redactWriter{r: r, w: w}
+}
+
+type redactWriter struct {
+	r   *Redactor
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (rw *redactWriter) Write(p []byte) (int, error) {
+	rw.buf.Write(p)
+	for {
+		i := bytes.IndexByte(rw.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(rw.buf.Next(i + 1))
+		if _, err := io.WriteString(rw.w, rw.r.String(line)); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Close flushes a pending partial line.
+func (rw *redactWriter) Close() error {
+	if rw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := io.WriteString(rw.w, rw.r.String(rw.buf.String()))
+	rw.buf.Reset()
+	return err
+}
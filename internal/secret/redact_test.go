@@ -0,0 +1,73 @@
+package secret
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRedactorString(t *testing.T) {
+	r := NewRedactor("hunter22", "hunter22-long", "abc", "quote\"d\\v", "")
+	cases := map[string]string{
+		"password=hunter22":           "password=***",
+		"x hunter22-long y":           "x *** y", // longest secret wins
+		"hunter22hunter22":            "******",
+		"abc is too short to mask":    "abc is too short to mask",
+		`raw quote"d\v`:               "raw ***",
+		`{"v":"quote\"d\\v"}`:         `{"v":"***"}`, // JSON-escaped form
+		"nothing secret here":         "nothing secret here",
+		"HUNTER22 differs by case":    "HUNTER22 differs by case",
+		"multi\nhunter22\nline hunt2": "multi\n***\nline hunt2",
+	}
+	for in, want := range cases {
+		if got := r.String(in); got != want {
+			t.Errorf("String(%q) = %q, want %q", in, got, want)
+		}
+	}
+	in := []string{"a hunter22", "b"}
+	if got := r.Strings(in); !reflect.DeepEqual(got, []string{"a ***", "b"}) || in[0] != "a hunter22" {
+		t.Errorf("Strings = %q (input now %q)", got, in)
+	}
+	if r.Strings(nil) != nil {
+		t.Error("Strings(nil) != nil")
+	}
+	var none *Redactor
+	if got := none.String("hunter22"); got != "hunter22" {
+		t.Errorf("nil redactor changed %q", got)
+	}
+}
+
+func TestRedactorWriter(t *testing.T) {
+	r := NewRedactor("topsecret")
+	var out bytes.Buffer
+	w := r.Writer(&out)
+	// A secret split across writes is still masked: lines are redacted whole.
+	for _, chunk := range []string{"token=tops", "ecret\nnext ", "line topsecret", " end\npartial tops", "ecret"} {
+		n, err := w.Write([]byte(chunk))
+		if err != nil || n != len(chunk) {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	if want := "token=***\nnext line *** end\n"; out.String() != want {
+		t.Errorf("before Close: %q, want %q", out.String(), want)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "token=***\nnext line *** end\npartial ***"; out.String() != want {
+		t.Errorf("after Close: %q, want %q", out.String(), want)
+	}
+}
+
+func TestLoadRedactor(t *testing.T) {
+	home := setup(t)
+	if err := Set(home, "api", "key-12345"); err != nil {
+		t.Fatal(err)
+	}
+	if got := LoadRedactor(home).String("Authorization: key-12345"); got != "Authorization: ***" {
+		t.Errorf("got %q", got)
+	}
+	if got := LoadRedactor(t.TempDir()).String("key-12345"); got != "key-12345" {
+		t.Errorf("environment without secrets masked %q", got)
+	}
+}
@@ -0,0 +1,179 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lyenv/internal/env"
+)
+
+// Secrets live in <env>/.lyenv/secrets/<name>.enc, encrypted with AES-256-GCM.
+// The key is kept outside the environment, in <user config dir>/secret.key,
+// so copying or committing an environment never exposes plaintext values.
+
+const fileHeader = "lyenv-secret:v1:"
+
+// ErrNotFound is returned when a secret does not exist.
+var ErrNotFound = errors.New("secret not found")
+
+// Dir returns the secrets directory of an environment.
+func Dir(envDir string) string {
+	return filepath.Join(envDir, ".lyenv", "secrets")
+}
+
+// KeyFile returns the path of the user-level encryption key.
+func KeyFile() string {
+	return filepath.Join(env.UserConfigDir(), "secret.key")
+}
+
+// ValidName reports whether name can be used as a secret name.
+func ValidName(name string) error {
+	if name == "" {
+		return fmt.Errorf("secret name must not be empty")
+	}
+	for _, r := range name {
+		if !(r == '-' || r == '_' || r == '.' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			return fmt.Errorf("invalid secret name: %q (allowed: letters, digits, '-', '_', '.')", name)
+		}
+	}
+	if strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid secret name: %q (must not start with '.')", name)
+	}
+	return nil
+}
+
+// loadKey reads the encryption key; when create is true a new random key is
+// generated on first use.
+func loadKey(create bool) ([]byte, error) {
+	p := KeyFile()
+	b, err := os.ReadFile(p)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid secret key file: %s", p)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, fmt.Errorf("failed to read secret key: %w", err)
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate secret key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(p, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write secret key: %w", err)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Set encrypts and stores a secret, replacing any previous value.
+func Set(envDir, name, value string) error {
+	if err := ValidName(name); err != nil {
+		return err
+	}
+	key, err := loadKey(true)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	// The name is bound as additional data so files cannot be swapped.
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(name))
+	if err := os.MkdirAll(Dir(envDir), 0o700); err != nil {
+		return err
+	}
+	content := fileHeader + base64.StdEncoding.EncodeToString(sealed) + "\n"
+	if err := os.WriteFile(filepath.Join(Dir(envDir), name+".enc"), []byte(content), 0o600); err != nil {
+		return fmt.Errorf("failed to write secret: %w", err)
+	}
+	return nil
+}
+
+// Get decrypts a stored secret.
+func Get(envDir, name string) (string, error) {
+	if err := ValidName(name); err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(filepath.Join(Dir(envDir), name+".enc"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	key, err := loadKey(false)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(b)), fileHeader))
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return "", fmt.Errorf("corrupted secret: %s", name)
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s (wrong key?)", name)
+	}
+	return string(plain), nil
+}
+
+// Remove deletes a stored secret.
+func Remove(envDir, name string) error {
+	if err := ValidName(name); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(Dir(envDir), name+".enc"))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return err
+}
+
+// List returns the names of stored secrets in sorted order.
+func List(envDir string) ([]string, error) {
+	entries, err := os.ReadDir(Dir(envDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".enc") {
+			out = append(out, strings.TrimSuffix(e.Name(), ".enc"))
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -0,0 +1,146 @@
+package secret
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// setup points the user key at a fresh directory and returns an environment.
+func setup(t *testing.T) string {
+	t.Helper()
+	t.Setenv("LYENV_CONFIG_DIR", t.TempDir())
+	return t.TempDir()
+}
+
+func TestSetGetRoundTrip(t *testing.T) {
+	home := setup(t)
+	for name, value := range map[string]string{
+		"token":     "s3cr3t-value",
+		"multi":     "line1\nline2\n",
+		"empty":     "",
+		"db.pass_1": "pa$$ word ✓",
+	} {
+		if err := Set(home, name, value); err != nil {
+			t.Fatalf("Set(%q): %v", name, err)
+		}
+		got, err := Get(home, name)
+		if err != nil || got != value {
+			t.Errorf("Get(%q) = %q, %v; want %q", name, got, err, value)
+		}
+		raw, err := os.ReadFile(filepath.Join(Dir(home), name+".enc"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(raw), fileHeader) || (value != "" && strings.Contains(string(raw), value)) {
+			t.Errorf("%s.enc is not an encrypted secret file: %q", name, raw)
+		}
+	}
+	names, err := List(home)
+	if err != nil || !reflect.DeepEqual(names, []string{"db.pass_1", "empty", "multi", "token"}) {
+		t.Errorf("List = %v, %v", names, err)
+	}
+	if runtime.GOOS != "windows" {
+		if fi, err := os.Stat(KeyFile()); err != nil || fi.Mode().Perm() != 0o600 {
+			t.Errorf("key file mode = %v, %v; want 0600", fi.Mode().Perm(), err)
+		}
+	}
+}
+
+func TestSetReplacesAndRemove(t *testing.T) {
+	home := setup(t)
+	if err := Set(home, "a", "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set(home, "a", "two"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := Get(home, "a"); got != "two" {
+		t.Errorf("Get after replace = %q", got)
+	}
+	if err := Remove(home, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get(home, "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Remove: %v, want ErrNotFound", err)
+	}
+	if err := Remove(home, "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Remove: %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetDetectsTampering(t *testing.T) {
+	home := setup(t)
+	if err := Set(home, "a", "alpha-value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set(home, "b", "bravo-value"); err != nil {
+		t.Fatal(err)
+	}
+	// Swapping files must not let one secret pass as another.
+	a := filepath.Join(Dir(home), "a.enc")
+	b, err := os.ReadFile(filepath.Join(Dir(home), "b.enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(a, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get(home, "a"); err == nil || !strings.Contains(err.Error(), "failed to decrypt secret a") {
+		t.Errorf("swapped file: %v", err)
+	}
+
+	if err := os.WriteFile(a, []byte(fileHeader+"!!!\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get(home, "a"); err == nil || !strings.Contains(err.Error(), "corrupted secret: a") {
+		t.Errorf("corrupted file: %v", err)
+	}
+}
+
+func TestGetWithOtherKey(t *testing.T) {
+	home := setup(t)
+	if err := Set(home, "a", "alpha-value"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LYENV_CONFIG_DIR", t.TempDir())
+	if _, err := Get(home, "a"); err == nil || !strings.Contains(err.Error(), "failed to read secret key") {
+		t.Errorf("missing key: %v", err)
+	}
+	if err := Set(t.TempDir(), "other", "x"); err != nil { // creates a new key
+		t.Fatal(err)
+	}
+	if _, err := Get(home, "a"); err == nil || !strings.Contains(err.Error(), "wrong key?") {
+		t.Errorf("wrong key: %v", err)
+	}
+	if err := os.WriteFile(KeyFile(), []byte("short\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get(home, "a"); err == nil || !strings.Contains(err.Error(), "invalid secret key file") {
+		t.Errorf("invalid key: %v", err)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for _, ok := range []string{"a", "A-b_c.1", "token2"} {
+		if err := ValidName(ok); err != nil {
+			t.Errorf("ValidName(%q): %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"", ".hidden", "a/b", "../x", "a b", "ü"} {
+		if err := ValidName(bad); err == nil {
+			t.Errorf("ValidName(%q) accepted", bad)
+		}
+	}
+	home := setup(t)
+	if err := Set(home, "../escape", "x"); err == nil {
+		t.Error("Set accepted a path as name")
+	}
+	if _, err := os.Stat(filepath.Join(home, ".lyenv", "escape.enc")); err == nil {
+		t.Error("Set wrote outside the secrets directory")
+	}
+}
@@ -0,0 +1,151 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"lyenv/internal/config"
+	"lyenv/internal/plugin"
+)
+
+// Var is one exported variable, in emission order.
+type Var struct {
+	Name  string
+	Value string
+}
+
+// Activation is everything `lyenv activate` applies to a shell.
+type Activation struct {
+	Home string   // absolute environment directory (LYENV_HOME)
+	Path []string // directories prepended to PATH, highest priority first
+	Vars []Var    // plugin activate.env first, then env.vars from lyenv.yaml
+}
+
+// Collect builds the activation for an environment: bin/ and plugin
+// activate.path entries go onto PATH; plugin activate.env and the env.vars
+// section of the effective config are exported (env.vars wins on conflicts).
+func Collect(envDir string) (*Activation, error) {
+	home, err := filepath.Abs(envDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve environment directory: %w", err)
+	}
+	a := &Activation{Home: home, Path: []string{filepath.Join(home, "bin")}}
+	vars := map[string]int{} // name -> index in a.Vars
+	set := func(name, value string) {
+		if i, ok := vars[name]; ok {
+			a.Vars[i].Value = value
+			return
+		}
+		vars[name] = len(a.Vars)
+		a.Vars = append(a.Vars, Var{Name: name, Value: value})
+	}
+	lookup := func(extra map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			if v, ok := extra[name]; ok {
+				return v, true
+			}
+			if i, ok := vars[name]; ok {
+				return a.Vars[i].Value, true
+			}
+			return os.LookupEnv(name)
+		}
+	}
+	builtins := map[string]string{
+		"LYENV_HOME": home,
+		"LYENV_BIN":  filepath.Join(home, "bin"),
+	}
+
+	r, err := plugin.LoadRegistry(envDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range r.Plugins {
+		dir := filepath.Join(home, "plugins", p.InstallName)
+		man, err := plugin.LoadManifest(dir)
+		if err != nil {
+			continue // a broken plugin must not break activation
+		}
+		for _, rel := range man.Activate.Path {
+			a.Path = append(a.Path, filepath.Join(dir, rel))
+		}
+		scope := map[string]string{"PLUGIN_DIR": dir}
+		for k, v := range builtins {
+			scope[k] = v
+		}
+		keys := sortedKeys(man.Activate.Env)
+		if invalidName(keys) != "" {
+			continue // edited after install; never emit it into shell code
+		}
+		for _, k := range keys {
+			set(k, expandVars(man.Activate.Env[k], lookup(scope)))
+		}
+	}
+
+	cfg, err := config.LoadEffective(envDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if raw, ok := config.GetByPath(cfg, "env.vars"); ok && raw != nil {
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("env.vars must be a map")
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if bad := invalidName(keys); bad != "" {
+			return nil, fmt.Errorf("env.vars has invalid variable name: %q", bad)
+		}
+		for _, k := range keys {
+			v := expandVars(fmt.Sprint(m[k]), lookup(builtins))
+			resolved, err := config.ResolveRefs(envDir, v)
+			if err != nil {
+				return nil, fmt.Errorf("env.vars.%s: %w", k, err)
+			}
+			set(k, resolved.(string))
+		}
+	}
+	return a, nil
+}
+
+// invalidName returns the first name that is not a portable variable name.
+// Names are written into shell code unquoted, and lyenv.yaml or a plugin
+// manifest may have been edited by hand, so they are checked on every read.
+func invalidName(names []string) string {
+	for _, n := range names {
+		if !plugin.IsEnvName(n) {
+			return n
+		}
+	}
+	return ""
+}
+
+// varPattern matches ${NAME}; "$${NAME}" escapes a literal "${NAME}".
+// Config references such as ${env:X} contain ':' and are left alone.
+var varPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandVars substitutes ${NAME} from lookup; unknown names expand to "".
+func expandVars(s string, lookup func(string) (string, bool)) string {
+	return varPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		v, _ := lookup(m[2 : len(m)-1])
+		return v
+	})
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,161 @@
+package shell
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata/")
+
+func sampleActivation() *Activation {
+	return &Activation{
+		Home: "/home/dev/my env",
+		Path: []string{"/home/dev/my env/bin", "/home/dev/my env/plugins/jdk/sdk/bin"},
+		Vars: []Var{
+			{Name: "JAVA_HOME", Value: "/home/dev/my env/plugins/jdk/sdk"},
+			{Name: "JAVA_OPTS", Value: `-Dname='x' -Dq="y" $HOME \path`},
+		},
+	}
+}
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("missing golden file (run go test ./internal/shell -update): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s mismatch\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func TestActivateGolden(t *testing.T) {
+	for _, name := range DialectNames() {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			dialects[name].Activate(&buf, sampleActivation())
+			checkGolden(t, "activate."+name+".golden", buf.Bytes())
+		})
+	}
+}
+
+func TestDeactivateGolden(t *testing.T) {
+	for _, name := range DialectNames() {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			dialects[name].Deactivate(&buf)
+			checkGolden(t, "deactivate."+name+".golden", buf.Bytes())
+		})
+	}
+}
+
+func TestLookupDialect(t *testing.T) {
+	for in, want := range map[string]string{"bash": "bash", "ZSH": "zsh", "pwsh": "powershell", "pwsh.exe": "powershell", "nushell": "nu", "-bash": "bash", "dash": "bash", "fish": "fish"} {
+		d, err := LookupDialect(in)
+		if err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if d.Name != want {
+			t.Errorf("%s: got %s, want %s", in, d.Name, want)
+		}
+	}
+	if _, err := LookupDialect("tcsh"); err == nil {
+		t.Error("expected error for unsupported shell")
+	}
+}
+
+func TestHookGolden(t *testing.T) {
+	for _, name := range DialectNames() {
+		d := dialects[name]
+		if d.Hook == nil {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			d.Hook(&buf)
+			checkGolden(t, "hook."+name+".golden", buf.Bytes())
+		})
+	}
+}
+
+func TestPlanHook(t *testing.T) {
+	for name, tc := range map[string]struct {
+		in   hookState
+		want hookPlan
+	}{
+		"enter trusted":        {hookState{Target: "/a", Allowed: true}, hookPlan{Activate: "/a"}},
+		"enter untrusted":      {hookState{Target: "/a"}, hookPlan{Notice: "/a"}},
+		"untrusted reported":   {hookState{Target: "/a", Denied: "/a"}, hookPlan{}},
+		"stay inside":          {hookState{Target: "/a", Allowed: true, Auto: "/a", Active: "/a"}, hookPlan{}},
+		"leave":                {hookState{Auto: "/a", Active: "/a"}, hookPlan{Deactivate: true, ClearAuto: true}},
+		"switch":               {hookState{Target: "/b", Allowed: true, Auto: "/a", Active: "/a"}, hookPlan{Deactivate: true, ClearAuto: true, Activate: "/b"}},
+		"manual activation":    {hookState{Target: "/b", Allowed: true, Active: "/m"}, hookPlan{}},
+		"manual over auto":     {hookState{Auto: "/a", Active: "/m"}, hookPlan{}},
+		"manually deactivated": {hookState{Target: "/a", Allowed: true, Auto: "/a"}, hookPlan{}},
+		"leave after manual":   {hookState{Auto: "/a"}, hookPlan{ClearAuto: true}},
+	} {
+		if got := planHook(tc.in); got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", name, got, tc.want)
+		}
+	}
+}
+
+// writeEnv creates a minimal environment with lyenv.yaml and one plugin
+// "tool" whose manifest carries the given activate section.
+func writeEnv(t *testing.T, lyenvYAML, activate string) string {
+	t.Helper()
+	t.Setenv("LYENV_CONFIG_DIR", t.TempDir())
+	home := t.TempDir()
+	files := map[string]string{
+		"lyenv.yaml":                     lyenvYAML,
+		".lyenv/registry/installed.yaml": "plugins:\n  - name: tool\n    install_name: tool\n",
+		"plugins/tool/manifest.yaml":     "name: tool\nversion: 1.0.0\nexpose: [tool]\nactivate:\n" + activate,
+	}
+	for rel, data := range files {
+		p := filepath.Join(home, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return home
+}
+
+func TestCollectHostileNamesGolden(t *testing.T) {
+	// A hand-edited plugin manifest with a key that would inject shell code
+	// is skipped as a whole; valid env.vars are still exported.
+	home := writeEnv(t,
+		"env:\n  vars:\n    GREETING: hi\n",
+		"  path: [bin]\n  env:\n    TOOL_HOME: ${PLUGIN_DIR}\n    \"X=1; echo PWNED; Y\": v\n")
+	a, err := Collect(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	dialects["bash"].Activate(&buf, a)
+	got := bytes.ReplaceAll(buf.Bytes(), []byte(a.Home), []byte("/ENV"))
+	if bytes.Contains(got, []byte("PWNED")) {
+		t.Fatalf("hostile name emitted:\n%s", got)
+	}
+	checkGolden(t, "collect.hostile.bash.golden", got)
+}
+
+func TestCollectRejectsHostileEnvVars(t *testing.T) {
+	for _, key := range []string{"X=1; echo PWNED; Y", "$(id)", "A B", "1X", "X`id`"} {
+		home := writeEnv(t, "env:\n  vars:\n    \""+key+"\": v\n", "  env: {}\n")
+		if _, err := Collect(home); err == nil {
+			t.Errorf("%q: expected error", key)
+		}
+	}
+}
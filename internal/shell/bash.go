@@ -0,0 +1,95 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	RegisterDialect(&Dialect{Name: "bash", Usage: `eval "$(lyenv activate --shell=bash)"`, Activate: renderBash, Deactivate: renderBashDeactivate,
+		Hook: renderBashHook, SetVar: bashSetVar, UnsetVar: bashUnsetVar})
+	RegisterDialect(&Dialect{Name: "zsh", Usage: `eval "$(lyenv activate --shell=zsh)"`, Activate: renderBash, Deactivate: renderBashDeactivate,
+		Hook: renderZshHook, SetVar: bashSetVar, UnsetVar: bashUnsetVar})
+}
+
+// renderBash writes a bash/zsh (POSIX sh) activation snippet. The original
+// PATH, PS1 and every overridden variable are saved in shell-local
+// _LYENV_OLD_* variables and restored by the generated lyenv_deactivate.
+// An environment that is already active is deactivated first.
+func renderBash(w io.Writer, a *Activation) {
+	vars := a.exported()
+	fmt.Fprintln(w, `if command -v lyenv_deactivate >/dev/null 2>&1; then lyenv_deactivate; fi`)
+	fmt.Fprintln(w, `_LYENV_OLD_PATH="$PATH"`)
+	for _, v := range vars {
+		fmt.Fprintf(w, "if [ -n \"${%[1]s+x}\" ]; then _LYENV_OLD_%[1]s=\"$%[1]s\"; fi\n", v.Name)
+	}
+	fmt.Fprintf(w, "export PATH=%s:\"$PATH\"\n", shQuote(strings.Join(a.Path, ":")))
+	for _, v := range vars {
+		fmt.Fprintf(w, "export %s=%s\n", v.Name, shQuote(v.Value))
+	}
+	// NOTE: PS1 may be undefined in non-interactive shells; guard it to avoid 'unbound variable' with 'set -u'.
+	fmt.Fprintln(w, `if [ -z "${LYENV_PROMPT_APPLIED+x}" ]; then`)
+	fmt.Fprintln(w, `  export LYENV_PROMPT_APPLIED=1`)
+	fmt.Fprintln(w, `  if [ -n "${PS1+x}" ]; then`)
+	fmt.Fprintln(w, `    _LYENV_OLD_PS1="$PS1"`)
+	fmt.Fprintln(w, `    PS1="(lyenv) ${PS1}"`)
+	fmt.Fprintln(w, `  fi`)
+	fmt.Fprintln(w, `fi`)
+
+	fmt.Fprintln(w, `lyenv_deactivate() {`)
+	fmt.Fprintln(w, `  if [ -n "${_LYENV_OLD_PATH+x}" ]; then export PATH="$_LYENV_OLD_PATH"; unset _LYENV_OLD_PATH; fi`)
+	fmt.Fprintln(w, `  if [ -n "${_LYENV_OLD_PS1+x}" ]; then PS1="$_LYENV_OLD_PS1"; unset _LYENV_OLD_PS1; fi`)
+	for _, v := range vars {
+		fmt.Fprintf(w, "  if [ -n \"${_LYENV_OLD_%[1]s+x}\" ]; then export %[1]s=\"$_LYENV_OLD_%[1]s\"; unset _LYENV_OLD_%[1]s; else unset %[1]s; fi\n", v.Name)
+	}
+	fmt.Fprintln(w, `  unset LYENV_PROMPT_APPLIED`)
+	fmt.Fprintln(w, `  unset -f lyenv_deactivate`)
+	fmt.Fprintln(w, `  hash -r 2>/dev/null || true`)
+	fmt.Fprintln(w, `}`)
+}
+
+// renderBashDeactivate writes the snippet printed by `lyenv deactivate`.
+func renderBashDeactivate(w io.Writer) {
+	fmt.Fprintln(w, `if command -v lyenv_deactivate >/dev/null 2>&1; then`)
+	fmt.Fprintln(w, `  lyenv_deactivate`)
+	fmt.Fprintln(w, `else`)
+	fmt.Fprintln(w, `  echo "lyenv: no active environment in this shell" >&2`)
+	fmt.Fprintln(w, `fi`)
+}
+
+// renderBashHook writes the ~/.bashrc snippet: eval "$(lyenv hook bash)".
+// The hook runs from PROMPT_COMMAND and preserves the last exit status.
+func renderBashHook(w io.Writer) {
+	fmt.Fprintln(w, `_lyenv_hook() {`)
+	fmt.Fprintln(w, `  local previous_exit_status=$?`)
+	fmt.Fprintln(w, `  eval "$(lyenv hook bash --apply)"`)
+	fmt.Fprintln(w, `  return $previous_exit_status`)
+	fmt.Fprintln(w, `}`)
+	fmt.Fprintln(w, `if [[ ";${PROMPT_COMMAND[*]:-};" != *";_lyenv_hook;"* ]]; then`)
+	fmt.Fprintln(w, `  PROMPT_COMMAND="_lyenv_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"`)
+	fmt.Fprintln(w, `fi`)
+}
+
+// renderZshHook writes the ~/.zshrc snippet: eval "$(lyenv hook zsh)".
+func renderZshHook(w io.Writer) {
+	fmt.Fprintln(w, `_lyenv_hook() {`)
+	fmt.Fprintln(w, `  eval "$(lyenv hook zsh --apply)"`)
+	fmt.Fprintln(w, `}`)
+	fmt.Fprintln(w, `autoload -Uz add-zsh-hook`)
+	fmt.Fprintln(w, `add-zsh-hook precmd _lyenv_hook`)
+	fmt.Fprintln(w, `add-zsh-hook chpwd _lyenv_hook`)
+}
+
+func bashSetVar(w io.Writer, name, value string) {
+	fmt.Fprintf(w, "export %s=%s\n", name, shQuote(value))
+}
+
+func bashUnsetVar(w io.Writer, name string) {
+	fmt.Fprintf(w, "unset %s\n", name)
+}
+
+// shQuote single-quotes s for POSIX shells.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
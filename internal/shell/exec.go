@@ -0,0 +1,176 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// Environ applies the activation to base (a KEY=VALUE list such as
+// os.Environ()): PATH gets the activation directories prepended and every
+// exported variable is set.
+func (a *Activation) Environ(base []string) []string {
+	out := make([]string, 0, len(base)+len(a.Vars)+2)
+	index := map[string]int{}
+	key := func(name string) string {
+		if runtime.GOOS == "windows" {
+			return strings.ToUpper(name) // environment names are case-insensitive
+		}
+		return name
+	}
+	for _, kv := range base {
+		name := kv
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			name = kv[:i]
+		}
+		index[key(name)] = len(out)
+		out = append(out, kv)
+	}
+	set := func(name, value string) {
+		if i, ok := index[key(name)]; ok {
+			name = strings.SplitN(out[i], "=", 2)[0] // keep the existing spelling ("Path" on Windows)
+			out[i] = name + "=" + value
+			return
+		}
+		index[key(name)] = len(out)
+		out = append(out, name+"="+value)
+	}
+	path := strings.Join(a.Path, string(os.PathListSeparator))
+	if i, ok := index[key("PATH")]; ok {
+		if old := strings.SplitN(out[i], "=", 2); len(old) == 2 && old[1] != "" {
+			path += string(os.PathListSeparator) + old[1]
+		}
+	}
+	set("PATH", path)
+	for _, v := range a.exported() {
+		set(v.Name, v.Value)
+	}
+	return out
+}
+
+// CmdExec runs argv with the environment of envDir applied and returns its
+// exit code. Signals received meanwhile are forwarded to the child; a child
+// killed by a signal yields 128+signal like a POSIX shell.
+func CmdExec(envDir string, argv []string) (int, error) {
+	if len(argv) == 0 {
+		return 0, fmt.Errorf("missing command")
+	}
+	a, err := Collect(envDir)
+	if err != nil {
+		return 0, err
+	}
+	environ := a.Environ(os.Environ())
+	prog, err := lookPath(argv[0], environ)
+	if err != nil {
+		return 127, err
+	}
+	cmd := exec.Command(prog, argv[1:]...)
+	cmd.Env = environ
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return runForwarding(cmd)
+}
+
+// CmdShell starts an interactive subshell with the environment of envDir
+// applied; exiting it returns to the untouched parent shell. shellName picks
+// the program (bash, zsh, fish, powershell, nu); empty means $SHELL.
+func CmdShell(envDir, shellName string) (int, error) {
+	prog := shellProgram(shellName)
+	a, err := Collect(envDir)
+	if err != nil {
+		return 0, err
+	}
+	if os.Getenv("LYENV_ACTIVE") != "" && os.Getenv("LYENV_HOME") == a.Home {
+		fmt.Fprintf(os.Stderr, "lyenv: note: %s is already active in this shell\n", a.Home)
+	}
+	environ := a.Environ(os.Environ())
+	path, err := lookPath(prog, environ)
+	if err != nil {
+		return 127, err
+	}
+	fmt.Fprintf(os.Stderr, "lyenv: entering %s (exit to leave)\n", a.Home)
+	cmd := exec.Command(path)
+	cmd.Env = environ
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return runForwarding(cmd)
+}
+
+func shellProgram(name string) string {
+	switch n := normalizeShell(name); n {
+	case "":
+	case "powershell":
+		if runtime.GOOS == "windows" {
+			return "powershell.exe"
+		}
+		return "pwsh"
+	default:
+		return n
+	}
+	if s := strings.TrimSpace(os.Getenv("SHELL")); s != "" {
+		return s
+	}
+	if runtime.GOOS == "windows" {
+		return "powershell.exe"
+	}
+	return "/bin/sh"
+}
+
+// lookPath resolves prog against the PATH of environ rather than of the
+// current process, so tools from the environment's bin/ are found.
+func lookPath(prog string, environ []string) (string, error) {
+	old, had := os.LookupEnv("PATH")
+	for _, kv := range environ {
+		if i := strings.IndexByte(kv, '='); i > 0 && strings.EqualFold(kv[:i], "PATH") {
+			os.Setenv("PATH", kv[i+1:])
+		}
+	}
+	defer func() {
+		if had {
+			os.Setenv("PATH", old)
+		} else {
+			os.Unsetenv("PATH")
+		}
+	}()
+	p, err := exec.LookPath(prog)
+	if err != nil {
+		return "", fmt.Errorf("command not found: %s", prog)
+	}
+	return p, nil
+}
+
+func runForwarding(cmd *exec.Cmd) (int, error) {
+	sigs := make(chan os.Signal, 4)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(sigs)
+	if err := cmd.Start(); err != nil {
+		return 126, fmt.Errorf("failed to start %s: %w", cmd.Path, err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case s := <-sigs:
+				_ = cmd.Process.Signal(s)
+			case <-done:
+				return
+			}
+		}
+	}()
+	err := cmd.Wait()
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal()), nil
+		}
+		return ee.ExitCode(), nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
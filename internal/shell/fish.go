@@ -0,0 +1,84 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	RegisterDialect(&Dialect{Name: "fish", Usage: "lyenv activate --shell=fish | source", Activate: renderFish, Deactivate: renderFishDeactivate,
+		Hook: renderFishHook, SetVar: fishSetVar, UnsetVar: fishUnsetVar})
+}
+
+// renderFish writes a fish activation snippet. The prompt is decorated by
+// wrapping fish_prompt; lyenv_deactivate restores the saved function.
+func renderFish(w io.Writer, a *Activation) {
+	vars := a.exported()
+	fmt.Fprintln(w, `if functions -q lyenv_deactivate; lyenv_deactivate; end`)
+	fmt.Fprintln(w, `set -g _LYENV_OLD_PATH $PATH`)
+	for _, v := range vars {
+		fmt.Fprintf(w, "if set -q %[1]s; set -g _LYENV_OLD_%[1]s $%[1]s; end\n", v.Name)
+	}
+	quoted := make([]string, len(a.Path))
+	for i, p := range a.Path {
+		quoted[i] = fishQuote(p)
+	}
+	fmt.Fprintf(w, "set -gx PATH %s $PATH\n", strings.Join(quoted, " "))
+	for _, v := range vars {
+		fmt.Fprintf(w, "set -gx %s %s\n", v.Name, fishQuote(v.Value))
+	}
+	fmt.Fprintln(w, `if not set -q LYENV_PROMPT_APPLIED`)
+	fmt.Fprintln(w, `    set -gx LYENV_PROMPT_APPLIED 1`)
+	fmt.Fprintln(w, `    if functions -q fish_prompt`)
+	fmt.Fprintln(w, `        functions -c fish_prompt _lyenv_old_fish_prompt`)
+	fmt.Fprintln(w, `        function fish_prompt`)
+	fmt.Fprintln(w, `            printf '(lyenv) '`)
+	fmt.Fprintln(w, `            _lyenv_old_fish_prompt`)
+	fmt.Fprintln(w, `        end`)
+	fmt.Fprintln(w, `    end`)
+	fmt.Fprintln(w, `end`)
+
+	fmt.Fprintln(w, `function lyenv_deactivate`)
+	fmt.Fprintln(w, `    if set -q _LYENV_OLD_PATH; set -gx PATH $_LYENV_OLD_PATH; set -e _LYENV_OLD_PATH; end`)
+	fmt.Fprintln(w, `    if functions -q _lyenv_old_fish_prompt`)
+	fmt.Fprintln(w, `        functions -e fish_prompt`)
+	fmt.Fprintln(w, `        functions -c _lyenv_old_fish_prompt fish_prompt`)
+	fmt.Fprintln(w, `        functions -e _lyenv_old_fish_prompt`)
+	fmt.Fprintln(w, `    end`)
+	for _, v := range vars {
+		fmt.Fprintf(w, "    if set -q _LYENV_OLD_%[1]s; set -gx %[1]s $_LYENV_OLD_%[1]s; set -e _LYENV_OLD_%[1]s; else; set -e %[1]s; end\n", v.Name)
+	}
+	fmt.Fprintln(w, `    set -e LYENV_PROMPT_APPLIED`)
+	fmt.Fprintln(w, `    functions -e lyenv_deactivate`)
+	fmt.Fprintln(w, `end`)
+}
+
+func renderFishDeactivate(w io.Writer) {
+	fmt.Fprintln(w, `if functions -q lyenv_deactivate`)
+	fmt.Fprintln(w, `    lyenv_deactivate`)
+	fmt.Fprintln(w, `else`)
+	fmt.Fprintln(w, `    echo "lyenv: no active environment in this shell" >&2`)
+	fmt.Fprintln(w, `end`)
+}
+
+// renderFishHook writes the config.fish snippet: lyenv hook fish | source.
+func renderFishHook(w io.Writer) {
+	fmt.Fprintln(w, `function _lyenv_hook --on-event fish_prompt`)
+	fmt.Fprintln(w, `    lyenv hook fish --apply | source`)
+	fmt.Fprintln(w, `end`)
+}
+
+func fishSetVar(w io.Writer, name, value string) {
+	fmt.Fprintf(w, "set -gx %s %s\n", name, fishQuote(value))
+}
+
+func fishUnsetVar(w io.Writer, name string) {
+	fmt.Fprintf(w, "set -e %s\n", name)
+}
+
+// fishQuote single-quotes s for fish (only \ and ' are special inside).
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
@@ -0,0 +1,123 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"lyenv/internal/env"
+)
+
+// Variables the prompt hook keeps in the shell between runs.
+const (
+	hookAutoVar   = "_LYENV_AUTO"   // environment the hook activated
+	hookDeniedVar = "_LYENV_DENIED" // untrusted environment already reported
+)
+
+// hookState is what the prompt hook sees on each run.
+type hookState struct {
+	Target  string // environment containing the working directory ("" if none)
+	Allowed bool   // Target was trusted with `lyenv allow`
+	Auto    string // $_LYENV_AUTO
+	Active  string // $LYENV_HOME while LYENV_ACTIVE is set
+	Denied  string // $_LYENV_DENIED
+}
+
+// hookPlan is what the hook should do for a given state.
+type hookPlan struct {
+	Deactivate bool   // leave the environment the hook activated
+	ClearAuto  bool   // forget _LYENV_AUTO
+	Activate   string // environment to activate
+	Notice     string // untrusted environment to report once
+}
+
+// planHook decides the transition. Environments activated by hand are never
+// touched, and nothing happens while the working directory stays inside the
+// environment the hook last handled.
+func planHook(s hookState) hookPlan {
+	if s.Active != "" && s.Active != s.Auto {
+		return hookPlan{}
+	}
+	if s.Target == s.Auto {
+		return hookPlan{}
+	}
+	p := hookPlan{Deactivate: s.Auto != "" && s.Active == s.Auto, ClearAuto: s.Auto != ""}
+	if s.Target != "" {
+		if s.Allowed {
+			p.Activate = s.Target
+		} else if s.Denied != s.Target {
+			p.Notice = s.Target
+		}
+	}
+	return p
+}
+
+// CmdHook prints the snippet that installs the prompt hook into shellName
+// (auto-detected when empty), e.g. eval "$(lyenv hook bash)" in ~/.bashrc.
+func CmdHook(shellName string) error {
+	d, err := hookDialect(shellName)
+	if err != nil {
+		return err
+	}
+	d.Hook(os.Stdout)
+	return nil
+}
+
+// CmdHookApply is run by the installed hook before every prompt. It prints
+// the code that moves the shell into (or out of) the environment containing
+// the working directory; status messages go to stderr.
+func CmdHookApply(shellName string) error {
+	d, err := hookDialect(shellName)
+	if err != nil {
+		return err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current working directory: %w", err)
+	}
+	s := hookState{Auto: os.Getenv(hookAutoVar), Denied: os.Getenv(hookDeniedVar)}
+	if os.Getenv("LYENV_ACTIVE") != "" {
+		s.Active = os.Getenv("LYENV_HOME")
+	}
+	if dir, ok := env.Discover(cwd); ok {
+		s.Target = dir
+		s.Allowed = env.IsAllowed(dir)
+	}
+	applyHook(os.Stdout, d, planHook(s))
+	return nil
+}
+
+func applyHook(w io.Writer, d *Dialect, p hookPlan) {
+	if p.Deactivate {
+		d.Deactivate(w)
+		fmt.Fprintln(os.Stderr, "lyenv: deactivated")
+	}
+	if p.ClearAuto {
+		d.UnsetVar(w, hookAutoVar)
+	}
+	if p.Activate != "" {
+		a, err := Collect(p.Activate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "lyenv: failed to activate %s: %v\n", p.Activate, err)
+		} else {
+			d.Activate(w, a)
+			d.SetVar(w, hookAutoVar, p.Activate)
+			fmt.Fprintf(os.Stderr, "lyenv: activated %s\n", p.Activate)
+		}
+	}
+	if p.Notice != "" {
+		fmt.Fprintf(os.Stderr, "lyenv: %s is not allowed to auto-activate; run `lyenv allow` to trust it\n", p.Notice)
+		d.SetVar(w, hookDeniedVar, p.Notice)
+	}
+}
+
+func hookDialect(shellName string) (*Dialect, error) {
+	d, err := LookupDialect(shellName)
+	if err != nil {
+		return nil, err
+	}
+	if d.Hook == nil {
+		return nil, fmt.Errorf("shell hook is not supported for %s; activate manually with: %s", d.Name, d.Usage)
+	}
+	return d, nil
+}
@@ -0,0 +1,59 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// NuOverlay is the overlay name nushell derives from the module file name.
+const NuOverlay = "lyenv_activate"
+
+const nuUsage = "lyenv activate --shell=nu | save -f " + NuOverlay + ".nu; overlay use " + NuOverlay + ".nu"
+
+func init() {
+	RegisterDialect(&Dialect{
+		Name:       "nu",
+		Usage:      nuUsage,
+		Activate:   renderNu,
+		Deactivate: renderNuDeactivate,
+	})
+}
+
+// renderNu writes a nushell module meant to be loaded with `overlay use`.
+// Nushell cannot eval generated text, and hiding the overlay restores PATH,
+// the prompt and every variable exactly, so no state needs to be saved.
+func renderNu(w io.Writer, a *Activation) {
+	fmt.Fprintf(w, "# Load with: %s\n", nuUsage)
+	fmt.Fprintln(w, `export-env {`)
+	quoted := make([]string, len(a.Path))
+	for i, p := range a.Path {
+		quoted[i] = nuQuote(p)
+	}
+	fmt.Fprintln(w, `    let path_name = if 'Path' in ($env | columns) { 'Path' } else { 'PATH' }`)
+	fmt.Fprintln(w, `    let old_path = ($env | get $path_name)`)
+	fmt.Fprintln(w, `    let old_path = if ($old_path | describe) == 'string' { $old_path | split row (char esep) } else { $old_path }`)
+	fmt.Fprintf(w, "    load-env { $path_name: ($old_path | prepend [%s]) }\n", strings.Join(quoted, ", "))
+	for _, v := range a.exported() {
+		fmt.Fprintf(w, "    $env.%s = %s\n", v.Name, nuQuote(v.Value))
+	}
+	fmt.Fprintln(w, `    let old_prompt = ($env.PROMPT_COMMAND? | default '')`)
+	fmt.Fprintln(w, `    $env.PROMPT_COMMAND = if ($old_prompt | describe) =~ '^closure' {`)
+	fmt.Fprintln(w, `        {|| '(lyenv) ' + (do $old_prompt) }`)
+	fmt.Fprintln(w, `    } else {`)
+	fmt.Fprintln(w, `        {|| '(lyenv) ' + $old_prompt }`)
+	fmt.Fprintln(w, `    }`)
+	fmt.Fprintln(w, `}`)
+	fmt.Fprintf(w, "export alias lyenv_deactivate = overlay hide %s\n", NuOverlay)
+}
+
+func renderNuDeactivate(w io.Writer) {
+	fmt.Fprintln(w, "# Nushell cannot eval generated code; run:")
+	fmt.Fprintf(w, "overlay hide %s\n", NuOverlay)
+}
+
+// nuQuote double-quotes s for nushell.
+func nuQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,84 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	RegisterDialect(&Dialect{Name: "powershell", Usage: "lyenv activate --shell=powershell | Out-String | Invoke-Expression", Activate: renderPowerShell, Deactivate: renderPowerShellDeactivate,
+		Hook: renderPowerShellHook, SetVar: psSetVar, UnsetVar: psUnsetVar})
+}
+
+// renderPowerShell writes a PowerShell (5.1 and 7+) activation snippet. The
+// prompt function is wrapped and restored by lyenv_deactivate.
+func renderPowerShell(w io.Writer, a *Activation) {
+	vars := a.exported()
+	fmt.Fprintln(w, `if (Get-Command lyenv_deactivate -ErrorAction SilentlyContinue) { lyenv_deactivate }`)
+	fmt.Fprintln(w, `$global:_LYENV_OLD_PATH = $env:PATH`)
+	for _, v := range vars {
+		fmt.Fprintf(w, "if (Test-Path Env:%[1]s) { $global:_LYENV_OLD_%[1]s = $env:%[1]s }\n", v.Name)
+	}
+	parts := make([]string, 0, len(a.Path)+1)
+	for _, p := range a.Path {
+		parts = append(parts, psQuote(p))
+	}
+	parts = append(parts, "$env:PATH")
+	fmt.Fprintf(w, "$env:PATH = @(%s) -join [IO.Path]::PathSeparator\n", strings.Join(parts, ", "))
+	for _, v := range vars {
+		fmt.Fprintf(w, "$env:%s = %s\n", v.Name, psQuote(v.Value))
+	}
+	fmt.Fprintln(w, `if (-not (Test-Path Env:LYENV_PROMPT_APPLIED)) {`)
+	fmt.Fprintln(w, `    $env:LYENV_PROMPT_APPLIED = '1'`)
+	fmt.Fprintln(w, `    $global:_LYENV_OLD_PROMPT = $function:prompt`)
+	fmt.Fprintln(w, `    function global:prompt { '(lyenv) ' + (& $global:_LYENV_OLD_PROMPT) }`)
+	fmt.Fprintln(w, `}`)
+
+	fmt.Fprintln(w, `function global:lyenv_deactivate {`)
+	fmt.Fprintln(w, `    if (Test-Path Variable:global:_LYENV_OLD_PATH) { $env:PATH = $global:_LYENV_OLD_PATH; Remove-Variable -Name _LYENV_OLD_PATH -Scope Global }`)
+	fmt.Fprintln(w, `    if (Test-Path Variable:global:_LYENV_OLD_PROMPT) { $function:global:prompt = $global:_LYENV_OLD_PROMPT; Remove-Variable -Name _LYENV_OLD_PROMPT -Scope Global }`)
+	for _, v := range vars {
+		fmt.Fprintf(w, "    if (Test-Path Variable:global:_LYENV_OLD_%[1]s) { $env:%[1]s = $global:_LYENV_OLD_%[1]s; Remove-Variable -Name _LYENV_OLD_%[1]s -Scope Global } else { Remove-Item Env:%[1]s -ErrorAction SilentlyContinue }\n", v.Name)
+	}
+	fmt.Fprintln(w, `    Remove-Item Env:LYENV_PROMPT_APPLIED -ErrorAction SilentlyContinue`)
+	fmt.Fprintln(w, `    Remove-Item Function:lyenv_deactivate`)
+	fmt.Fprintln(w, `}`)
+}
+
+func renderPowerShellDeactivate(w io.Writer) {
+	fmt.Fprintln(w, `if (Get-Command lyenv_deactivate -ErrorAction SilentlyContinue) {`)
+	fmt.Fprintln(w, `    lyenv_deactivate`)
+	fmt.Fprintln(w, `} else {`)
+	fmt.Fprintln(w, `    Write-Error 'lyenv: no active environment in this shell'`)
+	fmt.Fprintln(w, `}`)
+}
+
+// renderPowerShellHook writes the $PROFILE snippet:
+// lyenv hook powershell | Out-String | Invoke-Expression.
+// The prompt is wrapped so the hook runs before it; $LASTEXITCODE is kept.
+func renderPowerShellHook(w io.Writer) {
+	fmt.Fprintln(w, `if (-not (Test-Path Function:global:_lyenv_hook)) {`)
+	fmt.Fprintln(w, `    function global:_lyenv_hook {`)
+	fmt.Fprintln(w, `        $code = $global:LASTEXITCODE`)
+	fmt.Fprintln(w, `        $s = lyenv hook powershell --apply | Out-String`)
+	fmt.Fprintln(w, `        if ($s.Trim()) { Invoke-Expression $s }`)
+	fmt.Fprintln(w, `        $global:LASTEXITCODE = $code`)
+	fmt.Fprintln(w, `    }`)
+	fmt.Fprintln(w, `    $global:_LYENV_HOOK_PROMPT = $function:prompt`)
+	fmt.Fprintln(w, `    function global:prompt { _lyenv_hook; & $global:_LYENV_HOOK_PROMPT }`)
+	fmt.Fprintln(w, `}`)
+}
+
+func psSetVar(w io.Writer, name, value string) {
+	fmt.Fprintf(w, "$env:%s = %s\n", name, psQuote(value))
+}
+
+func psUnsetVar(w io.Writer, name string) {
+	fmt.Fprintf(w, "Remove-Item Env:%s -ErrorAction SilentlyContinue\n", name)
+}
+
+// psQuote single-quotes s for PowerShell, doubling embedded quotes.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
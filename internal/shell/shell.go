@@ -0,0 +1,116 @@
+package shell
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dialect renders activation and deactivation snippets for one shell.
+type Dialect struct {
+	Name       string
+	Usage      string // how to load the activation output in this shell
+	Activate   func(w io.Writer, a *Activation)
+	Deactivate func(w io.Writer)
+	Hook       func(w io.Writer) // installs the auto-activation prompt hook; nil if unsupported
+	SetVar     func(w io.Writer, name, value string)
+	UnsetVar   func(w io.Writer, name string)
+}
+
+var dialects = map[string]*Dialect{}
+
+// RegisterDialect adds a shell dialect (later registrations replace earlier ones).
+func RegisterDialect(d *Dialect) {
+	dialects[d.Name] = d
+}
+
+// DialectNames lists supported shells in sorted order.
+func DialectNames() []string {
+	out := make([]string, 0, len(dialects))
+	for n := range dialects {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// LookupDialect resolves a --shell value; empty means auto-detect.
+func LookupDialect(name string) (*Dialect, error) {
+	n := normalizeShell(name)
+	if strings.TrimSpace(name) == "" {
+		n = Detect()
+	}
+	d, ok := dialects[n]
+	if !ok {
+		return nil, fmt.Errorf("unsupported shell: %s (supported: %s)", name, strings.Join(DialectNames(), "|"))
+	}
+	return d, nil
+}
+
+// Detect guesses the calling shell from the parent process (Linux) and then
+// $SHELL; it falls back to powershell on Windows and bash elsewhere.
+func Detect() string {
+	if b, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(os.Getppid()), "comm")); err == nil {
+		if n := normalizeShell(strings.TrimSpace(string(b))); dialects[n] != nil {
+			return n
+		}
+	}
+	if n := normalizeShell(filepath.Base(os.Getenv("SHELL"))); dialects[n] != nil {
+		return n
+	}
+	if runtime.GOOS == "windows" {
+		return "powershell"
+	}
+	return "bash"
+}
+
+func normalizeShell(name string) string {
+	n := strings.ToLower(strings.TrimSpace(name))
+	n = strings.TrimSuffix(n, ".exe")
+	n = strings.TrimPrefix(n, "-") // login shells, e.g. "-bash"
+	switch n {
+	case "sh", "dash", "ash", "ksh":
+		return "bash"
+	case "pwsh":
+		return "powershell"
+	case "nushell":
+		return "nu"
+	}
+	return n
+}
+
+// CmdActivate prints the activation snippet for envDir in the given shell
+// (auto-detected when empty). bash/zsh: eval "$(lyenv activate)"
+func CmdActivate(envDir, shellName string) error {
+	d, err := LookupDialect(shellName)
+	if err != nil {
+		return err
+	}
+	a, err := Collect(envDir)
+	if err != nil {
+		return err
+	}
+	d.Activate(os.Stdout, a)
+	return nil
+}
+
+// CmdDeactivate prints the deactivation snippet for the given shell.
+func CmdDeactivate(shellName string) error {
+	d, err := LookupDialect(shellName)
+	if err != nil {
+		return err
+	}
+	d.Deactivate(os.Stdout)
+	return nil
+}
+
+// exported lists every variable the activation sets (besides PATH), in order.
+func (a *Activation) exported() []Var {
+	out := []Var{{Name: "LYENV_HOME", Value: a.Home}, {Name: "LYENV_ACTIVE", Value: "1"}}
+	return append(out, a.Vars...)
+}
@@ -0,0 +1,189 @@
+package snapshot
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Restore replaces the captured parts of the environment with snapshot name.
+// The snapshot is first rebuilt in a staging directory, then each root is
+// swapped in by rename; if any swap fails the earlier ones are rolled back.
+// The current state is saved as an automatic snapshot beforehand, which is
+// returned so the restore itself can be undone.
+func Restore(home, name string) (*Snapshot, error) {
+	home, err := filepath.Abs(home)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Load(home, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range s.Entries {
+		if e.Type == "file" {
+			if _, err := os.Stat(objectPath(home, e.Hash)); err != nil {
+				return nil, fmt.Errorf("snapshot %s is damaged: missing object for %s", name, e.Path)
+			}
+		}
+	}
+
+	// Pruning waits until the restore is done so it cannot drop the target.
+	pre, err := create(home, "", "before restore of "+name, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot current state: %w", err)
+	}
+
+	tag := fmt.Sprintf("%d", os.Getpid())
+	stage := filepath.Join(baseDir(home), ".restore-"+tag)
+	old := filepath.Join(baseDir(home), ".replaced-"+tag)
+	_ = os.RemoveAll(stage)
+	_ = os.RemoveAll(old)
+	defer os.RemoveAll(stage)
+	if err := build(home, stage, s); err != nil {
+		return pre, fmt.Errorf("failed to stage snapshot: %w", err)
+	}
+
+	roots, err := liveRoots(home)
+	if err != nil {
+		return pre, err
+	}
+	roots = union(roots, s.Roots)
+	if err := swap(home, stage, old, roots); err != nil {
+		return pre, err
+	}
+	keepLogs(home, old)
+	if err := os.RemoveAll(old); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to clean up %s: %v\n", old, err)
+	}
+	return pre, pruneAuto(home)
+}
+
+// build materializes a snapshot under dir.
+func build(home, dir string, s *Snapshot) error {
+	var dirs []Entry
+	for _, e := range s.Entries {
+		dst := filepath.Join(dir, filepath.FromSlash(e.Path))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		switch e.Type {
+		case "dir":
+			if err := os.MkdirAll(dst, 0o755); err != nil {
+				return err
+			}
+			dirs = append(dirs, e)
+		case "symlink":
+			if err := os.Symlink(e.Link, dst); err != nil {
+				return err
+			}
+		case "file":
+			if err := copyObject(objectPath(home, e.Hash), dst, e.Mode); err != nil {
+				return err
+			}
+		}
+	}
+	// Directory modes last, deepest first, so read-only dirs can be filled.
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i].Path) > len(dirs[j].Path) })
+	for _, e := range dirs {
+		if err := os.Chmod(filepath.Join(dir, filepath.FromSlash(e.Path)), e.Mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyObject(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dst, mode)
+}
+
+// swap moves each live root to old and the staged root into place,
+// undoing every rename done so far when one fails.
+func swap(home, stage, old string, roots []string) error {
+	type move struct{ from, to string }
+	var done []move
+	rename := func(from, to string) error {
+		if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		done = append(done, move{from, to})
+		return nil
+	}
+	for _, r := range roots {
+		live := filepath.Join(home, filepath.FromSlash(r))
+		staged := filepath.Join(stage, filepath.FromSlash(r))
+		var err error
+		if _, statErr := os.Lstat(live); statErr == nil {
+			err = rename(live, filepath.Join(old, filepath.FromSlash(r)))
+		}
+		if _, statErr := os.Lstat(staged); err == nil && statErr == nil {
+			err = rename(staged, live)
+		}
+		if err != nil {
+			for i := len(done) - 1; i >= 0; i-- {
+				if rerr := os.Rename(done[i].to, done[i].from); rerr != nil {
+					return fmt.Errorf("failed to restore %s: %v; rollback failed too, previous files are in %s", r, err, old)
+				}
+			}
+			return fmt.Errorf("failed to restore %s: %w", r, err)
+		}
+	}
+	return nil
+}
+
+// keepLogs carries plugin logs over from the replaced tree, since snapshots
+// do not capture them.
+func keepLogs(home, old string) {
+	ents, err := os.ReadDir(filepath.Join(old, "plugins"))
+	if err != nil {
+		return
+	}
+	for _, e := range ents {
+		src := filepath.Join(old, "plugins", e.Name(), "logs")
+		dst := filepath.Join(home, "plugins", e.Name(), "logs")
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Dir(dst)); err != nil {
+			continue // plugin not present in the snapshot
+		}
+		if _, err := os.Lstat(dst); err == nil {
+			continue
+		}
+		_ = os.Rename(src, dst)
+	}
+}
+
+func union(a, b []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, x := range append(append([]string{}, a...), b...) {
+		if !seen[x] {
+			seen[x] = true
+			out = append(out, x)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,381 @@
+// Package snapshot captures and restores the mutable parts of an
+// environment: lyenv*.yaml, .lyenv/registry, .lyenv/state.json, bin/ (shims)
+// and plugins/ (without logs).
+//
+// File contents live once in a content store under .lyenv/snapshots/objects,
+// addressed by SHA-256, so unchanged files cost nothing in later snapshots.
+// Objects are copies, never hardlinks to live files, because plugins and
+// config writes may modify files in place.
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"lyenv/internal/store"
+)
+
+// Entry is one captured filesystem object; Path is slash-separated and
+// relative to the environment.
+type Entry struct {
+	Path string      `json:"path"`
+	Type string      `json:"type"` // dir|file|symlink
+	Mode fs.FileMode `json:"mode"`
+	Hash string      `json:"sha256,omitempty"`
+	Link string      `json:"link,omitempty"`
+}
+
+// Snapshot is the index of one snapshot (.lyenv/snapshots/<name>/index.json).
+type Snapshot struct {
+	Name      string   `json:"name"`
+	CreatedAt string   `json:"created_at"`
+	Reason    string   `json:"reason,omitempty"`
+	Auto      bool     `json:"auto,omitempty"`
+	Roots     []string `json:"roots"`
+	Entries   []Entry  `json:"entries"`
+}
+
+// Files returns the number of regular files captured.
+func (s *Snapshot) Files() int {
+	n := 0
+	for _, e := range s.Entries {
+		if e.Type == "file" {
+			n++
+		}
+	}
+	return n
+}
+
+// keepAuto is how many automatic snapshots are kept; older ones are pruned.
+const keepAuto = 10
+
+const indexFile = "index.json"
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// fixedRoots are managed in every environment; lyenv*.yaml files (main
+// config and profiles) are added as found.
+var fixedRoots = []string{".lyenv/registry", ".lyenv/state.json", "bin", "plugins"}
+
+func baseDir(home string) string    { return filepath.Join(home, ".lyenv", "snapshots") }
+func objectsDir(home string) string { return filepath.Join(baseDir(home), "objects") }
+
+func objectPath(home, hash string) string {
+	return filepath.Join(objectsDir(home), hash[:2], hash[2:])
+}
+
+// Create takes a snapshot named name (a timestamp when empty).
+func Create(home, name, reason string) (*Snapshot, error) {
+	return create(home, name, reason, false)
+}
+
+// Auto takes an automatic snapshot before a risky operation and prunes
+// automatic snapshots beyond the most recent keepAuto.
+func Auto(home, reason string) (*Snapshot, error) {
+	s, err := create(home, "", reason, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := pruneAuto(home); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+func create(home, name, reason string, auto bool) (*Snapshot, error) {
+	home, err := filepath.Abs(home)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = uniqueName(home, autoPrefix(auto)+time.Now().UTC().Format("20060102T150405Z"))
+	} else if !validName.MatchString(name) || name == "objects" {
+		return nil, fmt.Errorf("invalid snapshot name: %q (letters, digits, '.', '_', '-')", name)
+	}
+	dir := filepath.Join(baseDir(home), name)
+	if _, err := os.Stat(dir); err == nil {
+		return nil, fmt.Errorf("snapshot already exists: %s", name)
+	}
+
+	s := &Snapshot{
+		Name:      name,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Reason:    reason,
+		Auto:      auto,
+	}
+	roots, err := liveRoots(home)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roots {
+		if _, err := os.Lstat(filepath.Join(home, filepath.FromSlash(r))); err != nil {
+			continue
+		}
+		s.Roots = append(s.Roots, r)
+		if err := capture(home, r, s); err != nil {
+			return nil, fmt.Errorf("failed to snapshot %s: %w", r, err)
+		}
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(baseDir(home), ".tmp-"+name)
+	_ = os.RemoveAll(tmp)
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, indexFile), append(data, '\n'), 0o644); err != nil {
+		_ = os.RemoveAll(tmp)
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		_ = os.RemoveAll(tmp)
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return s, nil
+}
+
+func autoPrefix(auto bool) string {
+	if auto {
+		return "auto-"
+	}
+	return ""
+}
+
+func uniqueName(home, name string) string {
+	cand := name
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(baseDir(home), cand)); os.IsNotExist(err) {
+			return cand
+		}
+		cand = fmt.Sprintf("%s-%d", name, i)
+	}
+}
+
+// liveRoots lists the roots managed in the environment right now.
+func liveRoots(home string) ([]string, error) {
+	roots := append([]string{}, fixedRoots...)
+	matches, err := filepath.Glob(filepath.Join(home, "lyenv*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		roots = append(roots, filepath.Base(m))
+	}
+	sort.Strings(roots)
+	return roots, nil
+}
+
+// skip reports whether a path is left out of snapshots: plugin logs grow
+// with every run and belong to no particular state.
+func skip(rel string) bool {
+	parts := strings.Split(rel, "/")
+	return len(parts) == 3 && parts[0] == "plugins" && parts[2] == "logs"
+}
+
+func capture(home, root string, s *Snapshot) error {
+	return filepath.Walk(filepath.Join(home, filepath.FromSlash(root)), func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(home, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if skip(rel) {
+			return filepath.SkipDir
+		}
+		e := Entry{Path: rel, Mode: fi.Mode().Perm()}
+		switch {
+		case fi.IsDir():
+			e.Type = "dir"
+		case fi.Mode()&os.ModeSymlink != 0:
+			e.Type = "symlink"
+			if e.Link, err = os.Readlink(p); err != nil {
+				return err
+			}
+			// Plugin files symlinked into the plugin store would dangle once
+			// `store gc` drops the tree, so their contents are captured.
+			if ti, err := os.Stat(p); err == nil && ti.Mode().IsRegular() && filepath.IsAbs(e.Link) && store.InTree(e.Link) {
+				e.Type, e.Link, e.Mode = "file", "", ti.Mode().Perm()|0o200
+				if e.Hash, err = putObject(home, p); err != nil {
+					return err
+				}
+			}
+		case fi.Mode().IsRegular():
+			e.Type = "file"
+			if e.Hash, err = putObject(home, p); err != nil {
+				return err
+			}
+		default:
+			return nil // sockets, devices: nothing to restore
+		}
+		s.Entries = append(s.Entries, e)
+		return nil
+	})
+}
+
+// putObject copies a file into the snapshot objects unless an identical object
+// already exists, and returns its hash.
+func putObject(home, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	obj := objectPath(home, sum)
+	if _, err := os.Stat(obj); err == nil {
+		return sum, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(obj), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(obj), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, f); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return sum, os.Rename(tmp.Name(), obj)
+}
+
+// Load reads a snapshot index.
+func Load(home, name string) (*Snapshot, error) {
+	if !validName.MatchString(name) || name == "objects" {
+		return nil, fmt.Errorf("invalid snapshot name: %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(baseDir(home), name, indexFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("snapshot not found: %s", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid snapshot index %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// List returns all snapshots, oldest first.
+func List(home string) ([]*Snapshot, error) {
+	ents, err := os.ReadDir(baseDir(home))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots: %w", err)
+	}
+	var out []*Snapshot
+	for _, e := range ents {
+		if !e.IsDir() || e.Name() == "objects" || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		s, err := Load(home, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].CreatedAt != out[j].CreatedAt {
+			return out[i].CreatedAt < out[j].CreatedAt
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+// Remove deletes a snapshot and the objects no other snapshot references.
+func Remove(home, name string) error {
+	if _, err := Load(home, name); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(baseDir(home), name)); err != nil {
+		return fmt.Errorf("failed to remove snapshot: %w", err)
+	}
+	return gc(home)
+}
+
+func pruneAuto(home string) error {
+	all, err := List(home)
+	if err != nil {
+		return err
+	}
+	var auto []*Snapshot
+	for _, s := range all {
+		if s.Auto {
+			auto = append(auto, s)
+		}
+	}
+	if len(auto) <= keepAuto {
+		return nil
+	}
+	for _, s := range auto[:len(auto)-keepAuto] {
+		if err := os.RemoveAll(filepath.Join(baseDir(home), s.Name)); err != nil {
+			return fmt.Errorf("failed to prune snapshot %s: %w", s.Name, err)
+		}
+	}
+	return gc(home)
+}
+
+// gc removes objects that no snapshot references.
+func gc(home string) error {
+	all, err := List(home)
+	if err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for _, s := range all {
+		for _, e := range s.Entries {
+			if e.Hash != "" {
+				used[e.Hash] = true
+			}
+		}
+	}
+	root := objectsDir(home)
+	return filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		if !used[strings.ReplaceAll(filepath.ToSlash(rel), "/", "")] {
+			return os.Remove(p)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,278 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lyenv/internal/store"
+)
+
+// writeFiles creates files (slash-separated paths relative to root).
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, body := range files {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, p string) string {
+	t.Helper()
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSnapshotCapturesStoreSymlinks(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("LYENV_STORE_DIR", t.TempDir())
+	tree := store.TreePath("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	writeFiles(t, tree, map[string]string{"tool.sh": "echo stored\n"})
+	writeFiles(t, home, map[string]string{"lyenv.yaml": "env: {}\n"})
+	link := filepath.Join(home, "plugins", "tool", "tool.sh")
+	if err := os.MkdirAll(filepath.Dir(link), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(tree, "tool.sh"), link); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(home, "plugins", "tool", "rel")
+	if err := os.Symlink("tool.sh", other); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Create(home, "linked", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := map[string]string{}
+	for _, e := range s.Entries {
+		types[e.Path] = e.Type
+	}
+	if types["plugins/tool/tool.sh"] != "file" || types["plugins/tool/rel"] != "symlink" {
+		t.Fatalf("entry types = %v, want store link captured as file and relative link kept", types)
+	}
+
+	// `store gc` drops the tree; the snapshot must not depend on it.
+	if err := os.RemoveAll(tree); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(home, "linked"); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.Mode().IsRegular() {
+		t.Errorf("restored %s is %v, want a regular file", link, fi.Mode())
+	}
+	if got := readFile(t, other); got != "echo stored\n" {
+		t.Errorf("restored content = %q", got)
+	}
+}
+
+func newEnv(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	writeFiles(t, home, map[string]string{
+		"lyenv.yaml":                       "env: {name: demo}\n",
+		".lyenv/state.json":                `{"notes": "v1"}`,
+		".lyenv/registry/installed.yaml":   "plugins: []\n",
+		"bin/tool":                         "#!/bin/sh\n",
+		"plugins/tool/manifest.yaml":       "name: tool\n",
+		"plugins/tool/logs/dispatch.jsonl": "{}\n",
+		".lyenv/secrets/untouched.enc":     "secret\n",
+		"workspace/keep.txt":               "not captured\n",
+	})
+	return home
+}
+
+func TestRestoreRoundTrip(t *testing.T) {
+	home := newEnv(t)
+	s, err := Create(home, "base", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range s.Entries {
+		if strings.Contains(e.Path, "logs") || strings.HasPrefix(e.Path, "workspace") || strings.Contains(e.Path, "secrets") {
+			t.Errorf("captured %s", e.Path)
+		}
+	}
+
+	writeFiles(t, home, map[string]string{
+		"lyenv.yaml":                       "env: {name: changed}\n",
+		"lyenv.dev.yaml":                   "env: {name: dev}\n",
+		"plugins/new/manifest.yaml":        "name: new\n",
+		"plugins/tool/logs/dispatch.jsonl": "{}\n{}\n",
+		"workspace/keep.txt":               "edited\n",
+	})
+	if err := os.Remove(filepath.Join(home, "bin", "tool")); err != nil {
+		t.Fatal(err)
+	}
+
+	pre, err := Restore(home, "base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(home, "lyenv.yaml")); got != "env: {name: demo}\n" {
+		t.Errorf("lyenv.yaml = %q", got)
+	}
+	if got := readFile(t, filepath.Join(home, "bin", "tool")); got != "#!/bin/sh\n" {
+		t.Errorf("bin/tool = %q", got)
+	}
+	for _, gone := range []string{"lyenv.dev.yaml", "plugins/new"} {
+		if _, err := os.Stat(filepath.Join(home, gone)); !os.IsNotExist(err) {
+			t.Errorf("%s survived the restore", gone)
+		}
+	}
+	// Logs and unmanaged files are left as they are.
+	if got := readFile(t, filepath.Join(home, "plugins", "tool", "logs", "dispatch.jsonl")); got != "{}\n{}\n" {
+		t.Errorf("plugin log = %q", got)
+	}
+	if got := readFile(t, filepath.Join(home, "workspace", "keep.txt")); got != "edited\n" {
+		t.Errorf("workspace = %q", got)
+	}
+	if got := readFile(t, filepath.Join(home, ".lyenv", "secrets", "untouched.enc")); got != "secret\n" {
+		t.Errorf("secrets = %q", got)
+	}
+
+	// The automatic snapshot taken first undoes the restore.
+	if pre == nil || !pre.Auto {
+		t.Fatalf("pre-restore snapshot = %+v", pre)
+	}
+	if _, err := Restore(home, pre.Name); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(home, "lyenv.dev.yaml")); got != "env: {name: dev}\n" {
+		t.Errorf("undo: lyenv.dev.yaml = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(home, "bin", "tool")); !os.IsNotExist(err) {
+		t.Error("undo: bin/tool is back")
+	}
+	ents, _ := os.ReadDir(baseDir(home))
+	for _, e := range ents {
+		if strings.HasPrefix(e.Name(), ".") {
+			t.Errorf("left behind %s", e.Name())
+		}
+	}
+}
+
+func TestRestoreDamagedSnapshot(t *testing.T) {
+	home := newEnv(t)
+	s, err := Create(home, "base", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var obj string
+	for _, e := range s.Entries {
+		if e.Path == "lyenv.yaml" {
+			obj = objectPath(home, e.Hash)
+		}
+	}
+	if err := os.Remove(obj); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, home, map[string]string{"lyenv.yaml": "env: {name: changed}\n"})
+	if _, err := Restore(home, "base"); err == nil || !strings.Contains(err.Error(), "missing object for lyenv.yaml") {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got := readFile(t, filepath.Join(home, "lyenv.yaml")); got != "env: {name: changed}\n" {
+		t.Errorf("damaged restore changed lyenv.yaml to %q", got)
+	}
+}
+
+func TestSwapRollsBack(t *testing.T) {
+	home, stage, old := t.TempDir(), t.TempDir(), filepath.Join(t.TempDir(), "old")
+	writeFiles(t, home, map[string]string{"a/file": "live a", "b/c/file": "live c"})
+	writeFiles(t, stage, map[string]string{"a/file": "staged a", "b/c/file": "staged c"})
+	// old/b is a file, so moving the second root aside fails.
+	writeFiles(t, old, map[string]string{"b": "blocker"})
+
+	err := swap(home, stage, old, []string{"a", "b/c"})
+	if err == nil || !strings.Contains(err.Error(), "failed to restore b/c") {
+		t.Fatalf("swap: %v", err)
+	}
+	if got := readFile(t, filepath.Join(home, "a", "file")); got != "live a" {
+		t.Errorf("a/file = %q after rollback", got)
+	}
+	if got := readFile(t, filepath.Join(home, "b", "c", "file")); got != "live c" {
+		t.Errorf("b/c/file = %q after rollback", got)
+	}
+	if got := readFile(t, filepath.Join(stage, "a", "file")); got != "staged a" {
+		t.Errorf("staged a/file = %q after rollback", got)
+	}
+}
+
+func TestRemoveDropsUnusedObjects(t *testing.T) {
+	home := newEnv(t)
+	first, err := Create(home, "one", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, home, map[string]string{"lyenv.yaml": "env: {name: two}\n"})
+	if _, err := Create(home, "two", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(home, "two", ""); err == nil {
+		t.Error("duplicate snapshot name accepted")
+	}
+	if err := Remove(home, "one"); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range first.Entries {
+		if e.Type != "file" {
+			continue
+		}
+		_, err := os.Stat(objectPath(home, e.Hash))
+		if shared := e.Path != "lyenv.yaml"; shared != (err == nil) {
+			t.Errorf("%s: object present = %v, want %v", e.Path, err == nil, shared)
+		}
+	}
+	if _, err := Load(home, "one"); err == nil {
+		t.Error("removed snapshot still loads")
+	}
+}
+
+func TestAutoPrunes(t *testing.T) {
+	home := newEnv(t)
+	if _, err := Create(home, "manual", ""); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < keepAuto+3; i++ {
+		if _, err := Auto(home, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all, err := List(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auto := 0
+	for _, s := range all {
+		if s.Auto {
+			auto++
+		}
+	}
+	if auto != keepAuto || len(all) != keepAuto+1 {
+		t.Errorf("%d snapshots, %d automatic; want %d automatic plus the manual one", len(all), auto, keepAuto)
+	}
+}
+
+func TestCreateRejectsBadNames(t *testing.T) {
+	home := newEnv(t)
+	for _, name := range []string{"objects", "../x", ".hidden", "a/b", "-x"} {
+		if _, err := Create(home, name, ""); err == nil {
+			t.Errorf("Create(%q) succeeded", name)
+		}
+	}
+}
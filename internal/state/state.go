@@ -0,0 +1,214 @@
+// Package state implements `lyenv state`: reading and editing the
+// environment state (.lyenv/state.json) and the state files of plugins.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"lyenv/internal/config"
+	"lyenv/internal/env"
+	"lyenv/internal/plugin"
+)
+
+// Entry is one leaf of a state document.
+type Entry struct {
+	Key   string
+	Value interface{}
+}
+
+// managed are env state keys written only by lyenv itself.
+var managed = map[string]bool{"created_at": true, "initialized_at": true, "components": true}
+
+// Get returns the value at key. Without a plugin it reads the environment
+// state, where keys other than created_at, initialized_at, notes and
+// components address the free-form values map.
+func Get(envDir, pluginName, key string) (interface{}, error) {
+	doc, err := Dump(envDir, pluginName)
+	if err != nil {
+		return nil, err
+	}
+	if pluginName == "" {
+		if key, err = envKey(key); err != nil {
+			return nil, err
+		}
+	}
+	v, ok := config.GetByPath(doc, key)
+	if !ok {
+		return nil, fmt.Errorf("state key not found: %s", key)
+	}
+	return v, nil
+}
+
+// Set writes val at key; Unset removes key.
+func Set(envDir, pluginName, key string, val interface{}) error {
+	return edit(envDir, pluginName, key, func(m map[string]interface{}, k string) error {
+		return config.SetByPath(m, k, val)
+	})
+}
+
+func Unset(envDir, pluginName, key string) error {
+	return edit(envDir, pluginName, key, func(m map[string]interface{}, k string) error {
+		ok, err := config.DeleteByPath(m, k)
+		if err == nil && !ok {
+			err = fmt.Errorf("state key not found: %s", k)
+		}
+		return err
+	})
+}
+
+// Dump returns the whole state document.
+func Dump(envDir, pluginName string) (map[string]interface{}, error) {
+	if pluginName != "" {
+		_, st, err := pluginState(envDir, pluginName)
+		return st, err
+	}
+	s, err := env.LoadState(envDir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// List flattens the state into dot-path leaves in key order. Lists are
+// leaves, except env components which are listed one per name.
+func List(envDir, pluginName string) ([]Entry, error) {
+	var out []Entry
+	if pluginName != "" {
+		_, st, err := pluginState(envDir, pluginName)
+		if err != nil {
+			return nil, err
+		}
+		flatten(st, nil, &out)
+		return out, nil
+	}
+	s, err := env.LoadState(envDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range []Entry{{"created_at", s.CreatedAt}, {"initialized_at", s.InitializedAt}} {
+		if e.Value != "" {
+			out = append(out, e)
+		}
+	}
+	out = append(out, Entry{"notes", s.Notes})
+	for _, c := range s.Components {
+		v := c.Version
+		if c.Plugin != "" {
+			v += " (" + c.Plugin + ")"
+		}
+		out = append(out, Entry{config.FormatPath([]config.PathSeg{{Key: "components"}, {Key: c.Name}}), v})
+	}
+	if len(s.Values) > 0 {
+		flatten(s.Values, []config.PathSeg{{Key: "values"}}, &out)
+	}
+	return out, nil
+}
+
+// envKey maps a user key onto the environment state document.
+func envKey(key string) (string, error) {
+	segs, err := config.ParsePath(key)
+	if err != nil {
+		return "", err
+	}
+	if segs[0].Kind == config.SegKey && (managed[segs[0].Key] || segs[0].Key == "notes" || segs[0].Key == "values") {
+		return key, nil
+	}
+	return config.FormatPath(append([]config.PathSeg{{Key: "values"}}, segs...)), nil
+}
+
+func edit(envDir, pluginName, key string, fn func(m map[string]interface{}, k string) error) error {
+	if pluginName != "" {
+		path, st, err := pluginState(envDir, pluginName)
+		if err != nil {
+			return err
+		}
+		if err := fn(st, key); err != nil {
+			return err
+		}
+		return plugin.SavePluginState(path, st)
+	}
+	key, err := envKey(key)
+	if err != nil {
+		return err
+	}
+	segs, _ := config.ParsePath(key)
+	if managed[segs[0].Key] {
+		return fmt.Errorf("state key %s is managed by lyenv", segs[0].Key)
+	}
+	return env.UpdateState(envDir, func(s *env.State) error {
+		if segs[0].Key == "notes" {
+			m := map[string]interface{}{"notes": s.Notes}
+			if err := fn(m, key); err != nil {
+				return err
+			}
+			notes, ok := m["notes"]
+			if !ok {
+				notes = ""
+			}
+			str, ok := notes.(string)
+			if !ok {
+				return fmt.Errorf("state key notes must be a string")
+			}
+			s.Notes = str
+			return nil
+		}
+		m := map[string]interface{}{"values": s.Values}
+		if s.Values == nil {
+			m["values"] = map[string]interface{}{}
+		}
+		if err := fn(m, key); err != nil {
+			return err
+		}
+		vals, ok := m["values"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("state key values must be a map")
+		}
+		s.Values = vals
+		return nil
+	})
+}
+
+func pluginState(envDir, name string) (string, map[string]interface{}, error) {
+	dir, _, err := plugin.ResolvePluginDir(envDir, name)
+	if err != nil {
+		return "", nil, err
+	}
+	man, err := plugin.LoadManifest(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	st, err := plugin.LoadPluginState(dir, man)
+	if err != nil {
+		return "", nil, err
+	}
+	return plugin.PluginStateFile(dir, man), st, nil
+}
+
+func flatten(v interface{}, prefix []config.PathSeg, out *[]Entry) {
+	m, ok := v.(map[string]interface{})
+	if !ok || (len(m) == 0 && len(prefix) > 0) {
+		if len(prefix) > 0 && v != nil {
+			*out = append(*out, Entry{config.FormatPath(prefix), v})
+		}
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		seg := append(append([]config.PathSeg{}, prefix...), config.PathSeg{Key: k})
+		flatten(m[k], seg, out)
+	}
+}
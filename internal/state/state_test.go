@@ -0,0 +1,118 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"lyenv/internal/env"
+)
+
+func newEnv(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".lyenv"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	state := `{"created_at": "2026-01-01T00:00:00Z", "components": [{"name": "jdk", "version": "21", "plugin": "java"}], "notes": "", "added_by_newer_lyenv": {"k": 1}}`
+	if err := os.WriteFile(env.StateFile(home), []byte(state), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return home
+}
+
+func TestEnvStateSetGetUnset(t *testing.T) {
+	home := newEnv(t)
+	for _, kv := range []struct {
+		key string
+		val interface{}
+	}{
+		{"build.count", 3.0},
+		{"values.flag", true},
+		{"tags[+]", "a"},
+		{"notes", "hello"},
+	} {
+		if err := Set(home, "", kv.key, kv.val); err != nil {
+			t.Fatalf("Set(%s): %v", kv.key, err)
+		}
+	}
+	for key, want := range map[string]interface{}{
+		"build.count":        3.0,
+		"values.build.count": 3.0,
+		"flag":               true,
+		"tags[0]":            "a",
+		"notes":              "hello",
+		"created_at":         "2026-01-01T00:00:00Z",
+	} {
+		if got, err := Get(home, "", key); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Get(%s) = %v, %v; want %v", key, got, err, want)
+		}
+	}
+
+	if err := Unset(home, "", "build.count"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get(home, "", "build.count"); err == nil || !strings.Contains(err.Error(), "state key not found: values.build.count") {
+		t.Errorf("Get after Unset: %v", err)
+	}
+	if err := Unset(home, "", "build.count"); err == nil {
+		t.Error("second Unset succeeded")
+	}
+
+	// Fields of newer lyenv versions survive edits.
+	data, err := os.ReadFile(env.StateFile(home))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"added_by_newer_lyenv"`) {
+		t.Errorf("unknown field dropped:\n%s", data)
+	}
+}
+
+func TestEnvStateRejectsManagedKeys(t *testing.T) {
+	home := newEnv(t)
+	for _, key := range []string{"created_at", "initialized_at", "components", "components[0].version"} {
+		if err := Set(home, "", key, "x"); err == nil || !strings.Contains(err.Error(), "managed by lyenv") {
+			t.Errorf("Set(%s): %v", key, err)
+		}
+	}
+	if err := Set(home, "", "notes", 1); err == nil || !strings.Contains(err.Error(), "notes must be a string") {
+		t.Errorf("Set(notes, 1): %v", err)
+	}
+	if err := Set(home, "", "values", "x"); err == nil || !strings.Contains(err.Error(), "values must be a map") {
+		t.Errorf("Set(values, x): %v", err)
+	}
+	s, err := env.LoadState(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Notes != "" || len(s.Values) != 0 || len(s.Components) != 1 {
+		t.Errorf("rejected edits changed the state: %+v", s)
+	}
+}
+
+func TestEnvStateList(t *testing.T) {
+	home := newEnv(t)
+	if err := Set(home, "", "b.x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set(home, "", "a", []interface{}{"l"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := List(home, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{
+		{"created_at", "2026-01-01T00:00:00Z"},
+		{"notes", ""},
+		{"components.jdk", "21 (java)"},
+		{"values.a", []interface{}{"l"}},
+		{"values.b.x", "1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List =\n%v\nwant\n%v", got, want)
+	}
+}
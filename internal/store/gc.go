@@ -0,0 +1,210 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// gcGrace protects fresh entries: an install stores its tree and ref before
+// it writes its registry, so a concurrent gc must not judge it yet.
+const gcGrace = 10 * time.Minute
+
+// InUse reports whether installName in envDir still records the store entry hash.
+type InUse func(envDir, installName, hash string) bool
+
+// GCResult summarizes a garbage collection.
+type GCResult struct {
+	Trees    []string
+	Archives []string
+	Freed    int64
+}
+
+// GC drops refs no environment backs any more and removes the trees and
+// archives left without refs. With dryRun nothing is changed.
+func GC(inUse InUse, dryRun bool) (*GCResult, error) {
+	res := &GCResult{}
+	trash, err := collect(inUse, dryRun, res)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range trash {
+		if err := removeTree(t); err != nil {
+			return res, fmt.Errorf("failed to remove %s: %w", t, err)
+		}
+	}
+	return res, nil
+}
+
+// collect finds unreferenced entries under the store lock and, unless
+// dryRun, moves them aside for deletion.
+func collect(inUse InUse, dryRun bool, res *GCResult) ([]string, error) {
+	unlock, err := lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var trash []string
+	for _, kind := range []struct {
+		dir  string
+		list *[]string
+	}{{treesDir(), &res.Trees}, {archivesDir(), &res.Archives}} {
+		names, err := entries(kind.dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, hash := range names {
+			p := filepath.Join(kind.dir, hash)
+			if recent(p) || recent(filepath.Join(refsDir(), hash)) {
+				continue
+			}
+			lines, err := readRefs(hash)
+			if err != nil {
+				return nil, err
+			}
+			var live []string
+			for _, l := range lines {
+				if e, i, ok := strings.Cut(l, "\t"); ok && inUse(e, i, hash) {
+					live = append(live, l)
+				}
+			}
+			if len(live) > 0 {
+				if !dryRun && len(live) != len(lines) {
+					if err := writeRefs(hash, live); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+			*kind.list = append(*kind.list, hash)
+			res.Freed += size(p)
+			if dryRun {
+				continue
+			}
+			if err := writeRefs(hash, nil); err != nil {
+				return nil, err
+			}
+			// Move aside under the lock (same parent: frozen dirs cannot change
+			// parents); GC deletes after releasing it.
+			t := filepath.Join(kind.dir, fmt.Sprintf(".trash-%d-%s", os.Getpid(), hash))
+			if err := os.Rename(p, t); err != nil {
+				return nil, fmt.Errorf("failed to remove store entry %s: %w", hash, err)
+			}
+			trash = append(trash, t)
+		}
+	}
+	return trash, nil
+}
+
+// Problem is one store entry failing verification.
+type Problem struct {
+	Kind   string // tree|archive
+	Hash   string
+	Reason string
+	Refs   []Ref
+}
+
+// VerifyResult summarizes `lyenv store verify`.
+type VerifyResult struct {
+	Trees, Archives int
+	Problems        []Problem
+}
+
+// Verify recomputes the hash of every stored tree and archive. With repair,
+// corrupt entries are deleted so the next install stores a fresh copy.
+func Verify(repair bool) (*VerifyResult, error) {
+	res := &VerifyResult{}
+	check := func(kind, dir string, sum func(string) (string, error)) error {
+		names, err := entries(dir)
+		if err != nil {
+			return err
+		}
+		for _, hash := range names {
+			if kind == "tree" {
+				res.Trees++
+			} else {
+				res.Archives++
+			}
+			reason := ""
+			got, err := sum(filepath.Join(dir, hash))
+			switch {
+			case err != nil:
+				reason = err.Error()
+			case got != hash:
+				reason = "content changed (hash " + got + ")"
+			}
+			if reason != "" {
+				refs, _ := Refs(hash)
+				res.Problems = append(res.Problems, Problem{Kind: kind, Hash: hash, Reason: reason, Refs: refs})
+				if repair {
+					if err := drop(filepath.Join(dir, hash), hash); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	if err := check("tree", treesDir(), HashTree); err != nil {
+		return nil, err
+	}
+	if err := check("archive", archivesDir(), FileSHA256); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// drop deletes one store entry and its refs.
+func drop(path, hash string) error {
+	unlock, err := lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := writeRefs(hash, nil); err != nil {
+		return err
+	}
+	if err := removeTree(path); err != nil {
+		return fmt.Errorf("failed to remove store entry %s: %w", hash, err)
+	}
+	return nil
+}
+
+// entries lists the hash-named entries of a store directory.
+func entries(dir string) ([]string, error) {
+	ents, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin store: %w", err)
+	}
+	var out []string
+	for _, e := range ents {
+		if hashName.MatchString(e.Name()) {
+			out = append(out, e.Name())
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func recent(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && time.Since(fi.ModTime()) < gcGrace
+}
+
+func size(path string) int64 {
+	var n int64
+	_ = filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			n += fi.Size()
+		}
+		return nil
+	})
+	return n
+}
@@ -0,0 +1,436 @@
+// Package store is the user-level plugin store shared by all environments.
+//
+// Layout under env.UserStoreDir():
+//
+//	trees/<hash>/      extracted plugin trees, read-only, named by HashTree
+//	archives/<sha256>  downloaded plugin archives, named by their SHA-256
+//	refs/<hash>        one "<envDir>\t<installName>" line per install using an entry
+//
+// Environments link to trees (hardlinks, else symlinks, else copies), so a
+// plugin version used by many environments is stored and downloaded once.
+// Refs are hints: `lyenv store gc` keeps an entry only while some listed
+// environment still records it in its plugin registry.
+package store
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"lyenv/internal/env"
+)
+
+var hashName = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Dir returns the store root.
+func Dir() string { return env.UserStoreDir() }
+
+func treesDir() string    { return filepath.Join(Dir(), "trees") }
+func archivesDir() string { return filepath.Join(Dir(), "archives") }
+func refsDir() string     { return filepath.Join(Dir(), "refs") }
+
+// TreePath returns where the tree with the given hash lives.
+func TreePath(hash string) string { return filepath.Join(treesDir(), hash) }
+
+// ArchivePath returns where the archive with the given SHA-256 lives.
+func ArchivePath(sum string) string { return filepath.Join(archivesDir(), sum) }
+
+// InTree reports whether path lies inside a stored tree, as the target of a
+// plugin file symlinked to the store does.
+func InTree(path string) bool {
+	rel, err := filepath.Rel(treesDir(), path)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+func lock() (func(), error) {
+	if err := os.MkdirAll(Dir(), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create plugin store: %w", err)
+	}
+	return env.LockFile(filepath.Join(Dir(), ".lock"))
+}
+
+// HashTree returns the content hash of a plugin tree: paths, file contents,
+// the executable bit and symlink targets. The top-level logs/ directory is
+// not part of a plugin and is skipped.
+func HashTree(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "logs" && fi.IsDir() {
+			return filepath.SkipDir
+		}
+		switch {
+		case rel == ".":
+		case fi.IsDir():
+			fmt.Fprintf(h, "d %s\n", rel)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "l %s %s\n", rel, link)
+		case fi.Mode().IsRegular():
+			sum, err := FileSHA256(p)
+			if err != nil {
+				return err
+			}
+			x := "-"
+			if fi.Mode()&0o111 != 0 {
+				x = "x"
+			}
+			fmt.Fprintf(h, "f %s %s %s\n", rel, x, sum)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash plugin tree: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FileSHA256 returns the hex SHA-256 of a file.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// PutTree adds the tree at dir to the store (if not already there) and
+// returns its hash. Stored files are made read-only.
+func PutTree(dir string) (string, error) {
+	hash, err := HashTree(dir)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(TreePath(hash)); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(treesDir(), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create plugin store: %w", err)
+	}
+	tmp, err := os.MkdirTemp(treesDir(), ".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create plugin store: %w", err)
+	}
+	defer removeTree(tmp)
+	if err := copyTree(dir, tmp); err != nil {
+		return "", fmt.Errorf("failed to store plugin tree: %w", err)
+	}
+	if err := freeze(tmp); err != nil {
+		return "", fmt.Errorf("failed to store plugin tree: %w", err)
+	}
+	unlock, err := lock()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if _, err := os.Stat(TreePath(hash)); err == nil {
+		return hash, nil // stored concurrently
+	}
+	if err := os.Rename(tmp, TreePath(hash)); err != nil {
+		return "", fmt.Errorf("failed to store plugin tree: %w", err)
+	}
+	return hash, nil
+}
+
+// LinkTree recreates the stored tree hash at dst. Files are hardlinked to the
+// store, or symlinked when hardlinks are impossible (another filesystem), or
+// copied as a last resort. Paths in private (slash-separated, relative to the
+// tree) are always written as writable copies, since lyenv edits them in place.
+// When links are not safe (see SharedLinks) the whole tree is a private copy,
+// reflinked where the filesystem supports it.
+func LinkTree(hash, dst string, private map[string]bool) error {
+	src := TreePath(hash)
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("plugin store entry missing: %s", hash)
+	}
+	share := SharedLinks()
+	if !share && env.ReflinkTree(src, dst) {
+		return thaw(dst)
+	}
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !fi.Mode().IsRegular():
+			return nil
+		}
+		if share && !private[filepath.ToSlash(rel)] {
+			if err := os.Link(p, target); err == nil {
+				return nil
+			}
+			if err := os.Symlink(p, target); err == nil {
+				return nil
+			}
+		}
+		return copyFile(p, target, fi.Mode().Perm()|0o200)
+	})
+}
+
+// SharedLinks reports whether plugin trees may link to the store. The store
+// is protected by read-only modes only, which root ignores: a plugin run as
+// root that wrote to its own files would change the store, and with it every
+// environment sharing the tree. Root therefore always gets private copies.
+func SharedLinks() bool {
+	return geteuid() != 0
+}
+
+// geteuid is swapped in tests to exercise both link modes.
+var geteuid = os.Geteuid
+
+// thaw makes a private copy of a frozen tree writable again.
+func thaw(root string) error {
+	return filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.IsDir():
+			return os.Chmod(p, 0o755)
+		case fi.Mode().IsRegular():
+			return os.Chmod(p, fi.Mode().Perm()|0o200)
+		}
+		return nil
+	})
+}
+
+// PutArchive copies a downloaded archive into the store and returns its SHA-256.
+func PutArchive(path string) (string, error) {
+	sum, err := FileSHA256(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash archive: %w", err)
+	}
+	dst := ArchivePath(sum)
+	if _, err := os.Stat(dst); err == nil {
+		return sum, nil
+	}
+	if err := os.MkdirAll(archivesDir(), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create plugin store: %w", err)
+	}
+	tmp := dst + fmt.Sprintf(".tmp-%d", os.Getpid())
+	if err := copyFile(path, tmp, 0o444); err != nil {
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("failed to store archive: %w", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("failed to store archive: %w", err)
+	}
+	return sum, nil
+}
+
+// Archive returns the stored archive with the given SHA-256, if present.
+func Archive(sum string) (string, bool) {
+	sum = strings.ToLower(strings.TrimSpace(sum))
+	if !hashName.MatchString(sum) {
+		return "", false
+	}
+	p := ArchivePath(sum)
+	if _, err := os.Stat(p); err != nil {
+		return "", false
+	}
+	return p, true
+}
+
+// AddRef records that installName in envDir uses the entry hash.
+func AddRef(hash, envDir, installName string) error {
+	line := envDir + "\t" + installName
+	unlock, err := lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	refs, err := readRefs(hash)
+	if err != nil {
+		return err
+	}
+	for _, r := range refs {
+		if r == line {
+			return nil
+		}
+	}
+	return writeRefs(hash, append(refs, line))
+}
+
+// Ref is one recorded user of a store entry.
+type Ref struct {
+	Env, Install string
+}
+
+// Refs returns the recorded users of a store entry.
+func Refs(hash string) ([]Ref, error) {
+	lines, err := readRefs(hash)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Ref, 0, len(lines))
+	for _, l := range lines {
+		if e, i, ok := strings.Cut(l, "\t"); ok {
+			out = append(out, Ref{Env: e, Install: i})
+		}
+	}
+	return out, nil
+}
+
+func readRefs(hash string) ([]string, error) {
+	f, err := os.Open(filepath.Join(refsDir(), hash))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store refs: %w", err)
+	}
+	defer f.Close()
+	var out []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if l := strings.TrimSpace(sc.Text()); l != "" {
+			out = append(out, l)
+		}
+	}
+	return out, sc.Err()
+}
+
+func writeRefs(hash string, lines []string) error {
+	p := filepath.Join(refsDir(), hash)
+	if len(lines) == 0 {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to write store refs: %w", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(refsDir(), 0o755); err != nil {
+		return fmt.Errorf("failed to write store refs: %w", err)
+	}
+	sort.Strings(lines)
+	if err := env.WriteFileAtomic(p, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write store refs: %w", err)
+	}
+	return nil
+}
+
+// freeze makes a stored tree read-only, keeping executable bits.
+func freeze(root string) error {
+	var dirs []string
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.IsDir():
+			dirs = append(dirs, p)
+		case fi.Mode().IsRegular():
+			mode := os.FileMode(0o444)
+			if fi.Mode()&0o111 != 0 {
+				mode = 0o555
+			}
+			return os.Chmod(p, mode)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Deepest first, so the walk above never met a locked directory.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i], 0o555); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTree deletes a (possibly frozen) tree.
+func removeTree(root string) error {
+	_ = filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			_ = os.Chmod(p, 0o755)
+		}
+		return nil
+	})
+	return os.RemoveAll(root)
+}
+
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if filepath.ToSlash(rel) == "logs" && fi.IsDir() {
+			return filepath.SkipDir
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case fi.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case fi.Mode().IsRegular():
+			return copyFile(p, target, fi.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(from, to string, mode os.FileMode) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(to, mode)
+}
@@ -0,0 +1,323 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useStore points the store at a fresh directory and fixes the effective uid.
+func useStore(t *testing.T, euid int) {
+	t.Helper()
+	t.Setenv("LYENV_STORE_DIR", t.TempDir())
+	old := geteuid
+	geteuid = func() int { return euid }
+	t.Cleanup(func() { geteuid = old })
+}
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, body := range files {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func samplePlugin(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"manifest.yaml":      "name: tool\n",
+		"bin/run.sh":         "#!/bin/sh\necho run\n",
+		"config.yaml":        "a: 1\n",
+		"state/state.json":   "{}\n",
+		"logs/dispatch.json": "{}\n",
+	})
+	if err := os.Chmod(filepath.Join(dir, "bin", "run.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin/run.sh", filepath.Join(dir, "run")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func mustHash(t *testing.T, dir string) string {
+	t.Helper()
+	h, err := HashTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestHashTree(t *testing.T) {
+	dir := samplePlugin(t)
+	base := mustHash(t, dir)
+	if !hashName.MatchString(base) {
+		t.Fatalf("hash %q is not a sha256", base)
+	}
+
+	same := []func(){
+		func() { writeTree(t, dir, map[string]string{"logs/new.log": "x"}) },
+		func() { _ = os.Chtimes(filepath.Join(dir, "config.yaml"), time.Unix(1, 0), time.Unix(1, 0)) },
+		func() { _ = os.Chmod(filepath.Join(dir, "config.yaml"), 0o600) },
+	}
+	for i, change := range same {
+		change()
+		if got := mustHash(t, dir); got != base {
+			t.Errorf("unrelated change %d altered the hash", i)
+		}
+	}
+
+	changes := map[string]func(d string){
+		"content":  func(d string) { writeTree(t, d, map[string]string{"config.yaml": "a: 2\n"}) },
+		"exec bit": func(d string) { _ = os.Chmod(filepath.Join(d, "config.yaml"), 0o755) },
+		"new file": func(d string) { writeTree(t, d, map[string]string{"extra": ""}) },
+		"rename":   func(d string) { _ = os.Rename(filepath.Join(d, "config.yaml"), filepath.Join(d, "config.yml")) },
+		"new dir":  func(d string) { _ = os.Mkdir(filepath.Join(d, "empty"), 0o755) },
+		"symlink": func(d string) {
+			_ = os.Remove(filepath.Join(d, "run"))
+			_ = os.Symlink("manifest.yaml", filepath.Join(d, "run"))
+		},
+	}
+	for name, change := range changes {
+		d := samplePlugin(t)
+		change(d)
+		if mustHash(t, d) == base {
+			t.Errorf("%s did not change the hash", name)
+		}
+	}
+}
+
+func TestPutTree(t *testing.T) {
+	useStore(t, 1000)
+	dir := samplePlugin(t)
+	hash, err := PutTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := PutTree(dir); err != nil || again != hash {
+		t.Errorf("second PutTree = %s, %v", again, err)
+	}
+	stored := TreePath(hash)
+	if got := mustHash(t, stored); got != hash {
+		t.Errorf("stored tree hashes to %s, want %s", got, hash)
+	}
+	if _, err := os.Stat(filepath.Join(stored, "logs")); !os.IsNotExist(err) {
+		t.Error("logs/ was stored")
+	}
+	for rel, want := range map[string]os.FileMode{"config.yaml": 0o444, "bin/run.sh": 0o555, "bin": 0o555, ".": 0o555} {
+		fi, err := os.Stat(filepath.Join(stored, rel))
+		if err != nil || fi.Mode().Perm() != want {
+			t.Errorf("%s mode = %v, %v; want %v", rel, fi.Mode().Perm(), err, want)
+		}
+	}
+	ents, _ := os.ReadDir(treesDir())
+	if len(ents) != 1 {
+		t.Errorf("store has %d entries, want 1 (temp dirs left behind?)", len(ents))
+	}
+}
+
+func TestLinkTreeShared(t *testing.T) {
+	useStore(t, 1000)
+	hash, err := PutTree(samplePlugin(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "tool")
+	if err := LinkTree(hash, dst, map[string]bool{"config.yaml": true, "state/state.json": true}); err != nil {
+		t.Fatal(err)
+	}
+	for rel, linked := range map[string]bool{"manifest.yaml": true, "bin/run.sh": true, "config.yaml": false, "state/state.json": false} {
+		a, err := os.Stat(filepath.Join(dst, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := os.Stat(filepath.Join(TreePath(hash), rel))
+		if os.SameFile(a, b) != linked {
+			t.Errorf("%s: linked to store = %v, want %v", rel, !linked, linked)
+		}
+		if !linked && a.Mode().Perm()&0o200 == 0 {
+			t.Errorf("private %s is not writable", rel)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "run")); err != nil || link != "bin/run.sh" {
+		t.Errorf("symlink = %q, %v", link, err)
+	}
+	if got := mustHash(t, dst); got != hash {
+		t.Errorf("linked tree hashes to %s, want %s", got, hash)
+	}
+}
+
+func TestLinkTreeRootGetsPrivateCopies(t *testing.T) {
+	useStore(t, 0)
+	hash, err := PutTree(samplePlugin(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "tool")
+	if err := LinkTree(hash, dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	err = filepath.Walk(dst, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		rel, _ := filepath.Rel(dst, p)
+		b, err := os.Stat(filepath.Join(TreePath(hash), rel))
+		if err != nil {
+			return err
+		}
+		if os.SameFile(fi, b) {
+			t.Errorf("%s is shared with the store", rel)
+		}
+		if fi.Mode().Perm()&0o200 == 0 {
+			t.Errorf("%s is not writable", rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writing through the copy leaves the store intact.
+	if err := os.WriteFile(filepath.Join(dst, "manifest.yaml"), []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := Verify(false); err != nil || len(res.Problems) != 0 {
+		t.Errorf("store damaged: %+v, %v", res, err)
+	}
+}
+
+func TestLinkTreeMissingEntry(t *testing.T) {
+	useStore(t, 1000)
+	err := LinkTree(strings.Repeat("0", 64), filepath.Join(t.TempDir(), "x"), nil)
+	if err == nil || !strings.Contains(err.Error(), "plugin store entry missing") {
+		t.Errorf("got %v", err)
+	}
+}
+
+// age backdates a store entry and its refs past the gc grace period.
+func age(t *testing.T, hash string) {
+	t.Helper()
+	old := time.Now().Add(-2 * gcGrace)
+	for _, p := range []string{TreePath(hash), ArchivePath(hash), filepath.Join(refsDir(), hash)} {
+		if err := os.Chtimes(p, old, old); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGC(t *testing.T) {
+	useStore(t, 1000)
+	kept, err := PutTree(samplePlugin(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := samplePlugin(t)
+	writeTree(t, d, map[string]string{"other": "x"})
+	dropped, err := PutTree(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := samplePlugin(t)
+	writeTree(t, fresh, map[string]string{"fresh": "x"})
+	young, err := PutTree(fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []struct{ hash, env string }{{kept, "/envs/a"}, {kept, "/envs/gone"}, {dropped, "/envs/gone"}} {
+		if err := AddRef(r.hash, r.env, "tool"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	age(t, kept)
+	age(t, dropped)
+	inUse := func(envDir, installName, hash string) bool { return envDir == "/envs/a" }
+
+	res, err := GC(inUse, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Trees) != 1 || res.Trees[0] != dropped || res.Freed == 0 {
+		t.Errorf("dry run = %+v", res)
+	}
+	if _, err := os.Stat(TreePath(dropped)); err != nil {
+		t.Error("dry run removed a tree")
+	}
+
+	if _, err := GC(inUse, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(TreePath(dropped)); !os.IsNotExist(err) {
+		t.Error("unreferenced tree kept")
+	}
+	if _, err := os.Stat(TreePath(young)); err != nil {
+		t.Error("tree within the grace period removed")
+	}
+	refs, err := Refs(kept)
+	if err != nil || len(refs) != 1 || refs[0] != (Ref{Env: "/envs/a", Install: "tool"}) {
+		t.Errorf("refs of kept tree = %v, %v", refs, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	useStore(t, 1000)
+	hash, err := PutTree(samplePlugin(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "a.tgz")
+	writeTree(t, filepath.Dir(archive), map[string]string{"a.tgz": "archive bytes"})
+	sum, err := PutArchive(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := Archive(strings.ToUpper(sum)); !ok || p != ArchivePath(sum) {
+		t.Errorf("Archive(%s) = %s, %v", sum, p, ok)
+	}
+	if _, ok := Archive("../" + sum); ok {
+		t.Error("Archive accepted a path")
+	}
+	if err := AddRef(hash, "/envs/a", "tool"); err != nil {
+		t.Fatal(err)
+	}
+
+	f := filepath.Join(TreePath(hash), "manifest.yaml")
+	if err := os.Chmod(f, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(f, []byte("tampered\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Verify(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Trees != 1 || res.Archives != 1 || len(res.Problems) != 1 {
+		t.Fatalf("Verify = %+v", res)
+	}
+	if p := res.Problems[0]; p.Kind != "tree" || p.Hash != hash || !strings.HasPrefix(p.Reason, "content changed") || len(p.Refs) != 1 {
+		t.Errorf("problem = %+v", p)
+	}
+
+	if _, err := Verify(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(TreePath(hash)); !os.IsNotExist(err) {
+		t.Error("repair kept the corrupt tree")
+	}
+	if refs, _ := Refs(hash); len(refs) != 0 {
+		t.Errorf("repair kept refs %v", refs)
+	}
+	if res, err := Verify(false); err != nil || len(res.Problems) != 0 || res.Archives != 1 {
+		t.Errorf("after repair: %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,443 @@
+// Package template creates environments from reusable templates and saves
+// existing environments as templates.
+//
+// A template is a directory (or a .tar.gz/.tgz/.zip archive of one) with:
+//
+//	template.yaml   optional: name, description and the plugins to install
+//	lyenv.yaml      optional: base config (the default config when absent)
+//	workspace/      optional: skeleton files copied into the new workspace
+//	plugins/<name>/ optional: plugin directories referenced by "path" entries
+package template
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"lyenv/internal/cache"
+	"lyenv/internal/config"
+	"lyenv/internal/env"
+	"lyenv/internal/plugin"
+)
+
+// Builtin is the template used when --template is not given.
+const Builtin = "default"
+
+// manifestFile describes a template.
+const manifestFile = "template.yaml"
+
+// Manifest is the content of template.yaml.
+type Manifest struct {
+	Name        string   `yaml:"name,omitempty"`
+	Description string   `yaml:"description,omitempty"`
+	Plugins     []Plugin `yaml:"plugins,omitempty"`
+}
+
+// Plugin is one plugin installed when the template is applied. Exactly one of
+// Name (plugin center), Path (directory inside the template), Repo or Source
+// selects where it comes from.
+type Plugin struct {
+	Name   string `yaml:"name,omitempty"`
+	Path   string `yaml:"path,omitempty"`
+	Repo   string `yaml:"repo,omitempty"`
+	Source string `yaml:"source,omitempty"`
+	Ref    string `yaml:"ref,omitempty"`
+	As     string `yaml:"as,omitempty"` // install name override
+}
+
+// Info summarizes an available template.
+type Info struct {
+	Name        string
+	Description string
+	Dir         string // empty for the built-in template
+}
+
+// Dir is where `lyenv template save` stores named templates.
+func Dir() string {
+	return filepath.Join(env.UserConfigDir(), "templates")
+}
+
+// List returns the built-in template followed by saved templates.
+func List() ([]Info, error) {
+	out := []Info{{Name: Builtin, Description: "built-in default configuration"}}
+	entries, err := os.ReadDir(Dir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read templates dir: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(Dir(), e.Name())
+		info := Info{Name: e.Name(), Dir: dir}
+		if m, err := loadManifest(dir); err == nil {
+			info.Description = m.Description
+		}
+		out = append(out, info)
+	}
+	sort.SliceStable(out[1:], func(i, j int) bool { return out[i+1].Name < out[j+1].Name })
+	return out, nil
+}
+
+// Create creates a new environment at dir from the template ref, which is a
+// saved template name, a local directory or archive, or an http(s) URL of an
+// archive. An empty ref or "default" uses the built-in config.
+func Create(dir, ref string) error {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || ref == Builtin {
+		return env.CmdCreate(dir)
+	}
+	if env.IsLyenvDir(dir) {
+		return fmt.Errorf("target directory already looks like a lyenv environment: %s", dir)
+	}
+	src, cleanup, err := resolve(ref)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	m, err := loadManifest(src)
+	if err != nil {
+		return err
+	}
+
+	if err := env.CmdCreate(dir); err != nil {
+		return err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve target path: %w", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(src, "lyenv.yaml")); err == nil {
+		if err := os.WriteFile(filepath.Join(absDir, "lyenv.yaml"), data, 0o644); err != nil {
+			return fmt.Errorf("failed to write lyenv.yaml: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read template lyenv.yaml: %w", err)
+	}
+	if ws := filepath.Join(src, "workspace"); isDir(ws) {
+		if err := copyTree(ws, filepath.Join(absDir, "workspace")); err != nil {
+			return fmt.Errorf("failed to copy workspace skeleton: %w", err)
+		}
+	}
+	for i, p := range m.Plugins {
+		if err := installPlugin(absDir, src, p); err != nil {
+			return fmt.Errorf("template plugin #%d (%s): %w", i+1, p.label(), err)
+		}
+	}
+	return nil
+}
+
+func installPlugin(envDir, src string, p Plugin) error {
+	switch {
+	case p.Path != "":
+		if filepath.IsAbs(p.Path) || strings.HasPrefix(filepath.Clean(p.Path), "..") {
+			return fmt.Errorf("path must be relative to the template: %s", p.Path)
+		}
+		return plugin.PluginAdd(envDir, filepath.Join(src, p.Path), "", "", "", "", p.As)
+	case p.Repo != "", p.Source != "", p.Name != "":
+		return plugin.PluginAdd(envDir, p.Name, p.Source, p.Repo, p.Ref, "", p.As)
+	}
+	return fmt.Errorf("one of name, path, repo or source is required")
+}
+
+func (p Plugin) label() string {
+	for _, s := range []string{p.As, p.Name, p.Path, p.Repo, p.Source} {
+		if s != "" {
+			return s
+		}
+	}
+	return "?"
+}
+
+// Save turns the environment at envDir into a template named name (stored
+// under Dir()), or written to name itself when it looks like a path. Plugins
+// from the plugin center are recorded by name; all others are copied into
+// the template. Workspace files larger than maxSkeletonFile are skipped.
+func Save(envDir, name string, force bool) (string, int, error) {
+	dest := name
+	if !strings.ContainsAny(name, `/\`) && !strings.HasPrefix(name, ".") {
+		if name == Builtin || !validName(name) {
+			return "", 0, fmt.Errorf("invalid template name: %s", name)
+		}
+		dest = filepath.Join(Dir(), name)
+	}
+	if _, err := os.Stat(dest); err == nil {
+		if !force {
+			return "", 0, fmt.Errorf("template already exists: %s (use --force to replace)", dest)
+		}
+		if err := os.RemoveAll(dest); err != nil {
+			return "", 0, fmt.Errorf("failed to remove old template: %w", err)
+		}
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return "", 0, fmt.Errorf("failed to create template dir: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(envDir, "lyenv.yaml"))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read lyenv.yaml: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "lyenv.yaml"), data, 0o644); err != nil {
+		return "", 0, fmt.Errorf("failed to write lyenv.yaml: %w", err)
+	}
+	skipped := 0
+	if ws := filepath.Join(envDir, "workspace"); isDir(ws) {
+		n, err := copySkeleton(ws, filepath.Join(dest, "workspace"))
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to copy workspace skeleton: %w", err)
+		}
+		skipped = n
+	}
+
+	m := Manifest{Name: filepath.Base(dest)}
+	if cfg, err := config.LoadYAML(filepath.Join(envDir, "lyenv.yaml")); err == nil {
+		if v, ok := config.GetByPath(cfg, "env.name"); ok {
+			m.Description = fmt.Sprintf("saved from environment %v", v)
+		}
+	}
+	r, err := plugin.LoadRegistry(envDir)
+	if err != nil {
+		return "", 0, err
+	}
+	for _, ip := range r.Plugins {
+		p := Plugin{}
+		if center := ip.CenterName(); center != "" {
+			// installed from the plugin center: its version constraint, else
+			// the installed version (ref is a version for center plugins)
+			p.Name = center
+			p.Ref = ip.Constraint
+			if p.Ref == "" {
+				p.Ref = ip.Version
+			}
+			if ip.InstallName != center {
+				p.As = ip.InstallName
+			}
+		} else {
+			rel := filepath.Join("plugins", ip.InstallName)
+			if err := copyTree(filepath.Join(envDir, rel), filepath.Join(dest, rel), "logs"); err != nil {
+				return "", 0, fmt.Errorf("failed to copy plugin %s: %w", ip.InstallName, err)
+			}
+			p.Path = filepath.ToSlash(rel)
+			if ip.InstallName != ip.Name {
+				p.As = ip.InstallName
+			}
+		}
+		m.Plugins = append(m.Plugins, p)
+	}
+	out, err := yaml.Marshal(&m)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.WriteFile(filepath.Join(dest, manifestFile), out, 0o644); err != nil {
+		return "", 0, fmt.Errorf("failed to write %s: %w", manifestFile, err)
+	}
+	return dest, skipped, nil
+}
+
+// resolve returns a local directory holding the template.
+func resolve(ref string) (string, func(), error) {
+	noop := func() {}
+	if strings.Contains(ref, "://") {
+		if cache.Offline("") {
+			return "", noop, fmt.Errorf("offline: cannot download template %s", ref)
+		}
+		tmp, err := os.MkdirTemp("", "lyenv-template-")
+		if err != nil {
+			return "", noop, err
+		}
+		cleanup := func() { _ = os.RemoveAll(tmp) }
+		archive := filepath.Join(tmp, archiveBase(ref))
+		if err := plugin.FetchURL(ref, archive, proxyFromUserConfig()); err != nil {
+			cleanup()
+			return "", noop, fmt.Errorf("failed to download template: %w", err)
+		}
+		dir, err := extract(archive, filepath.Join(tmp, "src"))
+		if err != nil {
+			cleanup()
+			return "", noop, err
+		}
+		return dir, cleanup, nil
+	}
+	if st, err := os.Stat(ref); err == nil {
+		if st.IsDir() {
+			abs, err := filepath.Abs(ref)
+			return abs, noop, err
+		}
+		tmp, err := os.MkdirTemp("", "lyenv-template-")
+		if err != nil {
+			return "", noop, err
+		}
+		cleanup := func() { _ = os.RemoveAll(tmp) }
+		dir, err := extract(ref, tmp)
+		if err != nil {
+			cleanup()
+			return "", noop, err
+		}
+		return dir, cleanup, nil
+	}
+	if validName(ref) {
+		if dir := filepath.Join(Dir(), ref); isDir(dir) {
+			return dir, noop, nil
+		}
+	}
+	return "", noop, fmt.Errorf("template not found: %s (see `lyenv template list`)", ref)
+}
+
+// proxyFromUserConfig reads config.network.proxy_url from the user layer;
+// no environment exists yet when a template is downloaded.
+func proxyFromUserConfig() string {
+	cfg, err := config.LoadYAML(filepath.Join(env.UserConfigDir(), "config.yaml"))
+	if err != nil {
+		return ""
+	}
+	v, _ := config.GetByPath(cfg, "config.network.proxy_url")
+	s, _ := v.(string)
+	return strings.TrimSpace(s)
+}
+
+func archiveBase(url string) string {
+	base := url
+	if i := strings.IndexAny(base, "?#"); i >= 0 {
+		base = base[:i]
+	}
+	return filepath.Base(base)
+}
+
+// extract unpacks a .tar.gz/.tgz or .zip archive into dst and returns the
+// template root: dst itself, or its only subdirectory when the archive wraps
+// everything in one top-level folder.
+func extract(archive, dst string) (string, error) {
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return "", err
+	}
+	lower := strings.ToLower(archive)
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		cmd = exec.Command("tar", "-xzf", archive, "-C", dst)
+	case strings.HasSuffix(lower, ".zip"):
+		cmd = exec.Command("unzip", "-q", "-o", archive, "-d", dst)
+	default:
+		return "", fmt.Errorf("unsupported template archive: %s (use .tar.gz, .tgz or .zip)", archive)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to extract template: %w", err)
+	}
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dst, entries[0].Name()), nil
+	}
+	return dst, nil
+}
+
+func loadManifest(dir string) (*Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if os.IsNotExist(err) {
+		return &m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", manifestFile, err)
+	}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", manifestFile, err)
+	}
+	return &m, nil
+}
+
+// maxSkeletonFile caps the size of workspace files saved into a template so
+// that downloaded SDKs and build outputs are not captured.
+const maxSkeletonFile = 1 << 20
+
+func copySkeleton(src, dst string) (int, error) {
+	skipped := 0
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() > maxSkeletonFile {
+			skipped++
+			return nil
+		}
+		return copyFile(path, target, info.Mode().Perm())
+	})
+	return skipped, err
+}
+
+// copyTree copies src into dst, skipping top-level entries named in skip.
+func copyTree(src, dst string, skip ...string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		for _, s := range skip {
+			if rel == s {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, perm)
+}
+
+func isDir(p string) bool {
+	st, err := os.Stat(p)
+	return err == nil && st.IsDir()
+}
+
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return !strings.HasPrefix(s, ".")
+}
@@ -1,7 +1,8 @@
 #!/usr/bin/env bash
 # End-to-end test covering: create/init/activate, config ops, center sync/search,
 # plugin install (center/local), run (shell+stdio, multi-step), timeout policies,
-# update, list/info, remove & shim, logs & mutations, dispatch log, JSON dump/load.
+# update, list/info, remove & shim, logs & mutations, dispatch log, JSON dump/load,
+# dot paths, dotenv/INI files, secrets, state, snapshots, clone, doctor and the store.
 # All comments and outputs are in English.
 
 set -euo pipefail
@@ -289,13 +290,91 @@ step "[15] Inspect global dispatch log"
 assert_file ".lyenv/logs/dispatch.log"
 tail -n +1 ".lyenv/logs/dispatch.log" | sed -n '1,10p' || true
 
+# -------- Config paths, formats, secrets and state --------
+step "[16] Dot paths, file formats, secrets and state"
+"$LY" config set e2e.servers[+].host h1
+"$LY" config set e2e.servers[0].port 8080 --type=int
+[[ "$("$LY" config get e2e.servers[-1].host)" == "h1" ]] || die "dot path append/read failed"
+"$LY" config dump e2e.servers[0] ./server.env
+assert_contains "./server.env" "port=8080"
+"$LY" config dump e2e.servers[0] ./server.ini
+"$LY" config load ./server.ini --merge=keep
+set +e
+"$LY" config dump e2e ./lists.env
+RC=$?
+set -e
+expect_nonzero "$RC"
+info "dotenv rejects lists (non-zero exit as expected)."
+"$LY" config validate
+
+printf 's3cret' | "$LY" secret set e2e_token
+"$LY" config set e2e.token '${secret:e2e_token}'
+[[ "$("$LY" config get e2e.token)" == "s3cret" ]] || die "secret reference not resolved"
+[[ "$("$LY" config get e2e.token --raw)" == '${secret:e2e_token}' ]] || die "--raw resolved the reference"
+if grep -Fq "s3cret" lyenv.yaml .lyenv/secrets/*; then die "secret stored in plain text"; fi
+"$LY" secret rm e2e_token
+
+"$LY" state set e2e.runs 1 --type=int
+[[ "$("$LY" state get e2e.runs)" == "1" ]] || die "state get failed"
+"$LY" state unset e2e.runs
+
+# -------- Snapshots, clone, doctor and store --------
+step "[17] Snapshots, clone, doctor and shared store"
+STATE_DIR="state_demo"
+mkdir -p "$STATE_DIR"
+cat > "$STATE_DIR/manifest.yaml" <<'YAML'
+name: statedemo
+version: 0.1.0
+expose: [sdctl]
+config:
+  state_file: state/count.json
+commands:
+  - name: hello
+    executor: shell
+    program: 'echo "statedemo: hello"'
+YAML
+"$LY" plugin add "./$STATE_DIR" --name=statetools
+"$LY" state set count 1 --type=int --plugin=statetools
+
+"$LY" snapshot create e2e-base
+"$LY" config set env.name snapshot-changed
+"$LY" plugin remove statetools --force
+"$LY" snapshot restore e2e-base
+[[ "$("$LY" config get env.name)" != "snapshot-changed" ]] || die "snapshot restore kept the edited config"
+assert_file "plugins/statetools/manifest.yaml"
+"$LY" snapshot list
+"$LY" snapshot rm e2e-base
+
+CLONE_DIR="../${ENV_DIR}_clone"
+"$LY" env clone . "$CLONE_DIR"
+[[ ! "$CLONE_DIR/plugins/statetools/state/count.json" -ef "plugins/statetools/state/count.json" ]] || die "clone shares the plugin state file"
+"$LY" --env="$CLONE_DIR" state set count 2 --type=int --plugin=statetools
+[[ "$("$LY" state get count --plugin=statetools)" == "1" ]] || die "clone changed the source plugin state"
+"$LY" env rm "$CLONE_DIR" --yes
+
+rm -f bin/sdctl
+set +e
+"$LY" doctor
+RC=$?
+set -e
+expect_nonzero "$RC"
+"$LY" doctor --fix
+"$LY" doctor
+assert_file "bin/sdctl"
+
+"$LY" store verify
+"$LY" store gc --dry-run
+"$LY" plugin remove statetools --force
+info "Snapshots, clone, doctor and store OK"
+
 # -------- Final Summary --------
-step "[16] Summary"
+step "[18] Summary"
 echo "Environment: $ENV_DIR"
 echo "Center index: $CENTER_INDEX_URL"
 echo "Plugin operations: install, run (shell+stdio), timeout, remove, local add/install/remove verified."
 echo "Logs & mutations: OK"
 echo "Config dump/load JSON: OK"
+echo "Dot paths, formats, secrets, state, snapshots, clone, doctor, store: OK"
 
 popd >/dev/null
 echo